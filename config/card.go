@@ -0,0 +1,59 @@
+package config
+
+import "time"
+
+// Development card keys, used only when DevKeys is set. They are public, so
+// cards issued with them are not protected.
+const (
+	devNumberHashKey = "dev-secret-card-number"
+	devMasterKeyId   = "dev"
+	devMasterKeys    = devMasterKeyId + ":ZGV2LXNlY3JldC1jYXJkLW1hc3Rlci1rZXktMDAwMDA="
+)
+
+type CardConfig struct {
+	// HoldTTL is how long an authorization reserves funds before it expires
+	HoldTTL time.Duration
+	// NumberHashKey is the HMAC key of the card number index, it has no
+	// default and must be kept secret
+	NumberHashKey string
+	// MasterKeys are the master keys of the local card key provider as
+	// comma or newline separated "id:base64 key" pairs
+	MasterKeys string
+	// MasterKeysFile, when set, is read for the master keys instead of MasterKeys
+	MasterKeysFile string
+	// MasterKeyId is the master key new card data keys are wrapped with
+	MasterKeyId string
+	// DevKeys fills the keys that are not set with public development keys
+	// for local runs, it must never be set in production
+	DevKeys bool
+}
+
+func LoadCardConfig() CardConfig {
+	holdTTL, err := time.ParseDuration(GetEnv("card.hold_ttl", "168h"))
+	if err != nil || holdTTL <= 0 {
+		holdTTL = 7 * 24 * time.Hour
+	}
+
+	cardConfig := CardConfig{
+		HoldTTL:        holdTTL,
+		NumberHashKey:  GetEnv("card.number_hash_key", ""),
+		MasterKeys:     GetEnv("card.master_keys", ""),
+		MasterKeysFile: GetEnv("card.master_keys_file", ""),
+		MasterKeyId:    GetEnv("card.master_key_id", ""),
+		DevKeys:        GetEnv("card.dev_keys", "false") == "true",
+	}
+
+	if cardConfig.DevKeys {
+		if cardConfig.NumberHashKey == "" {
+			cardConfig.NumberHashKey = devNumberHashKey
+		}
+		if cardConfig.MasterKeys == "" && cardConfig.MasterKeysFile == "" {
+			cardConfig.MasterKeys = devMasterKeys
+			if cardConfig.MasterKeyId == "" {
+				cardConfig.MasterKeyId = devMasterKeyId
+			}
+		}
+	}
+
+	return cardConfig
+}
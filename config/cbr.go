@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CbrConfig struct {
+	Url string
+	// KeyRateProvider is "cbr" to query the Central Bank or "static" to use StaticKeyRate
+	KeyRateProvider string
+	StaticKeyRate   float64
+	KeyRateCacheTTL time.Duration
+	// ExchangeRateProvider is "cbr" to use the daily rates of the Central Bank or "static" to use StaticExchangeRates
+	ExchangeRateProvider string
+	ExchangeRateCacheTTL time.Duration
+	// ExchangeRateMaxAge is the age after which the last known rates are no
+	// longer used when the Central Bank is unavailable
+	ExchangeRateMaxAge time.Duration
+	// StaticExchangeRates are prices in rubles of one unit of a currency,
+	// read from a list like "USD:90.5,EUR:98.2"
+	StaticExchangeRates map[string]float64
+}
+
+func LoadCbrConfig() CbrConfig {
+	staticKeyRate, err := strconv.ParseFloat(GetEnv("cbr.static_key_rate", "21"), 64)
+	if err != nil {
+		staticKeyRate = 21
+	}
+
+	cacheTTL, err := time.ParseDuration(GetEnv("cbr.key_rate_cache_ttl", "1h"))
+	if err != nil {
+		cacheTTL = time.Hour
+	}
+
+	exchangeRateCacheTTL, err := time.ParseDuration(GetEnv("cbr.exchange_rate_cache_ttl", "1h"))
+	if err != nil {
+		exchangeRateCacheTTL = time.Hour
+	}
+
+	exchangeRateMaxAge, err := time.ParseDuration(GetEnv("cbr.exchange_rate_max_age", "24h"))
+	if err != nil || exchangeRateMaxAge <= 0 {
+		exchangeRateMaxAge = 24 * time.Hour
+	}
+
+	return CbrConfig{
+		Url:                  GetEnv("cbr.url", "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"),
+		KeyRateProvider:      GetEnv("cbr.key_rate_provider", "cbr"),
+		StaticKeyRate:        staticKeyRate,
+		KeyRateCacheTTL:      cacheTTL,
+		ExchangeRateProvider: GetEnv("cbr.exchange_rate_provider", "cbr"),
+		ExchangeRateCacheTTL: exchangeRateCacheTTL,
+		ExchangeRateMaxAge:   exchangeRateMaxAge,
+		StaticExchangeRates:  parseRates(GetEnv("cbr.static_exchange_rates", "USD:90,EUR:100,CNY:12.5")),
+	}
+}
+
+// parseRates reads "CODE:rate" pairs separated by commas, skipping malformed ones.
+func parseRates(value string) map[string]float64 {
+	rates := make(map[string]float64)
+
+	for _, pair := range strings.Split(value, ",") {
+		code, rate, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(rate, 64)
+		if err != nil || parsed <= 0 {
+			continue
+		}
+
+		rates[strings.ToUpper(code)] = parsed
+	}
+
+	return rates
+}
@@ -0,0 +1,19 @@
+package config
+
+import "strconv"
+
+type ExchangeConfig struct {
+	// Spread is the margin of the bank on currency conversions, percent of the converted amount
+	Spread float64
+}
+
+func LoadExchangeConfig() ExchangeConfig {
+	spread, err := strconv.ParseFloat(GetEnv("exchange.spread", "1"), 64)
+	if err != nil || spread < 0 || spread >= 100 {
+		spread = 1
+	}
+
+	return ExchangeConfig{
+		Spread: spread,
+	}
+}
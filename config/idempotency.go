@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+type IdempotencyConfig struct {
+	// LeaseTimeout is how long a key stays reserved by a request that has not
+	// completed, e.g. because the server stopped; afterwards a retry with the
+	// same request may reserve it again
+	LeaseTimeout time.Duration
+}
+
+func LoadIdempotencyConfig() IdempotencyConfig {
+	leaseTimeout, err := time.ParseDuration(GetEnv("idempotency.lease_timeout", "5m"))
+	if err != nil || leaseTimeout <= 0 {
+		leaseTimeout = 5 * time.Minute
+	}
+
+	return IdempotencyConfig{
+		LeaseTimeout: leaseTimeout,
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import "strconv"
+
+type LoanConfig struct {
+	// PenaltyDailyRate is the penalty accrued on overdue payments, percent per day
+	PenaltyDailyRate float64
+	// MaxDebtToIncome is the highest share of monthly income that may go to loan installments
+	MaxDebtToIncome float64
+	// DefaultAfterDays is how long a payment may stay overdue before the loan is considered defaulted
+	DefaultAfterDays int
+}
+
+func LoadLoanConfig() LoanConfig {
+	penaltyDailyRate, err := strconv.ParseFloat(GetEnv("loan.penalty_daily_rate", "0.1"), 64)
+	if err != nil {
+		penaltyDailyRate = 0.1
+	}
+
+	maxDebtToIncome, err := strconv.ParseFloat(GetEnv("loan.max_debt_to_income", "0.5"), 64)
+	if err != nil {
+		maxDebtToIncome = 0.5
+	}
+
+	defaultAfterDays, err := strconv.Atoi(GetEnv("loan.default_after_days", "90"))
+	if err != nil {
+		defaultAfterDays = 90
+	}
+
+	return LoanConfig{
+		PenaltyDailyRate: penaltyDailyRate,
+		MaxDebtToIncome:  maxDebtToIncome,
+		DefaultAfterDays: defaultAfterDays,
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import "strconv"
+
+type OverdraftConfig struct {
+	// MaxLimit is the largest overdraft a customer may opt in to, in kopecks
+	MaxLimit int64
+	// InterestRate is the interest on the overdrawn amount, percent per year
+	InterestRate float64
+}
+
+func LoadOverdraftConfig() OverdraftConfig {
+	maxLimit, err := strconv.ParseInt(GetEnv("overdraft.max_limit", "5000000"), 10, 64)
+	if err != nil || maxLimit < 0 {
+		maxLimit = 5000000
+	}
+
+	interestRate, err := strconv.ParseFloat(GetEnv("overdraft.interest_rate", "25"), 64)
+	if err != nil || interestRate < 0 {
+		interestRate = 25
+	}
+
+	return OverdraftConfig{
+		MaxLimit:     maxLimit,
+		InterestRate: interestRate,
+	}
+}
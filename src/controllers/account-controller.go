@@ -4,29 +4,62 @@ import (
 	"bank-system/src/entities"
 	"bank-system/src/services"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
 type AccountController struct {
-	accountService services.AccountService
-	logger         *logrus.Logger
+	accountService   services.AccountService
+	statementService services.StatementService
+	logger           *logrus.Logger
 }
 
-func NewAccountController(accountService services.AccountService, logger *logrus.Logger) *AccountController {
+func NewAccountController(
+	accountService services.AccountService,
+	statementService services.StatementService,
+	logger *logrus.Logger,
+) *AccountController {
 	return &AccountController{
-		accountService: accountService,
-		logger:         logger,
+		accountService:   accountService,
+		statementService: statementService,
+		logger:           logger,
 	}
 }
 
 func (this *AccountController) Create(w http.ResponseWriter, r *http.Request) {
+	var data entities.CreateAccountDto
+
+	// The body is optional, an empty one opens a ruble account
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
 	userId := r.Context().Value("userId").(string)
 
-	accountId, err := this.accountService.Create(r.Context(), userId)
+	accountId, err := this.accountService.Create(r.Context(), userId, data)
 
 	if err != nil {
 		http.Error(
@@ -112,8 +145,9 @@ func (this *AccountController) UpdateBalance(w http.ResponseWriter, r *http.Requ
 		http.Error(
 			w,
 			fmt.Errorf("Failed to update balance: %v", err).Error(),
-			http.StatusInternalServerError,
+			errorStatus(err),
 		)
+		return
 	}
 
 	json.NewEncoder(w).Encode(map[string]string{
@@ -121,13 +155,101 @@ func (this *AccountController) UpdateBalance(w http.ResponseWriter, r *http.Requ
 	})
 }
 
-func (this *AccountController) Delete(w http.ResponseWriter, r *http.Request) {
-	accountId, err := this.accountService.Delete(r.Context(), mux.Vars(r)["id"])
+func (this *AccountController) UpdateOverdraft(w http.ResponseWriter, r *http.Request) {
+	var data entities.UpdateOverdraftDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	account, err := this.accountService.UpdateOverdraft(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to update overdraft: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(account)
+}
+
+func (this *AccountController) Freeze(w http.ResponseWriter, r *http.Request) {
+	accountId, err := this.accountService.Freeze(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to freeze account: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"accountId": accountId,
+	})
+}
+
+func (this *AccountController) Unfreeze(w http.ResponseWriter, r *http.Request) {
+	accountId, err := this.accountService.Unfreeze(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to unfreeze account: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"accountId": accountId,
+	})
+}
+
+func (this *AccountController) Close(w http.ResponseWriter, r *http.Request) {
+	accountId, err := this.accountService.Close(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
 
 	if err != nil {
 		http.Error(
 			w,
-			fmt.Errorf("Failed to delete account: %v", err).Error(),
+			fmt.Errorf("Failed to close account: %v", err).Error(),
 			http.StatusInternalServerError,
 		)
 		return
@@ -169,7 +291,7 @@ func (this *AccountController) Transfer(w http.ResponseWriter, r *http.Request)
 		http.Error(
 			w,
 			fmt.Errorf("Failed to transfer money: %v", err).Error(),
-			http.StatusInternalServerError,
+			errorStatus(err),
 		)
 		return
 	}
@@ -178,3 +300,119 @@ func (this *AccountController) Transfer(w http.ResponseWriter, r *http.Request)
 		"transactionId": transactionId,
 	})
 }
+
+func (this *AccountController) Exchange(w http.ResponseWriter, r *http.Request) {
+	var data entities.ExchangeDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to parse request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	userId := r.Context().Value("userId").(string)
+
+	exchange, err := this.accountService.Exchange(r.Context(), userId, data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to exchange money: %v", err).Error(),
+			errorStatus(err),
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(exchange)
+}
+
+// parseStatementPeriod reads the from and to dates (YYYY-MM-DD, both
+// inclusive) of a statement, defaulting to the current month up to today.
+func parseStatementPeriod(r *http.Request) (int64, int64, error) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return from.Unix(), to.AddDate(0, 0, 1).Unix(), nil
+}
+
+func (this *AccountController) GetStatement(w http.ResponseWriter, r *http.Request) {
+	accountId := mux.Vars(r)["id"]
+	userId := r.Context().Value("userId").(string)
+
+	from, to, err := parseStatementPeriod(r)
+	if err != nil {
+		this.logger.Errorf("Invalid statement period: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid statement period: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.StatementFormatCSV
+	}
+
+	statement, err := this.statementService.Get(r.Context(), userId, accountId, from, to)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get statement: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	content, contentType, err := this.statementService.Render(statement, format)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to render statement: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	extension := format
+	if format == services.StatementFormatCamt053 {
+		extension = "xml"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="statement-%s.%s"`, accountId, extension),
+	)
+	w.Write(content)
+}
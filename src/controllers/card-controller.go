@@ -4,9 +4,12 @@ import (
 	"bank-system/src/entities"
 	"bank-system/src/services"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
@@ -98,6 +101,152 @@ func (this *CardController) GetInfo(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(card)
 }
 
+func (this *CardController) GetAll(w http.ResponseWriter, r *http.Request) {
+	cards, err := this.cardService.GetAll(r.Context(), r.Context().Value("userId").(string))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get cards: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cards)
+}
+
+func (this *CardController) Block(w http.ResponseWriter, r *http.Request) {
+	cardId, err := this.cardService.Block(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to block card: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cardId)
+}
+
+func (this *CardController) Unblock(w http.ResponseWriter, r *http.Request) {
+	cardId, err := this.cardService.Unblock(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to unblock card: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cardId)
+}
+
+func (this *CardController) Close(w http.ResponseWriter, r *http.Request) {
+	cardId, err := this.cardService.Close(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to close card: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cardId)
+}
+
+func (this *CardController) Reissue(w http.ResponseWriter, r *http.Request) {
+	card, err := this.cardService.Reissue(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to reissue card: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(card)
+}
+
+func (this *CardController) GetControls(w http.ResponseWriter, r *http.Request) {
+	controls, err := this.cardService.GetControls(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get card controls: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(controls)
+}
+
+func (this *CardController) UpdateControls(w http.ResponseWriter, r *http.Request) {
+	var data entities.CardControls
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	controls, err := this.cardService.UpdateControls(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to update card controls: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(controls)
+}
+
 func (this *CardController) Pay(w http.ResponseWriter, r *http.Request) {
 	var data entities.PayCardDto
 
@@ -129,7 +278,7 @@ func (this *CardController) Pay(w http.ResponseWriter, r *http.Request) {
 		http.Error(
 			w,
 			fmt.Errorf("Failed to pay: %v", err).Error(),
-			http.StatusInternalServerError,
+			errorStatus(err),
 		)
 		return
 	}
@@ -138,3 +287,133 @@ func (this *CardController) Pay(w http.ResponseWriter, r *http.Request) {
 		"transactionId": transactionId,
 	})
 }
+
+func (this *CardController) Authorize(w http.ResponseWriter, r *http.Request) {
+	var data entities.AuthorizeCardDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	hold, err := this.cardService.Authorize(r.Context(), r.Context().Value("userId").(string), data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to authorize payment: %v", err).Error(),
+			errorStatus(err),
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hold)
+}
+
+func (this *CardController) GetHolds(w http.ResponseWriter, r *http.Request) {
+	holds, err := this.cardService.GetHolds(r.Context(), r.Context().Value("userId").(string))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get holds: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(holds)
+}
+
+func (this *CardController) GetHold(w http.ResponseWriter, r *http.Request) {
+	hold, err := this.cardService.GetHold(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get hold: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hold)
+}
+
+func (this *CardController) Capture(w http.ResponseWriter, r *http.Request) {
+	var data entities.CaptureHoldDto
+
+	// The body is optional, without it the whole hold is captured
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	hold, err := this.cardService.Capture(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to capture hold: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hold)
+}
+
+func (this *CardController) Void(w http.ResponseWriter, r *http.Request) {
+	hold, err := this.cardService.Void(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to void hold: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(hold)
+}
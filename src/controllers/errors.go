@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"bank-system/src/services"
+	"errors"
+	"net/http"
+)
+
+// errorStatus is the status of a failed request that moves money. A request
+// already processed under its idempotency key is a conflict rather than a
+// server error, so the response is stored for the key and replayed.
+func errorStatus(err error) int {
+	if errors.Is(err, services.ErrRequestProcessed) {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
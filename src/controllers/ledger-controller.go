@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"bank-system/src/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerController struct {
+	ledgerService services.LedgerService
+	logger        *logrus.Logger
+}
+
+func NewLedgerController(ledgerService services.LedgerService, logger *logrus.Logger) *LedgerController {
+	return &LedgerController{
+		ledgerService: ledgerService,
+		logger:        logger,
+	}
+}
+
+func (this *LedgerController) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := this.ledgerService.GetAccounts(r.Context())
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get ledger accounts: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(accounts)
+}
+
+func (this *LedgerController) GetTrialBalance(w http.ResponseWriter, r *http.Request) {
+	trialBalances, err := this.ledgerService.GetTrialBalance(r.Context())
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get trial balance: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(trialBalances)
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanApplicationController struct {
+	loanApplicationService services.LoanApplicationService
+	logger                 *logrus.Logger
+}
+
+func NewLoanApplicationController(loanApplicationService services.LoanApplicationService, logger *logrus.Logger) *LoanApplicationController {
+	return &LoanApplicationController{
+		loanApplicationService: loanApplicationService,
+		logger:                 logger,
+	}
+}
+
+func (this *LoanApplicationController) Submit(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanApplyDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	userId := r.Context().Value("userId").(string)
+	application, err := this.loanApplicationService.Submit(r.Context(), userId, data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to submit loan application: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	json.NewEncoder(w).Encode(application)
+}
+
+func (this *LoanApplicationController) GetMine(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(string)
+	applications, err := this.loanApplicationService.GetByUserId(r.Context(), userId)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan applications: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(applications)
+}
+
+func (this *LoanApplicationController) Cancel(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(string)
+	application, err := this.loanApplicationService.Cancel(r.Context(), userId, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to cancel loan application: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(application)
+}
+
+// GetAll returns applications of all users, optionally filtered by the status query parameter.
+func (this *LoanApplicationController) GetAll(w http.ResponseWriter, r *http.Request) {
+	applications, err := this.loanApplicationService.GetAll(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan applications: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(applications)
+}
+
+func (this *LoanApplicationController) Approve(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanApplicationApproveDto
+
+	// The body is optional, an empty one approves the default amount
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	adminId := r.Context().Value("userId").(string)
+	application, err := this.loanApplicationService.Approve(r.Context(), adminId, mux.Vars(r)["id"], data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to approve loan application: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(application)
+}
+
+func (this *LoanApplicationController) Reject(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanApplicationRejectDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	adminId := r.Context().Value("userId").(string)
+	application, err := this.loanApplicationService.Reject(r.Context(), adminId, mux.Vars(r)["id"], data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to reject loan application: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(application)
+}
@@ -23,8 +23,60 @@ func NewLoanController(loanService services.LoanService, logger *logrus.Logger)
 	}
 }
 
-func (this *LoanController) Apply(w http.ResponseWriter, r *http.Request) {
-	var data entities.LoanApplyDto
+func (this *LoanController) GetAll(w http.ResponseWriter, r *http.Request) {
+	loans, err := this.loanService.GetAll(r.Context(), r.Context().Value("userId").(string))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loans: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(loans)
+}
+
+func (this *LoanController) GetById(w http.ResponseWriter, r *http.Request) {
+	loan, err := this.loanService.GetById(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(loan)
+}
+
+func (this *LoanController) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	payments, err := this.loanService.GetSchedule(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+
+	if err != nil {
+		this.logger.Errorf("Failed to get loan schedule: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan schedule: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(payments)
+}
+
+func (this *LoanController) Prepay(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanPrepayDto
 
 	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
@@ -48,34 +100,57 @@ func (this *LoanController) Apply(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userId := r.Context().Value("userId").(string)
-	loan, err := this.loanService.Apply(r.Context(), userId, data)
+
+	loan, err := this.loanService.Prepay(r.Context(), userId, mux.Vars(r)["id"], data)
 	if err != nil {
 		http.Error(
 			w,
-			fmt.Errorf("Failed to apply loan: %v", err).Error(),
-			http.StatusInternalServerError,
+			fmt.Errorf("Failed to prepay loan: %v", err).Error(),
+			errorStatus(err),
 		)
 		return
 	}
+
 	json.NewEncoder(w).Encode(loan)
 }
 
-func (this *LoanController) GetSchedule(w http.ResponseWriter, r *http.Request) {
-	payments, err := this.loanService.GetSchedule(
-		r.Context(),
-		r.Context().Value("userId").(string),
-		mux.Vars(r)["id"],
-	)
+func (this *LoanController) Pay(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanPayDto
 
+	err := json.NewDecoder(r.Body).Decode(&data)
 	if err != nil {
-		this.logger.Errorf("Failed to get loan schedule: %v", err)
+		this.logger.Errorf("Failed to decode request body: %v", err)
 		http.Error(
 			w,
-			fmt.Errorf("Failed to get loan schedule: %v", err).Error(),
-			http.StatusInternalServerError,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
 		)
 		return
 	}
 
-	json.NewEncoder(w).Encode(payments)
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	userId := r.Context().Value("userId").(string)
+
+	transactionId, err := this.loanService.Pay(r.Context(), userId, mux.Vars(r)["id"], data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to pay loan: %v", err).Error(),
+			errorStatus(err),
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"transactionId": transactionId,
+	})
 }
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanProductController struct {
+	loanProductService services.LoanProductService
+	logger             *logrus.Logger
+}
+
+func NewLoanProductController(loanProductService services.LoanProductService, logger *logrus.Logger) *LoanProductController {
+	return &LoanProductController{
+		loanProductService: loanProductService,
+		logger:             logger,
+	}
+}
+
+func (this *LoanProductController) Create(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanProductDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	product, err := this.loanProductService.Create(r.Context(), data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to create loan product: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(product)
+}
+
+// GetAll returns every product including inactive ones, for administrators.
+func (this *LoanProductController) GetAll(w http.ResponseWriter, r *http.Request) {
+	products, err := this.loanProductService.GetAll(r.Context(), false)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan products: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(products)
+}
+
+// GetActive returns the products customers can apply for.
+func (this *LoanProductController) GetActive(w http.ResponseWriter, r *http.Request) {
+	products, err := this.loanProductService.GetAll(r.Context(), true)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan products: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(products)
+}
+
+func (this *LoanProductController) GetById(w http.ResponseWriter, r *http.Request) {
+	product, err := this.loanProductService.GetById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan product: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(product)
+}
+
+func (this *LoanProductController) Update(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanProductDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	product, err := this.loanProductService.Update(r.Context(), mux.Vars(r)["id"], data)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to update loan product: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(product)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanRestructuringController struct {
+	loanRestructuringService services.LoanRestructuringService
+	logger                   *logrus.Logger
+}
+
+func NewLoanRestructuringController(loanRestructuringService services.LoanRestructuringService, logger *logrus.Logger) *LoanRestructuringController {
+	return &LoanRestructuringController{
+		loanRestructuringService: loanRestructuringService,
+		logger:                   logger,
+	}
+}
+
+func (this *LoanRestructuringController) Request(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanRestructuringDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	restructuring, err := this.loanRestructuringService.Request(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to request loan restructuring: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(restructuring)
+}
+
+func (this *LoanRestructuringController) GetByLoanId(w http.ResponseWriter, r *http.Request) {
+	restructurings, err := this.loanRestructuringService.GetByLoanId(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan restructurings: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(restructurings)
+}
+
+func (this *LoanRestructuringController) GetScheduleHistory(w http.ResponseWriter, r *http.Request) {
+	payments, err := this.loanRestructuringService.GetScheduleHistory(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get payment history: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(payments)
+}
+
+// GetAll returns restructurings of all loans, optionally filtered by the status query parameter.
+func (this *LoanRestructuringController) GetAll(w http.ResponseWriter, r *http.Request) {
+	restructurings, err := this.loanRestructuringService.GetAll(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get loan restructurings: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(restructurings)
+}
+
+func (this *LoanRestructuringController) Approve(w http.ResponseWriter, r *http.Request) {
+	loan, err := this.loanRestructuringService.Approve(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to approve loan restructuring: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(loan)
+}
+
+func (this *LoanRestructuringController) Reject(w http.ResponseWriter, r *http.Request) {
+	var data entities.LoanRestructuringRejectDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	restructuring, err := this.loanRestructuringService.Reject(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to reject loan restructuring: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(restructuring)
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type StandingOrderController struct {
+	standingOrderService services.StandingOrderService
+	logger               *logrus.Logger
+}
+
+func NewStandingOrderController(standingOrderService services.StandingOrderService, logger *logrus.Logger) *StandingOrderController {
+	return &StandingOrderController{
+		standingOrderService: standingOrderService,
+		logger:               logger,
+	}
+}
+
+func (this *StandingOrderController) Create(w http.ResponseWriter, r *http.Request) {
+	var data entities.CreateStandingOrderDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	order, err := this.standingOrderService.Create(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to create standing order: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (this *StandingOrderController) GetAll(w http.ResponseWriter, r *http.Request) {
+	orders, err := this.standingOrderService.GetAll(r.Context(), r.Context().Value("userId").(string))
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get standing orders: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (this *StandingOrderController) GetById(w http.ResponseWriter, r *http.Request) {
+	order, err := this.standingOrderService.GetById(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get standing order: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (this *StandingOrderController) Update(w http.ResponseWriter, r *http.Request) {
+	var data entities.UpdateStandingOrderDto
+
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		this.logger.Errorf("Failed to decode request body: %v", err)
+		http.Error(
+			w,
+			fmt.Errorf("Failed to decode request body: %v", err).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if !data.IsValid() {
+		this.logger.Errorf("Invalid request body: %v", data)
+		http.Error(
+			w,
+			fmt.Errorf("Invalid request body: %v", data).Error(),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	order, err := this.standingOrderService.Update(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+		data,
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to update standing order: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (this *StandingOrderController) Cancel(w http.ResponseWriter, r *http.Request) {
+	order, err := this.standingOrderService.Cancel(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to cancel standing order: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (this *StandingOrderController) GetRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := this.standingOrderService.GetRuns(
+		r.Context(),
+		r.Context().Value("userId").(string),
+		mux.Vars(r)["id"],
+	)
+	if err != nil {
+		http.Error(
+			w,
+			fmt.Errorf("Failed to get standing order runs: %v", err).Error(),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+
+	json.NewEncoder(w).Encode(runs)
+}
@@ -4,11 +4,24 @@ import (
 	"bank-system/config"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
 )
 
+// execAll runs the statements in order and stops at the first error.
+func execAll(db *pgxpool.Pool, ctx context.Context, statements ...string) error {
+	for _, statement := range statements {
+		_, err := db.Exec(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func createUserTable(db *pgxpool.Pool, ctx context.Context) error {
 	_, err := db.Exec(
 		ctx,
@@ -16,11 +29,20 @@ func createUserTable(db *pgxpool.Pool, ctx context.Context) error {
 			id varchar(100) primary key,
 			username varchar(50) not null unique,
 			password varchar(255) not null,
-			email varchar(50) not null unique
+			email varchar(50) not null unique,
+			role varchar(50) not null default 'user' check (role in ('user', 'admin'))
 		)`,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Columns added since the table was created, for existing databases
+	return execAll(
+		db,
+		ctx,
+		"alter table users add column if not exists role varchar(50) not null default 'user' check (role in ('user', 'admin'))",
+	)
 }
 
 func createTransactionTable(db *pgxpool.Pool, ctx context.Context) error {
@@ -29,13 +51,121 @@ func createTransactionTable(db *pgxpool.Pool, ctx context.Context) error {
 		`create table if not exists transactions (
 			id varchar(100) primary key,
 			amount bigint not null,
+			currency varchar(3) not null default 'RUB',
 			from_id varchar(100),
 			to_id varchar(100),
-			type varchar(50) not null check (type in ('deposit', 'payment', 'transfer', 'withdrawal')),
+			type varchar(50) not null check (type in ('deposit', 'payment', 'transfer', 'withdrawal', 'loan', 'loan_repayment', 'loan_prepayment', 'exchange', 'overdraft_interest')),
+			description varchar(255) not null,
+			created_at bigint not null,
+			linked_id varchar(100),
+			card_id varchar(100)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Columns and types added since the table was created, for existing
+	// databases. Existing rows have one of the earlier types, so the type
+	// check is not validated against them again on every start
+	err = execAll(
+		db,
+		ctx,
+		"alter table transactions add column if not exists currency varchar(3) not null default 'RUB'",
+		"alter table transactions add column if not exists linked_id varchar(100)",
+		"alter table transactions add column if not exists card_id varchar(100)",
+		`alter table transactions drop constraint if exists transactions_type_check,
+			add constraint transactions_type_check check (type in ('deposit', 'payment', 'transfer', 'withdrawal', 'loan', 'loan_repayment', 'loan_prepayment', 'exchange', 'overdraft_interest')) not valid`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		"create index if not exists transactions_card_id_idx on transactions (card_id, created_at) where card_id is not null",
+	)
+
+	return err
+}
+
+func createLedgerTables(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists ledger_accounts (
+			id varchar(100) primary key,
+			name varchar(100) not null,
+			normal_side varchar(10) not null check (normal_side in ('debit', 'credit'))
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`insert into ledger_accounts (id, name, normal_side) values
+			('bank_cash', 'Cash', 'debit'),
+			('bank_loans', 'Loans issued', 'debit'),
+			('bank_interest_income', 'Interest income', 'credit'),
+			('bank_penalty_income', 'Penalty income', 'credit'),
+			('bank_fee_income', 'Fee income', 'credit'),
+			('bank_fx', 'Currency exchange position', 'debit'),
+			('bank_fx_income', 'Currency exchange income', 'credit')
+		on conflict (id) do nothing`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`create table if not exists ledger_balances (
+			account_id varchar(100) not null references ledger_accounts(id),
+			currency varchar(3) not null,
+			balance bigint not null default 0,
+			primary key (account_id, currency)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`create table if not exists journal_entries (
+			id varchar(100) primary key,
+			transaction_id varchar(100) references transactions(id) on delete cascade,
+			currency varchar(3) not null,
 			description varchar(255) not null,
 			created_at bigint not null
 		)`,
 	)
+	if err != nil {
+		return err
+	}
+
+	// Entries posted before multi-currency accounts were in roubles
+	_, err = db.Exec(ctx, "alter table journal_entries add column if not exists currency varchar(3) not null default 'RUB'")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`create table if not exists postings (
+			id bigserial primary key,
+			entry_id varchar(100) not null references journal_entries(id) on delete cascade,
+			account_id varchar(100) not null,
+			side varchar(10) not null check (side in ('debit', 'credit')),
+			amount bigint not null check (amount > 0)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "create index if not exists postings_account_id_idx on postings (account_id)")
 
 	return err
 }
@@ -46,12 +176,37 @@ func createAccountTable(db *pgxpool.Pool, ctx context.Context) error {
 		`create table if not exists accounts (
 			id varchar(100) primary key,
 			balance bigint not null,
+			currency varchar(3) not null default 'RUB',
 			user_id varchar(100) not null references users(id) on delete cascade,
-			created_at bigint not null
+			status varchar(20) not null default 'active' check (status in ('active', 'frozen', 'closed')),
+			held_amount bigint not null default 0 check (held_amount >= 0),
+			overdraft_limit bigint not null default 0 check (overdraft_limit >= 0),
+			overdraft_rate double precision not null default 0,
+			overdraft_accrued_at bigint,
+			created_at bigint not null,
+			closed_at bigint
 		)`,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Columns added since the table was created, for existing databases
+	return execAll(
+		db,
+		ctx,
+		"alter table accounts add column if not exists currency varchar(3) not null default 'RUB'",
+		"alter table accounts add column if not exists status varchar(20) not null default 'active' check (status in ('active', 'frozen', 'closed'))",
+		"alter table accounts add column if not exists held_amount bigint not null default 0 check (held_amount >= 0)",
+		"alter table accounts add column if not exists overdraft_limit bigint not null default 0 check (overdraft_limit >= 0)",
+		"alter table accounts add column if not exists overdraft_rate double precision not null default 0",
+		"alter table accounts add column if not exists overdraft_accrued_at bigint",
+		"alter table accounts add column if not exists closed_at bigint",
+		// Interest on accounts overdrawn before the start of the overdraft was
+		// recorded accrues from now on
+		`update accounts set overdraft_accrued_at = extract(epoch from now())::bigint
+		where balance < 0 and overdraft_accrued_at is null`,
+	)
 }
 
 func createCardTable(db *pgxpool.Pool, ctx context.Context) error {
@@ -60,15 +215,50 @@ func createCardTable(db *pgxpool.Pool, ctx context.Context) error {
 		`create table if not exists cards (
 			id varchar(100) primary key,
 			number bytea not null unique,
+			number_hash varchar(64) unique,
 			expiration bytea not null,
 			cvv varchar(255) not null,
+			data_key bytea,
+			key_id varchar(100),
+			last4 varchar(4),
 			user_id varchar(100) not null references users(id) on delete cascade,
 			account_id varchar(100) not null references accounts(id) on delete cascade,
-			created_at bigint not null
+			status varchar(20) not null default 'active' check (status in ('active', 'blocked', 'closed')),
+			reissued_from varchar(100) references cards(id),
+			single_limit bigint not null default 0 check (single_limit >= 0),
+			daily_limit bigint not null default 0 check (daily_limit >= 0),
+			monthly_limit bigint not null default 0 check (monthly_limit >= 0),
+			online_enabled boolean not null default true,
+			blocked_mccs varchar(4)[] not null default '{}',
+			created_at bigint not null,
+			closed_at bigint
 		)`,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Columns added since the table was created, for existing databases. The
+	// number index and last digits of existing cards cannot be filled in here,
+	// their numbers are encrypted with keys of the clients, so the cards of a
+	// user are indexed on their first payment by card number, and cards without
+	// a data key are re-encrypted with one when they are next decrypted.
+	return execAll(
+		db,
+		ctx,
+		"alter table cards add column if not exists number_hash varchar(64) unique",
+		"alter table cards add column if not exists data_key bytea",
+		"alter table cards add column if not exists key_id varchar(100)",
+		"alter table cards add column if not exists last4 varchar(4)",
+		"alter table cards add column if not exists status varchar(20) not null default 'active' check (status in ('active', 'blocked', 'closed'))",
+		"alter table cards add column if not exists reissued_from varchar(100) references cards(id)",
+		"alter table cards add column if not exists single_limit bigint not null default 0 check (single_limit >= 0)",
+		"alter table cards add column if not exists daily_limit bigint not null default 0 check (daily_limit >= 0)",
+		"alter table cards add column if not exists monthly_limit bigint not null default 0 check (monthly_limit >= 0)",
+		"alter table cards add column if not exists online_enabled boolean not null default true",
+		"alter table cards add column if not exists blocked_mccs varchar(4)[] not null default '{}'",
+		"alter table cards add column if not exists closed_at bigint",
+	)
 }
 
 func createPaymentTable(db *pgxpool.Pool, ctx context.Context) error {
@@ -82,8 +272,53 @@ func createPaymentTable(db *pgxpool.Pool, ctx context.Context) error {
 			due_date bigint not null,
 			principal_part bigint not null,
 			interest_part bigint not null,
+			principal_paid bigint not null default 0,
+			interest_paid bigint not null default 0,
+			penalty_part bigint not null default 0,
+			penalty_paid bigint not null default 0,
+			penalty_accrued_at bigint,
 			status varchar(50) not null check (status in ('new', 'paid', 'overdue')),
-			is_paid boolean not null
+			is_paid boolean not null,
+			debit_attempts int not null default 0,
+			next_debit_at bigint
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Columns added since the table was created, for existing databases.
+	// Payments settled before the paid parts were tracked were paid in full.
+	return execAll(
+		db,
+		ctx,
+		"alter table payments add column if not exists principal_paid bigint not null default 0",
+		"alter table payments add column if not exists interest_paid bigint not null default 0",
+		"alter table payments add column if not exists penalty_part bigint not null default 0",
+		"alter table payments add column if not exists penalty_paid bigint not null default 0",
+		"alter table payments add column if not exists penalty_accrued_at bigint",
+		"alter table payments add column if not exists debit_attempts int not null default 0",
+		"alter table payments add column if not exists next_debit_at bigint",
+		`update payments set principal_paid = principal_part, interest_paid = interest_part
+		where is_paid = true and principal_paid = 0 and interest_paid = 0`,
+	)
+}
+
+func createLoanProductTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists loan_products (
+			id varchar(100) primary key,
+			name varchar(100) not null,
+			rate_type varchar(50) not null check (rate_type in ('fixed', 'floating')),
+			rate double precision not null,
+			margin double precision not null,
+			min_amount bigint not null,
+			max_amount bigint not null,
+			terms int[] not null,
+			fee bigint not null,
+			is_active boolean not null,
+			created_at bigint not null
 		)`,
 	)
 
@@ -101,14 +336,274 @@ func createLoanTable(db *pgxpool.Pool, ctx context.Context) error {
 			interest_rate double precision not null,
 			term int not null,
 			start_date bigint not null,
-			debt bigint not null
+			debt bigint not null,
+			schedule_type varchar(50) not null default 'annuity' check (schedule_type in ('annuity', 'differentiated')),
+			product_id varchar(100) references loan_products(id)
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Columns added since the table was created, for existing databases
+	return execAll(
+		db,
+		ctx,
+		"alter table loans add column if not exists schedule_type varchar(50) not null default 'annuity' check (schedule_type in ('annuity', 'differentiated'))",
+		"alter table loans add column if not exists product_id varchar(100) references loan_products(id)",
+	)
+}
+
+func createLoanApplicationTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists loan_applications (
+			id varchar(100) primary key,
+			user_id varchar(100) not null references users(id) on delete cascade,
+			account_id varchar(100) not null references accounts(id) on delete cascade,
+			product_id varchar(100) not null references loan_products(id),
+			amount bigint not null,
+			term int not null,
+			schedule_type varchar(50) not null,
+			status varchar(50) not null check (status in ('submitted', 'under_review', 'approved', 'rejected', 'disbursed', 'cancelled')),
+			scoring_decision varchar(50) check (scoring_decision in ('approved', 'rejected', 'counter_offer')),
+			reasons text[] not null,
+			offered_amount bigint not null default 0,
+			monthly_income bigint not null default 0,
+			debt_to_income double precision not null default 0,
+			approved_amount bigint not null default 0,
+			reviewed_by varchar(100) references users(id) on delete set null,
+			loan_id varchar(100) references loans(id) on delete set null,
+			created_at bigint not null,
+			updated_at bigint not null
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Before the review workflow the scoring decision was the status of the
+	// application and approved applications were disbursed right away
+	return execAll(
+		db,
+		ctx,
+		"alter table loan_applications drop constraint if exists loan_applications_status_check",
+		"alter table loan_applications add column if not exists scoring_decision varchar(50) check (scoring_decision in ('approved', 'rejected', 'counter_offer'))",
+		"alter table loan_applications add column if not exists approved_amount bigint not null default 0",
+		"alter table loan_applications add column if not exists reviewed_by varchar(100) references users(id) on delete set null",
+		"alter table loan_applications add column if not exists updated_at bigint",
+		`update loan_applications set
+				scoring_decision = status,
+				status = case
+					when status = 'approved' and loan_id is not null then 'disbursed'
+					when status = 'counter_offer' then 'under_review'
+					else status
+				end,
+				approved_amount = case when status = 'approved' and loan_id is not null then amount else 0 end
+		where scoring_decision is null and status in ('approved', 'rejected', 'counter_offer')`,
+		"update loan_applications set updated_at = created_at where updated_at is null",
+		"alter table loan_applications alter column updated_at set not null",
+		"alter table loan_applications alter column offered_amount set default 0",
+		"alter table loan_applications alter column monthly_income set default 0",
+		"alter table loan_applications alter column debt_to_income set default 0",
+		`alter table loan_applications add constraint loan_applications_status_check
+			check (status in ('submitted', 'under_review', 'approved', 'rejected', 'disbursed', 'cancelled'))`,
+	)
+}
+
+func createKeyRateTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists key_rates (
+			id varchar(100) primary key,
+			rate double precision not null,
+			fetched_at bigint not null
 		)`,
 	)
 
 	return err
 }
 
-func createTables(db *pgxpool.Pool, ctx context.Context) error {
+func createExchangeRateTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists exchange_rates (
+			currency varchar(3) not null,
+			rate double precision not null,
+			fetched_at bigint not null,
+			primary key (currency, fetched_at)
+		)`,
+	)
+
+	return err
+}
+
+func createLoanRestructuringTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists loan_restructurings (
+			id varchar(100) primary key,
+			loan_id varchar(100) not null references loans(id) on delete cascade,
+			user_id varchar(100) not null references users(id) on delete cascade,
+			extra_term int not null default 0,
+			grace_months int not null default 0,
+			new_rate double precision,
+			reason text not null,
+			status varchar(50) not null check (status in ('pending', 'approved', 'rejected')),
+			review_comment text,
+			reviewed_by varchar(100) references users(id) on delete set null,
+			created_at bigint not null,
+			updated_at bigint not null
+		)`,
+	)
+
+	return err
+}
+
+func createPaymentHistoryTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists payment_history (
+			id varchar(100) primary key,
+			loan_id varchar(100) not null references loans(id) on delete cascade,
+			restructuring_id varchar(100) not null references loan_restructurings(id) on delete cascade,
+			amount bigint not null,
+			date bigint,
+			due_date bigint not null,
+			principal_part bigint not null,
+			interest_part bigint not null,
+			principal_paid bigint not null,
+			interest_paid bigint not null,
+			penalty_part bigint not null,
+			penalty_paid bigint not null,
+			status varchar(50) not null,
+			archived_at bigint not null
+		)`,
+	)
+
+	return err
+}
+
+func createIdempotencyKeyTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists idempotency_keys (
+			user_id varchar(100) not null references users(id) on delete cascade,
+			key varchar(255) not null,
+			request_hash varchar(64) not null,
+			status varchar(50) not null check (status in ('pending', 'completed')),
+			status_code int,
+			content_type varchar(255),
+			response bytea,
+			created_at bigint not null,
+			completed_at bigint,
+			primary key (user_id, key)
+		)`,
+	)
+
+	return err
+}
+
+func createStandingOrderTables(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists standing_orders (
+			id varchar(100) primary key,
+			user_id varchar(100) not null references users(id) on delete cascade,
+			from_account_id varchar(100) not null references accounts(id) on delete cascade,
+			to_account_id varchar(100) not null references accounts(id) on delete cascade,
+			amount bigint not null check (amount > 0),
+			description varchar(255) not null,
+			convert_currency boolean not null default false,
+			frequency varchar(20) not null check (frequency in ('daily', 'weekly', 'monthly')),
+			interval_count int not null default 1 check (interval_count > 0),
+			start_date bigint not null,
+			end_date bigint,
+			next_run_at bigint not null,
+			status varchar(20) not null check (status in ('active', 'paused', 'completed', 'cancelled')),
+			failed_attempts int not null default 0,
+			last_run_at bigint,
+			last_error text,
+			claimed_until bigint,
+			created_at bigint not null,
+			updated_at bigint not null
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, "alter table standing_orders add column if not exists claimed_until bigint")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		"create index if not exists standing_orders_next_run_at_idx on standing_orders (next_run_at) where status = 'active'",
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		`create table if not exists standing_order_runs (
+			id varchar(100) primary key,
+			order_id varchar(100) not null references standing_orders(id) on delete cascade,
+			transaction_id varchar(100) references transactions(id) on delete set null,
+			status varchar(20) not null check (status in ('succeeded', 'failed')),
+			error text,
+			scheduled_at bigint not null,
+			run_at bigint not null
+		)`,
+	)
+
+	return err
+}
+
+func createHoldTable(db *pgxpool.Pool, ctx context.Context) error {
+	_, err := db.Exec(
+		ctx,
+		`create table if not exists holds (
+			id varchar(100) primary key,
+			card_id varchar(100) not null references cards(id) on delete cascade,
+			account_id varchar(100) not null references accounts(id) on delete cascade,
+			user_id varchar(100) not null references users(id) on delete cascade,
+			amount bigint not null check (amount > 0),
+			captured_amount bigint not null default 0 check (captured_amount >= 0 and captured_amount <= amount),
+			currency varchar(3) not null,
+			description varchar(255) not null,
+			status varchar(20) not null check (status in ('authorized', 'captured', 'voided', 'expired')),
+			transaction_id varchar(100) references transactions(id) on delete set null,
+			expires_at bigint not null,
+			created_at bigint not null,
+			updated_at bigint not null
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		"create index if not exists holds_expires_at_idx on holds (expires_at) where status = 'authorized'",
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		ctx,
+		"create index if not exists holds_card_id_idx on holds (card_id, created_at) where status = 'authorized'",
+	)
+
+	return err
+}
+
+// CreateTables creates the tables missing in the database, e.g. for tests
+// running against their own database.
+func CreateTables(db *pgxpool.Pool, ctx context.Context) error {
 	err := createUserTable(db, ctx)
 	if err != nil {
 		return err
@@ -119,6 +614,11 @@ func createTables(db *pgxpool.Pool, ctx context.Context) error {
 		return err
 	}
 
+	err = createLedgerTables(db, ctx)
+	if err != nil {
+		return err
+	}
+
 	err = createAccountTable(db, ctx)
 	if err != nil {
 		return err
@@ -129,7 +629,7 @@ func createTables(db *pgxpool.Pool, ctx context.Context) error {
 		return err
 	}
 
-	err = createPaymentTable(db, ctx)
+	err = createLoanProductTable(db, ctx)
 	if err != nil {
 		return err
 	}
@@ -139,9 +639,157 @@ func createTables(db *pgxpool.Pool, ctx context.Context) error {
 		return err
 	}
 
+	err = createPaymentTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createLoanApplicationTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createKeyRateTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createExchangeRateTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createLoanRestructuringTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createPaymentHistoryTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createIdempotencyKeyTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createStandingOrderTables(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = createHoldTable(db, ctx)
+	if err != nil {
+		return err
+	}
+
+	err = openLedger(db, ctx)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// openLedger posts the balances of the accounts and the debt of the loans of
+// a database created before the ledger as one opening entry against cash, so
+// that postings agree with the balances. It does nothing once anything has
+// been posted.
+func openLedger(db *pgxpool.Pool, ctx context.Context) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var posted bool
+	err = tx.QueryRow(ctx, "select exists (select 1 from journal_entries)").Scan(&posted)
+	if err != nil {
+		return err
+	}
+
+	var deposits, debt int64
+	err = tx.QueryRow(
+		ctx,
+		"select coalesce((select sum(balance) from accounts), 0), coalesce((select sum(debt) from loans), 0)",
+	).Scan(&deposits, &debt)
+	if err != nil {
+		return err
+	}
+
+	if posted || (deposits == 0 && debt == 0) {
+		return nil
+	}
+
+	// Accounts opened before the ledger are in roubles
+	_, err = tx.Exec(
+		ctx,
+		"insert into journal_entries (id, currency, description, created_at) values ('opening_balances', 'RUB', 'Opening balances', $1)",
+		time.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into postings (entry_id, account_id, side, amount)
+			select 'opening_balances', id, case when balance > 0 then 'credit' else 'debit' end, abs(balance)
+				from accounts
+			where balance <> 0
+			order by id`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Cash balances the entry: it holds the deposits less the loans issued
+	cash := deposits - debt
+	postings := []struct {
+		accountId string
+		side      string
+		amount    int64
+	}{
+		{"bank_loans", "debit", debt},
+		{"bank_cash", "debit", cash},
+	}
+	if cash < 0 {
+		postings[1].side = "credit"
+		postings[1].amount = -cash
+	}
+
+	for _, posting := range postings {
+		if posting.amount == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(
+			ctx,
+			"insert into postings (entry_id, account_id, side, amount) values ('opening_balances', $1, $2, $3)",
+			posting.accountId,
+			posting.side,
+			posting.amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into ledger_balances (account_id, currency, balance) values ('bank_cash', 'RUB', $1), ('bank_loans', 'RUB', $2)
+		on conflict (account_id, currency) do update set balance = ledger_balances.balance + excluded.balance`,
+		cash,
+		debt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func New(ctx context.Context, logger *logrus.Logger) (*pgxpool.Pool, error) {
 	config := config.LoadDBConfig()
 
@@ -165,7 +813,7 @@ func New(ctx context.Context, logger *logrus.Logger) (*pgxpool.Pool, error) {
 		return nil, err
 	}
 
-	err = createTables(db, ctx)
+	err = CreateTables(db, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,47 @@
 package entities
 
 type Account struct {
-	ID        string `db:id json:id`
-	Balance   int64  `db:balance json:balance`
-	UserID    string `db:user_id json:userId`
-	CreatedAt int64  `db:created_at json:createdAt`
+	ID string `db:id json:id`
+	// Balance is the ledger balance, which includes held amounts
+	Balance int64 `db:balance json:balance`
+	// HeldAmount is reserved by card authorizations that are not captured yet
+	HeldAmount int64 `db:held_amount json:heldAmount`
+	// AvailableBalance is the balance less held amounts
+	AvailableBalance int64  `json:availableBalance`
+	Currency         string `db:currency json:currency`
+	UserID           string `db:user_id json:userId`
+	// Status is "active", "frozen" (no debits) or "closed" (no postings)
+	Status string `db:status json:status`
+	// OverdraftLimit is how far below zero the balance may be debited, 0 when overdraft is off
+	OverdraftLimit int64 `db:overdraft_limit json:overdraftLimit`
+	// OverdraftRate is the interest on a negative balance, percent per year
+	OverdraftRate float64 `db:overdraft_rate json:overdraftRate`
+	// OverdraftAccruedAt is when overdraft interest was last charged
+	OverdraftAccruedAt int64 `db:overdraft_accrued_at json:overdraftAccruedAt`
+	CreatedAt          int64 `db:created_at json:createdAt`
+	ClosedAt           int64 `db:closed_at json:closedAt`
+}
+
+type UpdateOverdraftDto struct {
+	// Limit is in minor units of the account currency, 0 turns overdraft off
+	Limit int64 `json:limit`
+}
+
+func (this *UpdateOverdraftDto) IsValid() bool {
+	return this.Limit >= 0
+}
+
+type CreateAccountDto struct {
+	// Currency is an ISO 4217 code, RUB when empty
+	Currency string `json:currency`
+}
+
+func (this *CreateAccountDto) IsValid() bool {
+	if this.Currency != "" && !IsSupportedCurrency(this.Currency) {
+		return false
+	}
+
+	return true
 }
 
 type UpdateAccountBalanceDto struct {
@@ -16,7 +53,7 @@ func (this *UpdateAccountBalanceDto) IsValid() bool {
 	if this.Amount == 0 {
 		return false
 	}
-	if this.Type != "deposit" && this.Type != "withdrawal" && this.Type != "transfer" && this.Type != "payment" && this.Type != "loan" {
+	if this.Type != "deposit" && this.Type != "withdrawal" && this.Type != "payment" {
 		return false
 	}
 
@@ -28,6 +65,8 @@ type TransferDto struct {
 	ToAccountId   string `json:toAccountId`
 	Amount        int64  `json:amount`
 	Description   string `json:description`
+	// Convert allows a transfer between accounts in different currencies
+	Convert bool `json:convert`
 }
 
 func (this *TransferDto) IsValid() bool {
@@ -43,3 +82,38 @@ func (this *TransferDto) IsValid() bool {
 
 	return true
 }
+
+type ExchangeDto struct {
+	FromAccountId string `json:fromAccountId`
+	ToAccountId   string `json:toAccountId`
+	// Amount is debited from FromAccountId, in minor units of its currency
+	Amount int64 `json:amount`
+}
+
+func (this *ExchangeDto) IsValid() bool {
+	if this.FromAccountId == "" || this.ToAccountId == "" {
+		return false
+	}
+	if this.FromAccountId == this.ToAccountId {
+		return false
+	}
+	if this.Amount <= 0 {
+		return false
+	}
+
+	return true
+}
+
+type ExchangeResponseDto struct {
+	DebitTransactionId  string `json:debitTransactionId`
+	CreditTransactionId string `json:creditTransactionId`
+	Amount              int64  `json:amount`
+	Currency            string `json:currency`
+	// ConvertedAmount is credited to the recipient after the spread
+	ConvertedAmount   int64  `json:convertedAmount`
+	ConvertedCurrency string `json:convertedCurrency`
+	// Rate is how many units of ConvertedCurrency were paid for one unit of Currency
+	Rate float64 `json:rate`
+	// Fee is the spread kept by the bank, in minor units of ConvertedCurrency
+	Fee int64 `json:fee`
+}
@@ -1,31 +1,110 @@
 package entities
 
 type Card struct {
-	ID         string `db:id json:id`
-	Number     []byte `db:number json:number`
+	ID     string `db:id json:id`
+	Number []byte `db:number json:number`
+	// NumberHash is the HMAC of the card number, used to find the card by its number
+	NumberHash string `db:number_hash json:numberHash`
 	Expiration []byte `db:expiration json:expiration`
 	CVV        string `db:cvv json:cvv`
-	UserId     string `db:user_id json:userId`
-	AccountID  string `db:account_id json:accountId`
-	CreatedAt  int64  `db:created_at json:createdAt`
+	// DataKey is the key Number and Expiration are encrypted with, wrapped
+	// by the master key KeyId. Both are empty for cards encrypted with a
+	// key supplied by the client.
+	DataKey []byte `db:data_key json:dataKey`
+	KeyId   string `db:key_id json:keyId`
+	// Last4 are the last digits of the number, the only ones shown in card lists
+	Last4     string `db:last4 json:last4`
+	UserId    string `db:user_id json:userId`
+	AccountID string `db:account_id json:accountId`
+	// Status is "active", "blocked" (temporarily, by the owner) or "closed"
+	Status string `db:status json:status`
+	// ReissuedFrom is the card this one replaced
+	ReissuedFrom string `db:reissued_from json:reissuedFrom`
+	Controls     CardControls
+	CreatedAt    int64 `db:created_at json:createdAt`
+	ClosedAt     int64 `db:closed_at json:closedAt`
 }
 
-type CreateCardDto struct {
-	AccountID string `json:accountId`
-	PGPKey    string `json:pgpKey`
+// CardControls are the spending rules of a card set by its owner. Limits are
+// in minor units of the account currency, 0 means no limit.
+type CardControls struct {
+	SingleLimit  int64 `db:single_limit json:singleLimit`
+	DailyLimit   int64 `db:daily_limit json:dailyLimit`
+	MonthlyLimit int64 `db:monthly_limit json:monthlyLimit`
+	// OnlineEnabled allows payments without the card present
+	OnlineEnabled bool `db:online_enabled json:onlineEnabled`
+	// BlockedMccs are the merchant category codes the card cannot pay at
+	BlockedMccs []string `db:blocked_mccs json:blockedMccs`
 }
 
-func (this *CreateCardDto) IsValid() bool {
-	if this.AccountID == "" {
+func (this *CardControls) IsValid() bool {
+	if this.SingleLimit < 0 || this.DailyLimit < 0 || this.MonthlyLimit < 0 {
 		return false
 	}
-	if this.PGPKey == "" {
+	for _, mcc := range this.BlockedMccs {
+		if !isMcc(mcc) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// BlocksMcc reports whether payments at merchants of the category are blocked.
+func (this *CardControls) BlocksMcc(mcc string) bool {
+	for _, blocked := range this.BlockedMccs {
+		if blocked == mcc {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMcc reports whether code is a 4-digit merchant category code.
+func isMcc(code string) bool {
+	if len(code) != 4 {
 		return false
 	}
 
+	for i := range code {
+		if code[i] < '0' || code[i] > '9' {
+			return false
+		}
+	}
+
 	return true
 }
 
+// CardResponseDto describes a card without its secrets.
+type CardResponseDto struct {
+	ID string `json:id`
+	// MaskedNumber shows only the last 4 digits, e.g. "**** **** **** 1234"
+	MaskedNumber string `json:maskedNumber`
+	AccountID    string `json:accountId`
+	Status       string `json:status`
+	ReissuedFrom string `json:reissuedFrom`
+	CreatedAt    int64  `json:createdAt`
+	ClosedAt     int64  `json:closedAt`
+}
+
+// MaskCardNumber hides all digits of a card number but the last 4.
+func MaskCardNumber(last4 string) string {
+	if last4 == "" {
+		last4 = "****"
+	}
+
+	return "**** **** **** " + last4
+}
+
+type CreateCardDto struct {
+	AccountID string `json:accountId`
+}
+
+func (this *CreateCardDto) IsValid() bool {
+	return this.AccountID != ""
+}
+
 type CreateCardResponseDto struct {
 	ID         string `json:id`
 	Number     string `json:number`
@@ -35,18 +114,13 @@ type CreateCardResponseDto struct {
 
 type GetCardInfoDto struct {
 	CardId string `json:cardId`
+	// PGPKey is only needed for cards encrypted with a key supplied by the
+	// client, they are re-encrypted with a data key once it is given
 	PGPKey string `json:pgpKey`
 }
 
 func (this *GetCardInfoDto) IsValid() bool {
-	if this.CardId == "" {
-		return false
-	}
-	if this.PGPKey == "" {
-		return false
-	}
-
-	return true
+	return this.CardId != ""
 }
 
 type GetCardInfoResponseDto struct {
@@ -55,21 +129,41 @@ type GetCardInfoResponseDto struct {
 	Expiration string `json:expiration`
 	UserId     string `json:userId`
 	AccountID  string `json:accountId`
+	Status     string `json:status`
 	CreatedAt  int64  `json:createdAt`
 }
 
+// isCardNumber reports whether number has the 16 digits of a card number.
+// The check digit is not verified, since early cards were issued without a valid one.
+func isCardNumber(number string) bool {
+	if len(number) != 16 {
+		return false
+	}
+
+	for i := range number {
+		if number[i] < '0' || number[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
 type PayCardDto struct {
-	// todo: use card number instead:
-	// CardNumber string `json:cardNumber`
-	CardId     string `json:cardId`
+	CardNumber string `json:cardNumber`
 	Expiration string `json:expiration`
 	CVV        string `json:cvv`
 	Amount     int64  `json:amount`
-	PGPKey     string `json:pgpKey`
+	// Mcc is the merchant category code, optional
+	Mcc string `json:mcc`
+	// Online marks a payment without the card present
+	Online bool `json:online`
+	// PGPKey is only needed for cards encrypted with a key supplied by the client
+	PGPKey string `json:pgpKey`
 }
 
 func (this *PayCardDto) IsValid() bool {
-	if this.CardId == "" {
+	if !isCardNumber(this.CardNumber) {
 		return false
 	}
 	if this.Expiration == "" {
@@ -81,7 +175,7 @@ func (this *PayCardDto) IsValid() bool {
 	if this.Amount <= 0 {
 		return false
 	}
-	if this.PGPKey == "" {
+	if this.Mcc != "" && !isMcc(this.Mcc) {
 		return false
 	}
 
@@ -0,0 +1,56 @@
+package entities
+
+import "fmt"
+
+// DefaultCurrency is used for accounts opened without a currency and for loans
+const DefaultCurrency = "RUB"
+
+// Currency is an ISO 4217 currency. Amounts are stored in minor units,
+// so 1 unit of the currency is 10^MinorUnits in amounts.
+type Currency struct {
+	Code       string `json:code`
+	Name       string `json:name`
+	MinorUnits int    `json:minorUnits`
+}
+
+var currencies = map[string]Currency{
+	"RUB": {Code: "RUB", Name: "Russian ruble", MinorUnits: 2},
+	"USD": {Code: "USD", Name: "US dollar", MinorUnits: 2},
+	"EUR": {Code: "EUR", Name: "Euro", MinorUnits: 2},
+	"CNY": {Code: "CNY", Name: "Yuan renminbi", MinorUnits: 2},
+	"GBP": {Code: "GBP", Name: "Pound sterling", MinorUnits: 2},
+	"CHF": {Code: "CHF", Name: "Swiss franc", MinorUnits: 2},
+	"KZT": {Code: "KZT", Name: "Tenge", MinorUnits: 2},
+	"TRY": {Code: "TRY", Name: "Turkish lira", MinorUnits: 2},
+	"AED": {Code: "AED", Name: "UAE dirham", MinorUnits: 2},
+	"JPY": {Code: "JPY", Name: "Yen", MinorUnits: 0},
+}
+
+// GetCurrency returns a supported currency by its ISO 4217 code.
+func GetCurrency(code string) (Currency, bool) {
+	currency, ok := currencies[code]
+	return currency, ok
+}
+
+func IsSupportedCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// Format renders amount in minor units as a decimal number of units, e.g. "-1234.50".
+func (this Currency) Format(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := fmt.Sprintf("%0*d", this.MinorUnits+1, amount)
+	if this.MinorUnits == 0 {
+		return sign + digits
+	}
+
+	point := len(digits) - this.MinorUnits
+
+	return sign + digits[:point] + "." + digits[point:]
+}
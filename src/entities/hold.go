@@ -0,0 +1,64 @@
+package entities
+
+// Hold is an authorization of a card payment. It reserves the amount on the
+// account of the card until it is captured, voided or expires.
+type Hold struct {
+	ID        string `db:id json:id`
+	CardId    string `db:card_id json:cardId`
+	AccountId string `db:account_id json:accountId`
+	UserId    string `db:user_id json:userId`
+	Amount    int64  `db:amount json:amount`
+	// CapturedAmount is the amount actually debited, at most Amount
+	CapturedAmount int64  `db:captured_amount json:capturedAmount`
+	Currency       string `db:currency json:currency`
+	Description    string `db:description json:description`
+	// Status is "authorized", "captured", "voided" or "expired"
+	Status        string `db:status json:status`
+	TransactionId string `db:transaction_id json:transactionId`
+	ExpiresAt     int64  `db:expires_at json:expiresAt`
+	CreatedAt     int64  `db:created_at json:createdAt`
+	UpdatedAt     int64  `db:updated_at json:updatedAt`
+}
+
+type AuthorizeCardDto struct {
+	CardNumber  string `json:cardNumber`
+	Expiration  string `json:expiration`
+	CVV         string `json:cvv`
+	Amount      int64  `json:amount`
+	Description string `json:description`
+	// Mcc is the merchant category code, optional
+	Mcc string `json:mcc`
+	// Online marks a payment without the card present
+	Online bool `json:online`
+	// PGPKey is only needed for cards encrypted with a key supplied by the client
+	PGPKey string `json:pgpKey`
+}
+
+func (this *AuthorizeCardDto) IsValid() bool {
+	if !isCardNumber(this.CardNumber) {
+		return false
+	}
+	if this.Expiration == "" {
+		return false
+	}
+	if this.CVV == "" {
+		return false
+	}
+	if this.Amount <= 0 {
+		return false
+	}
+	if this.Mcc != "" && !isMcc(this.Mcc) {
+		return false
+	}
+
+	return true
+}
+
+type CaptureHoldDto struct {
+	// Amount is at most the held amount, the whole hold when 0
+	Amount int64 `json:amount`
+}
+
+func (this *CaptureHoldDto) IsValid() bool {
+	return this.Amount >= 0
+}
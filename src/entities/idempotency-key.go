@@ -0,0 +1,15 @@
+package entities
+
+// IdempotencyKey is the stored outcome of a request sent with an Idempotency-Key header
+type IdempotencyKey struct {
+	UserId      string `db:user_id json:userId`
+	Key         string `db:key json:key`
+	RequestHash string `db:request_hash json:requestHash`
+	// Status is "pending" while the request is being processed and "completed" afterwards
+	Status      string `db:status json:status`
+	StatusCode  int    `db:status_code json:statusCode`
+	ContentType string `db:content_type json:contentType`
+	Response    []byte `db:response json:response`
+	CreatedAt   int64  `db:created_at json:createdAt`
+	CompletedAt int64  `db:completed_at json:completedAt`
+}
@@ -0,0 +1,112 @@
+package entities
+
+// Bank-side ledger accounts, the counterparts of customer accounts in journal entries
+const (
+	CashLedgerAccount           = "bank_cash"
+	LoansLedgerAccount          = "bank_loans"
+	InterestIncomeLedgerAccount = "bank_interest_income"
+	PenaltyIncomeLedgerAccount  = "bank_penalty_income"
+	FeeIncomeLedgerAccount      = "bank_fee_income"
+	// FxLedgerAccount is the currency position of the bank: it takes one
+	// currency and gives out another when customers convert money
+	FxLedgerAccount = "bank_fx"
+	// FxIncomeLedgerAccount receives the spread charged on conversions
+	FxIncomeLedgerAccount = "bank_fx_income"
+)
+
+// IsLedgerAccount reports whether id is a bank-side ledger account rather than a customer account.
+func IsLedgerAccount(id string) bool {
+	switch id {
+	case CashLedgerAccount, LoansLedgerAccount, InterestIncomeLedgerAccount, PenaltyIncomeLedgerAccount, FeeIncomeLedgerAccount, FxLedgerAccount, FxIncomeLedgerAccount:
+		return true
+	}
+
+	return false
+}
+
+// LedgerAccount is the balance of a bank-side account in one currency
+type LedgerAccount struct {
+	ID   string `db:id json:id`
+	Name string `db:name json:name`
+	// NormalSide is the side, "debit" or "credit", that increases the balance
+	NormalSide string `db:normal_side json:normalSide`
+	Currency   string `db:currency json:currency`
+	Balance    int64  `db:balance json:balance`
+}
+
+// JournalEntry is a set of postings whose debits and credits are equal.
+// Customer accounts are liabilities of the bank, so they grow on credit.
+// All postings of an entry are in its currency.
+type JournalEntry struct {
+	ID            string    `db:id json:id`
+	TransactionId string    `db:transaction_id json:transactionId`
+	Currency      string    `db:currency json:currency`
+	Description   string    `db:description json:description`
+	CreatedAt     int64     `db:created_at json:createdAt`
+	Postings      []Posting `json:postings`
+	// Forced marks debits the customer can no longer refuse, like interest
+	// charged by the bank or captures of card holds, which are posted even to
+	// frozen accounts and beyond the available balance
+	Forced bool `json:"-"`
+}
+
+type Posting struct {
+	EntryId   string `db:entry_id json:entryId`
+	AccountId string `db:account_id json:accountId`
+	// Side is "debit" or "credit"
+	Side   string `db:side json:side`
+	Amount int64  `db:amount json:amount`
+}
+
+func (this *JournalEntry) Debit(accountId string, amount int64) {
+	this.post(accountId, "debit", amount)
+}
+
+func (this *JournalEntry) Credit(accountId string, amount int64) {
+	this.post(accountId, "credit", amount)
+}
+
+func (this *JournalEntry) post(accountId string, side string, amount int64) {
+	if amount == 0 {
+		return
+	}
+
+	this.Postings = append(this.Postings, Posting{
+		EntryId:   this.ID,
+		AccountId: accountId,
+		Side:      side,
+		Amount:    amount,
+	})
+}
+
+func (this *JournalEntry) IsBalanced() bool {
+	if len(this.Postings) == 0 {
+		return false
+	}
+
+	var debit, credit int64
+	for _, posting := range this.Postings {
+		if posting.Amount <= 0 {
+			return false
+		}
+
+		switch posting.Side {
+		case "debit":
+			debit += posting.Amount
+		case "credit":
+			credit += posting.Amount
+		default:
+			return false
+		}
+	}
+
+	return debit == credit
+}
+
+// TrialBalance compares the totals of all postings in a currency; they are equal when the ledger is consistent
+type TrialBalance struct {
+	Currency   string `json:currency`
+	Debit      int64  `json:debit`
+	Credit     int64  `json:credit`
+	IsBalanced bool   `json:isBalanced`
+}
@@ -0,0 +1,58 @@
+package entities
+
+type LoanApplication struct {
+	ID           string `db:id json:id`
+	UserId       string `db:user_id json:userId`
+	AccountId    string `db:account_id json:accountId`
+	ProductId    string `db:product_id json:productId`
+	Amount       int64  `db:amount json:amount`
+	Term         int    `db:term json:term`
+	ScheduleType string `db:schedule_type json:scheduleType`
+	// Status is "submitted", "under_review", "approved", "rejected", "disbursed" or "cancelled"
+	Status string `db:status json:status`
+	// ScoringDecision is "approved", "rejected" or "counter_offer"
+	ScoringDecision string   `db:scoring_decision json:scoringDecision`
+	Reasons         []string `db:reasons json:reasons`
+	OfferedAmount   int64    `db:offered_amount json:offeredAmount`
+	MonthlyIncome   int64    `db:monthly_income json:monthlyIncome`
+	DebtToIncome    float64  `db:debt_to_income json:debtToIncome`
+	ApprovedAmount  int64    `db:approved_amount json:approvedAmount`
+	ReviewedBy      string   `db:reviewed_by json:reviewedBy`
+	LoanId          string   `db:loan_id json:loanId`
+	CreatedAt       int64    `db:created_at json:createdAt`
+	UpdatedAt       int64    `db:updated_at json:updatedAt`
+}
+
+// LoanDecision is the outcome of scoring a loan application
+type LoanDecision struct {
+	Status        string
+	Reasons       []string
+	OfferedAmount int64
+	MonthlyIncome int64
+	DebtToIncome  float64
+}
+
+type LoanApplicationApproveDto struct {
+	// Amount defaults to the counter-offer, if any, or to the requested amount
+	Amount int64 `json:amount`
+}
+
+func (this *LoanApplicationApproveDto) IsValid() bool {
+	if this.Amount < 0 {
+		return false
+	}
+
+	return true
+}
+
+type LoanApplicationRejectDto struct {
+	Reason string `json:reason`
+}
+
+func (this *LoanApplicationRejectDto) IsValid() bool {
+	if this.Reason == "" {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,70 @@
+package entities
+
+type LoanProduct struct {
+	ID   string `db:id json:id`
+	Name string `db:name json:name`
+	// RateType is "fixed" to use Rate or "floating" to use the key rate as
+	// the base rate, Margin is added to the base rate in both cases
+	RateType  string  `db:rate_type json:rateType`
+	Rate      float64 `db:rate json:rate`
+	Margin    float64 `db:margin json:margin`
+	MinAmount int64   `db:min_amount json:minAmount`
+	MaxAmount int64   `db:max_amount json:maxAmount`
+	Terms     []int   `db:terms json:terms`
+	Fee       int64   `db:fee json:fee`
+	IsActive  bool    `db:is_active json:isActive`
+	CreatedAt int64   `db:created_at json:createdAt`
+}
+
+func (this *LoanProduct) AllowsTerm(term int) bool {
+	for _, allowed := range this.Terms {
+		if allowed == term {
+			return true
+		}
+	}
+
+	return false
+}
+
+type LoanProductDto struct {
+	Name      string  `json:name`
+	RateType  string  `json:rateType`
+	Rate      float64 `json:rate`
+	Margin    float64 `json:margin`
+	MinAmount int64   `json:minAmount`
+	MaxAmount int64   `json:maxAmount`
+	Terms     []int   `json:terms`
+	Fee       int64   `json:fee`
+	IsActive  bool    `json:isActive`
+}
+
+func (this *LoanProductDto) IsValid() bool {
+	if this.Name == "" {
+		return false
+	}
+	if this.RateType != "fixed" && this.RateType != "floating" {
+		return false
+	}
+	if this.RateType == "fixed" && this.Rate <= 0 {
+		return false
+	}
+	if this.Margin < 0 {
+		return false
+	}
+	if this.MinAmount <= 0 || this.MaxAmount < this.MinAmount {
+		return false
+	}
+	if len(this.Terms) == 0 {
+		return false
+	}
+	for _, term := range this.Terms {
+		if term <= 0 {
+			return false
+		}
+	}
+	if this.Fee < 0 || this.Fee >= this.MinAmount {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package entities
+
+type LoanRestructuring struct {
+	ID     string `db:id json:id`
+	LoanId string `db:loan_id json:loanId`
+	UserId string `db:user_id json:userId`
+	// ExtraTerm is the number of months added to the remaining term
+	ExtraTerm int `db:extra_term json:extraTerm`
+	// GraceMonths is the number of interest-only months at the start of the new schedule
+	GraceMonths int `db:grace_months json:graceMonths`
+	// NewRate is the rate for the remaining principal, 0 keeps the current one
+	NewRate float64 `db:new_rate json:newRate`
+	Reason  string  `db:reason json:reason`
+	// Status is "pending", "approved" or "rejected"
+	Status        string `db:status json:status`
+	ReviewComment string `db:review_comment json:reviewComment`
+	ReviewedBy    string `db:reviewed_by json:reviewedBy`
+	CreatedAt     int64  `db:created_at json:createdAt`
+	UpdatedAt     int64  `db:updated_at json:updatedAt`
+}
+
+type LoanRestructuringDto struct {
+	ExtraTerm   int     `json:extraTerm`
+	GraceMonths int     `json:graceMonths`
+	NewRate     float64 `json:newRate`
+	Reason      string  `json:reason`
+}
+
+func (this *LoanRestructuringDto) IsValid() bool {
+	if this.ExtraTerm < 0 || this.GraceMonths < 0 || this.NewRate < 0 {
+		return false
+	}
+	if this.ExtraTerm == 0 && this.GraceMonths == 0 && this.NewRate == 0 {
+		return false
+	}
+	if this.Reason == "" {
+		return false
+	}
+
+	return true
+}
+
+type LoanRestructuringRejectDto struct {
+	Comment string `json:comment`
+}
+
+func (this *LoanRestructuringRejectDto) IsValid() bool {
+	if this.Comment == "" {
+		return false
+	}
+
+	return true
+}
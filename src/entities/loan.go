@@ -9,13 +9,18 @@ type Loan struct {
 	Term         int     `db:term json:term`
 	StartDate    int64   `db:start_date json:startDate`
 	Debt         int64   `db:debt json:debt`
+	ScheduleType string  `db:schedule_type json:scheduleType`
+	ProductId    string  `db:product_id json:productId`
 }
 
 type LoanApplyDto struct {
 	UserId    string `json:userId`
 	AccountId string `json:accountId`
+	ProductId string `json:productId`
 	Amount    int64  `json:amount`
 	Term      int    `json:term`
+	// ScheduleType is "annuity" (default) or "differentiated"
+	ScheduleType string `json:scheduleType`
 }
 
 func (this *LoanApplyDto) IsValid() bool {
@@ -25,12 +30,48 @@ func (this *LoanApplyDto) IsValid() bool {
 	if this.AccountId == "" {
 		return false
 	}
+	if this.ProductId == "" {
+		return false
+	}
 	if this.Amount <= 0 {
 		return false
 	}
 	if this.Term <= 0 {
 		return false
 	}
+	if this.ScheduleType != "" && this.ScheduleType != "annuity" && this.ScheduleType != "differentiated" {
+		return false
+	}
+
+	return true
+}
+
+type LoanPayDto struct {
+	Amount int64 `json:amount`
+}
+
+func (this *LoanPayDto) IsValid() bool {
+	if this.Amount <= 0 {
+		return false
+	}
+
+	return true
+}
+
+type LoanPrepayDto struct {
+	Amount int64 `json:amount`
+	// Mode is "term" to keep the installment and shorten the term,
+	// or "payment" to keep the term and lower the installment
+	Mode string `json:mode`
+}
+
+func (this *LoanPrepayDto) IsValid() bool {
+	if this.Amount <= 0 {
+		return false
+	}
+	if this.Mode != "term" && this.Mode != "payment" {
+		return false
+	}
 
 	return true
 }
@@ -44,5 +85,28 @@ type LoanResponseDto struct {
 	Term         int       `json:term`
 	StartDate    int64     `json:startDate`
 	Debt         int64     `json:debt`
+	ScheduleType string    `json:scheduleType`
+	ProductId    string    `json:productId`
 	Payments     []Payment `json:payments`
 }
+
+// LoanSummaryDto is a loan with its outstanding balance computed from the payment schedule
+type LoanSummaryDto struct {
+	ID           string  `json:id`
+	AccountId    string  `json:accountId`
+	ProductId    string  `json:productId`
+	Amount       int64   `json:amount`
+	InterestRate float64 `json:interestRate`
+	Term         int     `json:term`
+	StartDate    int64   `json:startDate`
+	ScheduleType string  `json:scheduleType`
+	// Status is "active", "closed" or "defaulted"
+	Status             string    `json:status`
+	RemainingPrincipal int64     `json:remainingPrincipal`
+	InterestPaid       int64     `json:interestPaid`
+	InterestRemaining  int64     `json:interestRemaining`
+	PenaltyOutstanding int64     `json:penaltyOutstanding`
+	OverdueCount       int       `json:overdueCount`
+	NextPayment        *Payment  `json:nextPayment`
+	Payments           []Payment `json:payments`
+}
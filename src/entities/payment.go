@@ -1,13 +1,46 @@
 package entities
 
 type Payment struct {
-	ID            string `db:id json:id`
-	LoanId        string `db:loan_id json:loanId`
-	Amount        int64  `db:amount json:amount`
-	Date          int64  `db:date json:date`
-	DueDate       int64  `db:due_date json:dueDate`
-	PrincipalPart int64  `db:principal_part json:principalPart`
-	InterestPart  int64  `db:interest_part json:interestPart`
-	Status        string `db:status json:status`
-	IsPaid        bool   `db:is_paid json:isPaid`
+	ID               string `db:id json:id`
+	LoanId           string `db:loan_id json:loanId`
+	Amount           int64  `db:amount json:amount`
+	Date             int64  `db:date json:date`
+	DueDate          int64  `db:due_date json:dueDate`
+	PrincipalPart    int64  `db:principal_part json:principalPart`
+	InterestPart     int64  `db:interest_part json:interestPart`
+	PrincipalPaid    int64  `db:principal_paid json:principalPaid`
+	InterestPaid     int64  `db:interest_paid json:interestPaid`
+	PenaltyPart      int64  `db:penalty_part json:penaltyPart`
+	PenaltyPaid      int64  `db:penalty_paid json:penaltyPaid`
+	PenaltyAccruedAt int64  `db:penalty_accrued_at json:penaltyAccruedAt`
+	Status           string `db:status json:status`
+	IsPaid           bool   `db:is_paid json:isPaid`
+	DebitAttempts    int    `db:debit_attempts json:debitAttempts`
+	NextDebitAt      int64  `db:next_debit_at json:nextDebitAt`
+}
+
+// PaymentRepayment is the part of a repayment settling one payment.
+type PaymentRepayment struct {
+	PaymentId string
+	Interest  int64
+	Principal int64
+	Penalty   int64
+}
+
+// ArchivedPayment is an installment of a schedule replaced by a loan restructuring
+type ArchivedPayment struct {
+	ID              string `db:id json:id`
+	LoanId          string `db:loan_id json:loanId`
+	RestructuringId string `db:restructuring_id json:restructuringId`
+	Amount          int64  `db:amount json:amount`
+	Date            int64  `db:date json:date`
+	DueDate         int64  `db:due_date json:dueDate`
+	PrincipalPart   int64  `db:principal_part json:principalPart`
+	InterestPart    int64  `db:interest_part json:interestPart`
+	PrincipalPaid   int64  `db:principal_paid json:principalPaid`
+	InterestPaid    int64  `db:interest_paid json:interestPaid`
+	PenaltyPart     int64  `db:penalty_part json:penaltyPart`
+	PenaltyPaid     int64  `db:penalty_paid json:penaltyPaid`
+	Status          string `db:status json:status`
+	ArchivedAt      int64  `db:archived_at json:archivedAt`
 }
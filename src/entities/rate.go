@@ -0,0 +1,14 @@
+package entities
+
+type KeyRate struct {
+	ID        string  `db:id json:id`
+	Rate      float64 `db:rate json:rate`
+	FetchedAt int64   `db:fetched_at json:fetchedAt`
+}
+
+// ExchangeRate is the price in rubles of one unit of a currency
+type ExchangeRate struct {
+	Currency  string  `db:currency json:currency`
+	Rate      float64 `db:rate json:rate`
+	FetchedAt int64   `db:fetched_at json:fetchedAt`
+}
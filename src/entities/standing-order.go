@@ -0,0 +1,109 @@
+package entities
+
+// StandingOrder is a transfer repeated on a schedule, e.g. rent on the 1st of every month.
+type StandingOrder struct {
+	ID            string `db:id json:id`
+	UserId        string `db:user_id json:userId`
+	FromAccountId string `db:from_account_id json:fromAccountId`
+	ToAccountId   string `db:to_account_id json:toAccountId`
+	Amount        int64  `db:amount json:amount`
+	Description   string `db:description json:description`
+	// Convert allows transfers between accounts in different currencies
+	Convert bool `db:convert_currency json:convert`
+	// Frequency is "daily", "weekly" or "monthly"
+	Frequency string `db:frequency json:frequency`
+	// Interval is the number of periods between transfers, e.g. 2 weeks
+	Interval int `db:interval_count json:interval`
+	// StartDate is the first transfer; later ones fall on the same weekday or
+	// day of month, or on the last day of shorter months
+	StartDate int64 `db:start_date json:startDate`
+	// EndDate is the last moment a transfer may run at, 0 for no end
+	EndDate   int64 `db:end_date json:endDate`
+	NextRunAt int64 `db:next_run_at json:nextRunAt`
+	// Status is "active", "paused", "completed" or "cancelled"
+	Status string `db:status json:status`
+	// FailedAttempts counts failed attempts of the current transfer
+	FailedAttempts int    `db:failed_attempts json:failedAttempts`
+	LastRunAt      int64  `db:last_run_at json:lastRunAt`
+	LastError      string `db:last_error json:lastError`
+	CreatedAt      int64  `db:created_at json:createdAt`
+	UpdatedAt      int64  `db:updated_at json:updatedAt`
+}
+
+// StandingOrderRun is one attempt to make a transfer of a standing order.
+type StandingOrderRun struct {
+	ID            string `db:id json:id`
+	OrderId       string `db:order_id json:orderId`
+	TransactionId string `db:transaction_id json:transactionId`
+	// Status is "succeeded" or "failed"
+	Status      string `db:status json:status`
+	Error       string `db:error json:error`
+	ScheduledAt int64  `db:scheduled_at json:scheduledAt`
+	RunAt       int64  `db:run_at json:runAt`
+}
+
+func isStandingOrderFrequency(frequency string) bool {
+	return frequency == "daily" || frequency == "weekly" || frequency == "monthly"
+}
+
+type CreateStandingOrderDto struct {
+	FromAccountId string `json:fromAccountId`
+	ToAccountId   string `json:toAccountId`
+	Amount        int64  `json:amount`
+	Description   string `json:description`
+	Convert       bool   `json:convert`
+	Frequency     string `json:frequency`
+	// Interval defaults to 1
+	Interval  int   `json:interval`
+	StartDate int64 `json:startDate`
+	EndDate   int64 `json:endDate`
+}
+
+func (this *CreateStandingOrderDto) IsValid() bool {
+	if this.FromAccountId == "" || this.ToAccountId == "" {
+		return false
+	}
+	if this.FromAccountId == this.ToAccountId {
+		return false
+	}
+	if this.Amount <= 0 {
+		return false
+	}
+	if !isStandingOrderFrequency(this.Frequency) {
+		return false
+	}
+	if this.Interval < 0 {
+		return false
+	}
+	if this.StartDate <= 0 {
+		return false
+	}
+	if this.EndDate != 0 && this.EndDate < this.StartDate {
+		return false
+	}
+
+	return true
+}
+
+type UpdateStandingOrderDto struct {
+	Amount      int64  `json:amount`
+	Description string `json:description`
+	Convert     bool   `json:convert`
+	EndDate     int64  `json:endDate`
+	// Status is "active" or "paused"
+	Status string `json:status`
+}
+
+func (this *UpdateStandingOrderDto) IsValid() bool {
+	if this.Amount <= 0 {
+		return false
+	}
+	if this.EndDate < 0 {
+		return false
+	}
+	if this.Status != "active" && this.Status != "paused" {
+		return false
+	}
+
+	return true
+}
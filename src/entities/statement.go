@@ -0,0 +1,29 @@
+package entities
+
+// Statement lists the movements of an account over [From, To) with the
+// balance before and after them.
+type Statement struct {
+	AccountId      string          `json:accountId`
+	Currency       string          `json:currency`
+	From           int64           `json:from`
+	To             int64           `json:to`
+	OpeningBalance int64           `json:openingBalance`
+	ClosingBalance int64           `json:closingBalance`
+	TotalCredit    int64           `json:totalCredit`
+	TotalDebit     int64           `json:totalDebit`
+	Lines          []StatementLine `json:lines`
+	CreatedAt      int64           `json:createdAt`
+}
+
+type StatementLine struct {
+	TransactionId string `json:transactionId`
+	Type          string `json:type`
+	Description   string `json:description`
+	// CounterpartyId is the other account or the loan of the transaction, if any
+	CounterpartyId string `json:counterpartyId`
+	// Amount is positive for credits to the account and negative for debits
+	Amount int64 `json:amount`
+	// Balance is the balance of the account after the transaction
+	Balance   int64 `json:balance`
+	CreatedAt int64 `json:createdAt`
+}
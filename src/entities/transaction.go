@@ -3,9 +3,14 @@ package entities
 type Transaction struct {
 	ID            string `db: id json: id`
 	Amount        int64  `db: amount json: amount`
+	Currency      string `db: currency json: currency`
 	FromAccountId string `db: from_id json: from`
 	ToAccountId   string `db: to_id json: to`
 	Type          string `db: type json: type`
 	Description   string `db: description json: description`
 	CreatedAt     int64  `db: created_at json: created_at`
+	// LinkedTransactionId is the other leg of a currency conversion
+	LinkedTransactionId string `db: linked_id json: linked_id`
+	// CardId is the card of a card payment
+	CardId string `db: card_id json: card_id`
 }
@@ -5,6 +5,7 @@ type User struct {
 	Username string `db:username json:username`
 	Password string `db:password json:password`
 	Email    string `db:email json:email`
+	Role     string `db:role json:role`
 }
 
 type RegisterUserDto struct {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bank-system/config"
 	"bank-system/src/controllers"
 	"bank-system/src/db"
 	"bank-system/src/middlewares"
@@ -9,6 +10,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -35,11 +37,41 @@ func main() {
 	userRepository := repositories.NewUserRepository(db)
 	transactionRepository := repositories.NewTransactionRepository(db)
 	accountRepository := repositories.NewAccountRepository(db)
+	ledgerRepository := repositories.NewLedgerRepository(db)
 	cardRepository := repositories.NewCardRepository(db)
 	paymentRepository := repositories.NewPaymentRepository(db)
 	loanRepository := repositories.NewLoanRepository(db)
+	loanProductRepository := repositories.NewLoanProductRepository(db)
+	loanApplicationRepository := repositories.NewLoanApplicationRepository(db)
+	keyRateRepository := repositories.NewKeyRateRepository(db)
+	loanRestructuringRepository := repositories.NewLoanRestructuringRepository(db)
+	idempotencyKeyRepository := repositories.NewIdempotencyKeyRepository(db)
+	exchangeRateRepository := repositories.NewExchangeRateRepository(db)
+	standingOrderRepository := repositories.NewStandingOrderRepository(db)
+	holdRepository := repositories.NewHoldRepository(db)
 
 	// services
+	cbrConfig := config.LoadCbrConfig()
+	keyRateProvider := services.NewCachedKeyRateProvider(
+		services.NewCbrKeyRateProvider(cbrConfig.Url),
+		keyRateRepository,
+		cbrConfig.KeyRateCacheTTL,
+		logger,
+	)
+	if cbrConfig.KeyRateProvider == "static" {
+		keyRateProvider = services.NewStaticKeyRateProvider(cbrConfig.StaticKeyRate)
+	}
+	exchangeRateProvider := services.NewCachedExchangeRateProvider(
+		services.NewCbrExchangeRateSource(cbrConfig.Url),
+		exchangeRateRepository,
+		cbrConfig.ExchangeRateCacheTTL,
+		cbrConfig.ExchangeRateMaxAge,
+		logger,
+	)
+	if cbrConfig.ExchangeRateProvider == "static" {
+		exchangeRateProvider = services.NewStaticExchangeRateProvider(cbrConfig.StaticExchangeRates)
+	}
+
 	userService := services.NewUserService(
 		userRepository,
 		logger,
@@ -48,21 +80,88 @@ func main() {
 		transactionRepository,
 		logger,
 	)
+	ledgerService := services.NewLedgerService(
+		ledgerRepository,
+		logger,
+	)
+	statementService := services.NewStatementService(
+		accountRepository,
+		ledgerRepository,
+		logger,
+	)
 	accountService := services.NewAccountService(
 		accountRepository,
-		transactionService,
+		ledgerRepository,
+		exchangeRateProvider,
 		logger,
 	)
+	cardConfig := config.LoadCardConfig()
+	if cardConfig.DevKeys {
+		logger.Warn("card.dev_keys is set, card data is protected with public development keys")
+	}
+	if cardConfig.NumberHashKey == "" {
+		logger.Fatal("Card number hash key card.number_hash_key is not set")
+		return
+	}
+	if cardConfig.MasterKeys == "" && cardConfig.MasterKeysFile == "" {
+		logger.Fatal("Card master keys are not set, set card.master_keys or card.master_keys_file")
+		return
+	}
+	if cardConfig.MasterKeyId == "" {
+		logger.Fatal("Current card master key card.master_key_id is not set")
+		return
+	}
+	masterKeys := cardConfig.MasterKeys
+	if cardConfig.MasterKeysFile != "" {
+		content, err := os.ReadFile(cardConfig.MasterKeysFile)
+		if err != nil {
+			logger.Fatalf("Failed to read card master keys: %v", err)
+			return
+		}
+		masterKeys = string(content)
+	}
+	cardKeyProvider, err := services.NewLocalCardKeyProvider(masterKeys, cardConfig.MasterKeyId)
+	if err != nil {
+		logger.Fatalf("Failed to load card master keys: %v", err)
+		return
+	}
 	cardService := services.NewCardService(
 		accountService,
 		cardRepository,
+		holdRepository,
+		cardKeyProvider,
+		logger,
+	)
+	loanProductService := services.NewLoanProductService(
+		loanProductRepository,
+		keyRateProvider,
+		logger,
+	)
+	scoringService := services.NewScoringService(
+		accountRepository,
+		transactionRepository,
+		loanRepository,
+		paymentRepository,
 		logger,
 	)
 	loanService := services.NewLoanService(
 		loanRepository,
 		paymentRepository,
+		loanProductService,
+		logger,
+	)
+	loanApplicationService := services.NewLoanApplicationService(
+		loanApplicationRepository,
 		accountService,
-		transactionService,
+		loanProductService,
+		loanService,
+		scoringService,
+		logger,
+	)
+	loanRestructuringService := services.NewLoanRestructuringService(
+		loanRestructuringRepository,
+		loanRepository,
+		paymentRepository,
 		logger,
 	)
 	analyticsService := services.NewAnalyticsService(
@@ -70,7 +169,33 @@ func main() {
 		transactionService,
 		logger,
 	)
-	services.NewSchedulerService(paymentRepository, logger).StartPaymentOverdueChecker(ctx)
+	idempotencyService := services.NewIdempotencyService(
+		idempotencyKeyRepository,
+		logger,
+	)
+	standingOrderService := services.NewStandingOrderService(
+		standingOrderRepository,
+		accountService,
+		logger,
+	)
+	schedulerService := services.NewSchedulerService(
+		accountRepository,
+		loanRepository,
+		paymentRepository,
+		standingOrderRepository,
+		holdRepository,
+		accountService,
+		cardService,
+		userService,
+		logger,
+	)
+	schedulerService.StartLoanAutoDebit(ctx)
+	schedulerService.StartPaymentOverdueChecker(ctx)
+	schedulerService.StartPenaltyAccrual(ctx)
+	schedulerService.StartStandingOrders(ctx)
+	schedulerService.StartOverdraftInterestAccrual(ctx)
+	schedulerService.StartHoldExpiry(ctx)
+	schedulerService.StartCardKeyRotation(ctx)
 
 	// controllers
 	userController := controllers.NewUserController(
@@ -79,6 +204,7 @@ func main() {
 	)
 	accountController := controllers.NewAccountController(
 		accountService,
+		statementService,
 		logger,
 	)
 	cardController := controllers.NewCardController(
@@ -89,12 +215,34 @@ func main() {
 		loanService,
 		logger,
 	)
+	loanApplicationController := controllers.NewLoanApplicationController(
+		loanApplicationService,
+		logger,
+	)
+	loanRestructuringController := controllers.NewLoanRestructuringController(
+		loanRestructuringService,
+		logger,
+	)
+	loanProductController := controllers.NewLoanProductController(
+		loanProductService,
+		logger,
+	)
+	ledgerController := controllers.NewLedgerController(
+		ledgerService,
+		logger,
+	)
 	analyticsController := controllers.NewAnalyticsController(
 		analyticsService,
 		logger,
 	)
+	standingOrderController := controllers.NewStandingOrderController(
+		standingOrderService,
+		logger,
+	)
 
 	jwtMiddleware := middlewares.NewJwtMiddleware(logger)
+	adminMiddleware := middlewares.NewAdminMiddleware(userService, logger)
+	idempotencyMiddleware := middlewares.NewIdempotencyMiddleware(idempotencyService, logger)
 
 	// routes
 	router := mux.NewRouter().PathPrefix("").Subrouter()
@@ -106,25 +254,76 @@ func main() {
 	accountRouter.Use(jwtMiddleware.Middleware)
 	accountRouter.HandleFunc("", accountController.GetAll).Methods(http.MethodGet)
 	accountRouter.HandleFunc("/{id}", accountController.GetById).Methods(http.MethodGet)
+	accountRouter.HandleFunc("/{id}/statement", accountController.GetStatement).Methods(http.MethodGet)
 	accountRouter.HandleFunc("/create", accountController.Create).Methods(http.MethodPost)
-	accountRouter.HandleFunc("/{id}/balance", accountController.UpdateBalance).Methods(http.MethodPatch)
-	accountRouter.HandleFunc("/{id}", accountController.Delete).Methods(http.MethodDelete)
-	accountRouter.HandleFunc("/transfer", accountController.Transfer).Methods(http.MethodPost)
+	accountRouter.Handle("/{id}/balance", idempotencyMiddleware.Middleware(http.HandlerFunc(accountController.UpdateBalance))).Methods(http.MethodPatch)
+	accountRouter.HandleFunc("/{id}", accountController.Close).Methods(http.MethodDelete)
+	accountRouter.HandleFunc("/{id}/freeze", accountController.Freeze).Methods(http.MethodPost)
+	accountRouter.HandleFunc("/{id}/unfreeze", accountController.Unfreeze).Methods(http.MethodPost)
+	accountRouter.HandleFunc("/{id}/overdraft", accountController.UpdateOverdraft).Methods(http.MethodPut)
+	accountRouter.Handle("/transfer", idempotencyMiddleware.Middleware(http.HandlerFunc(accountController.Transfer))).Methods(http.MethodPost)
+	accountRouter.Handle("/exchange", idempotencyMiddleware.Middleware(http.HandlerFunc(accountController.Exchange))).Methods(http.MethodPost)
 	// cards
 	cardRouter := router.PathPrefix("/cards").Subrouter()
 	cardRouter.Use(jwtMiddleware.Middleware)
+	cardRouter.HandleFunc("", cardController.GetAll).Methods(http.MethodGet)
 	cardRouter.HandleFunc("/create", cardController.Create).Methods(http.MethodPost)
 	cardRouter.HandleFunc("/info", cardController.GetInfo).Methods(http.MethodPost)
-	cardRouter.HandleFunc("/pay", cardController.Pay).Methods(http.MethodPost)
+	cardRouter.Handle("/pay", idempotencyMiddleware.Middleware(http.HandlerFunc(cardController.Pay))).Methods(http.MethodPost)
+	cardRouter.Handle("/authorize", idempotencyMiddleware.Middleware(http.HandlerFunc(cardController.Authorize))).Methods(http.MethodPost)
+	cardRouter.HandleFunc("/holds", cardController.GetHolds).Methods(http.MethodGet)
+	cardRouter.HandleFunc("/holds/{id}", cardController.GetHold).Methods(http.MethodGet)
+	cardRouter.HandleFunc("/{id}", cardController.Close).Methods(http.MethodDelete)
+	cardRouter.HandleFunc("/{id}/block", cardController.Block).Methods(http.MethodPost)
+	cardRouter.HandleFunc("/{id}/unblock", cardController.Unblock).Methods(http.MethodPost)
+	cardRouter.HandleFunc("/{id}/reissue", cardController.Reissue).Methods(http.MethodPost)
+	cardRouter.HandleFunc("/{id}/controls", cardController.GetControls).Methods(http.MethodGet)
+	cardRouter.HandleFunc("/{id}/controls", cardController.UpdateControls).Methods(http.MethodPut)
+	// standing orders
+	standingOrderRouter := router.PathPrefix("/standing-orders").Subrouter()
+	standingOrderRouter.Use(jwtMiddleware.Middleware)
+	standingOrderRouter.HandleFunc("", standingOrderController.GetAll).Methods(http.MethodGet)
+	standingOrderRouter.HandleFunc("", standingOrderController.Create).Methods(http.MethodPost)
+	standingOrderRouter.HandleFunc("/{id}", standingOrderController.GetById).Methods(http.MethodGet)
+	standingOrderRouter.HandleFunc("/{id}", standingOrderController.Update).Methods(http.MethodPut)
+	standingOrderRouter.HandleFunc("/{id}", standingOrderController.Cancel).Methods(http.MethodDelete)
+	standingOrderRouter.HandleFunc("/{id}/runs", standingOrderController.GetRuns).Methods(http.MethodGet)
 	// loans
 	loanRouter := router.PathPrefix("/loans").Subrouter()
 	loanRouter.Use(jwtMiddleware.Middleware)
-	loanRouter.HandleFunc("/apply", loanController.Apply).Methods(http.MethodPost)
+	loanRouter.HandleFunc("", loanController.GetAll).Methods(http.MethodGet)
+	loanRouter.HandleFunc("/apply", loanApplicationController.Submit).Methods(http.MethodPost)
+	loanRouter.HandleFunc("/applications", loanApplicationController.GetMine).Methods(http.MethodGet)
+	loanRouter.HandleFunc("/applications/{id}/cancel", loanApplicationController.Cancel).Methods(http.MethodPost)
+	loanRouter.HandleFunc("/products", loanProductController.GetActive).Methods(http.MethodGet)
 	loanRouter.HandleFunc("/{id}/schedule", loanController.GetSchedule).Methods(http.MethodGet)
+	loanRouter.HandleFunc("/{id}/schedule/history", loanRestructuringController.GetScheduleHistory).Methods(http.MethodGet)
+	loanRouter.Handle("/{id}/pay", idempotencyMiddleware.Middleware(http.HandlerFunc(loanController.Pay))).Methods(http.MethodPost)
+	loanRouter.Handle("/{id}/prepay", idempotencyMiddleware.Middleware(http.HandlerFunc(loanController.Prepay))).Methods(http.MethodPost)
+	loanRouter.HandleFunc("/{id}/restructure", loanRestructuringController.Request).Methods(http.MethodPost)
+	loanRouter.HandleFunc("/{id}/restructurings", loanRestructuringController.GetByLoanId).Methods(http.MethodGet)
+	loanRouter.HandleFunc("/{id}", loanController.GetById).Methods(http.MethodGet)
 	// analytics
 	analyticsRouter := router.PathPrefix("/analytics").Subrouter()
 	analyticsRouter.Use(jwtMiddleware.Middleware)
 	analyticsRouter.HandleFunc("/transactions", analyticsController.GetTransactionsAnalytics).Methods(http.MethodPost)
+	// admin
+	adminRouter := router.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(jwtMiddleware.Middleware, adminMiddleware.Middleware)
+	adminRouter.HandleFunc("/loan-products", loanProductController.GetAll).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/loan-products", loanProductController.Create).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/loan-products/{id}", loanProductController.GetById).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/loan-products/{id}", loanProductController.Update).Methods(http.MethodPut)
+	adminRouter.HandleFunc("/loan-applications", loanApplicationController.GetAll).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/loan-applications/{id}/approve", loanApplicationController.Approve).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/loan-applications/{id}/reject", loanApplicationController.Reject).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/loan-restructurings", loanRestructuringController.GetAll).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/loan-restructurings/{id}/approve", loanRestructuringController.Approve).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/loan-restructurings/{id}/reject", loanRestructuringController.Reject).Methods(http.MethodPost)
+	adminRouter.Handle("/holds/{id}/capture", idempotencyMiddleware.Middleware(http.HandlerFunc(cardController.Capture))).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/holds/{id}/void", cardController.Void).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/ledger/accounts", ledgerController.GetAccounts).Methods(http.MethodGet)
+	adminRouter.HandleFunc("/ledger/trial-balance", ledgerController.GetTrialBalance).Methods(http.MethodGet)
 
 	logger.Infof("Starting server at: localhost:%s", PORT)
 	err = http.ListenAndServe(
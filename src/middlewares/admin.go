@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"bank-system/src/services"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+type adminMiddleware struct {
+	userService services.UserService
+	logger      *logrus.Logger
+}
+
+func NewAdminMiddleware(userService services.UserService, logger *logrus.Logger) *adminMiddleware {
+	return &adminMiddleware{
+		userService: userService,
+		logger:      logger,
+	}
+}
+
+// Middleware only lets administrators through, it must run after the jwt middleware.
+func (this *adminMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, ok := r.Context().Value("userId").(string)
+		if !ok {
+			this.logger.Error("User id is missing in request context")
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := this.userService.GetById(r.Context(), userId)
+		if err != nil {
+			this.logger.Errorf("Failed to get user: %v", err)
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		if user.Role != "admin" {
+			this.logger.Errorf("User %s is not an admin", userId)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"bank-system/src/services"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+const maxIdempotencyKeyLength = 255
+
+type idempotencyMiddleware struct {
+	idempotencyService services.IdempotencyService
+	logger             *logrus.Logger
+}
+
+func NewIdempotencyMiddleware(idempotencyService services.IdempotencyService, logger *logrus.Logger) *idempotencyMiddleware {
+	return &idempotencyMiddleware{
+		idempotencyService: idempotencyService,
+		logger:             logger,
+	}
+}
+
+// responseRecorder passes the response through and keeps a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (this *responseRecorder) WriteHeader(statusCode int) {
+	this.statusCode = statusCode
+	this.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (this *responseRecorder) Write(data []byte) (int, error) {
+	this.body.Write(data)
+	return this.ResponseWriter.Write(data)
+}
+
+// Middleware makes requests with an Idempotency-Key header safe to retry: the
+// first response for a key is stored and returned again for every retry with
+// the same request, it must run after the jwt middleware. Server errors are
+// not stored, the key is released so the request can be retried. The key is
+// passed on in the context, services derive the ids of what the request
+// records from it, so a retry of an attempt that has committed despite the
+// error is rejected by the database instead of moving money twice.
+func (this *idempotencyMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			this.logger.Error("Idempotency key is too long")
+			http.Error(w, "Idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+
+		userId, ok := r.Context().Value("userId").(string)
+		if !ok {
+			this.logger.Error("User id is missing in request context")
+			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			this.logger.Errorf("Failed to read request body: %v", err)
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		idempotencyKey, reserved, err := this.idempotencyService.Begin(r.Context(), userId, key, requestHash)
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Failed to process idempotency key", http.StatusInternalServerError)
+			return
+		}
+
+		if !reserved {
+			this.logger.Infof("Replaying response for idempotency key %s", key)
+			if idempotencyKey.ContentType != "" {
+				w.Header().Set("Content-Type", idempotencyKey.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(idempotencyKey.StatusCode)
+			w.Write(idempotencyKey.Response)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), "idempotencyKey", key)))
+
+		// The response has been sent already, a failure here only affects
+		// retries, so it is stored even when the client has disconnected
+		ctx := context.WithoutCancel(r.Context())
+
+		// Server errors are not replayed, the request may succeed when retried
+		if recorder.statusCode >= http.StatusInternalServerError {
+			err = this.idempotencyService.Release(ctx, idempotencyKey)
+			if err != nil {
+				this.logger.Errorf("Failed to release idempotency key %s: %v", key, err)
+				return
+			}
+
+			this.logger.Infof("Released idempotency key %s after response %d", key, recorder.statusCode)
+			return
+		}
+
+		idempotencyKey.StatusCode = recorder.statusCode
+		idempotencyKey.ContentType = recorder.Header().Get("Content-Type")
+		idempotencyKey.Response = recorder.body.Bytes()
+
+		err = this.idempotencyService.Complete(ctx, idempotencyKey)
+		if err != nil {
+			this.logger.Errorf("Failed to complete idempotency key %s: %v", key, err)
+			return
+		}
+
+		this.logger.Infof("Stored response %d for idempotency key %s", recorder.statusCode, key)
+	})
+}
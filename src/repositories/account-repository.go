@@ -3,17 +3,37 @@ package repositories
 import (
 	"bank-system/src/entities"
 	"context"
+	"errors"
+	"slices"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrInsufficientFunds = errors.New("Insufficient funds")
+	// ErrAccountFrozen is returned when a frozen account is debited
+	ErrAccountFrozen = errors.New("Account is frozen")
+	// ErrAccountClosed is returned when a closed account is posted to or changed
+	ErrAccountClosed         = errors.New("Account is closed")
+	ErrAccountNotEmpty       = errors.New("Account balance is not zero")
+	ErrAccountHasActiveLoans = errors.New("Account has loans that are not repaid")
+	ErrAccountHasHolds       = errors.New("Account has card holds that are not captured or released")
+	// ErrAccountStatusChanged means the account is no longer in the status the change expects
+	ErrAccountStatusChanged = errors.New("Account status has changed")
+	// ErrOverdraftInUse means the overdraft limit is lowered below the amount already overdrawn
+	ErrOverdraftInUse = errors.New("Overdrawn amount exceeds the new overdraft limit")
+)
+
 type AccountRepository interface {
 	Create(ctx context.Context, data entities.Account) (string, error)
 	GetAll(ctx context.Context, userId string) ([]entities.Account, error)
 	GetById(ctx context.Context, id string) (entities.Account, error)
-	UpdateBalance(ctx context.Context, id string, newBalance int64) error
-	Delete(ctx context.Context, id string) (string, error)
-	Transfer(ctx context.Context, senderId string, receiverId string, amount int64) error
+	UpdateStatus(ctx context.Context, id string, from string, to string) error
+	Close(ctx context.Context, id string, closedAt int64) error
+	SetOverdraft(ctx context.Context, id string, limit int64, rate float64) error
+	GetOverdrawn(ctx context.Context) ([]entities.Account, error)
+	AccrueOverdraftInterest(ctx context.Context, transaction entities.Transaction, entry entities.JournalEntry, fromTime int64, toTime int64) error
 }
 
 type AccountRepositoryPgx struct {
@@ -24,13 +44,43 @@ func NewAccountRepository(pool *pgxpool.Pool) *AccountRepositoryPgx {
 	return &AccountRepositoryPgx{pool: pool}
 }
 
+const accountColumns = `id, balance, held_amount, currency, user_id, status, overdraft_limit, overdraft_rate,
+	coalesce(overdraft_accrued_at, 0), created_at, coalesce(closed_at, 0)`
+
+func scanAccount(row pgx.Row) (entities.Account, error) {
+	var account entities.Account
+
+	err := row.Scan(
+		&account.ID,
+		&account.Balance,
+		&account.HeldAmount,
+		&account.Currency,
+		&account.UserID,
+		&account.Status,
+		&account.OverdraftLimit,
+		&account.OverdraftRate,
+		&account.OverdraftAccruedAt,
+		&account.CreatedAt,
+		&account.ClosedAt,
+	)
+	if err != nil {
+		return entities.Account{}, err
+	}
+
+	account.AvailableBalance = account.Balance - account.HeldAmount
+
+	return account, nil
+}
+
 func (this *AccountRepositoryPgx) Create(ctx context.Context, data entities.Account) (string, error) {
 	_, err := this.pool.Exec(
 		ctx,
-		"insert into accounts (id, balance, user_id, created_at) values ($1, $2, $3, $4)",
+		"insert into accounts (id, balance, currency, user_id, status, created_at) values ($1, $2, $3, $4, $5, $6)",
 		data.ID,
 		data.Balance,
+		data.Currency,
 		data.UserID,
+		data.Status,
 		data.CreatedAt,
 	)
 
@@ -44,7 +94,7 @@ func (this *AccountRepositoryPgx) Create(ctx context.Context, data entities.Acco
 func (this *AccountRepositoryPgx) GetAll(ctx context.Context, userId string) ([]entities.Account, error) {
 	rows, err := this.pool.Query(
 		ctx,
-		"select id, balance, user_id, created_at from accounts where user_id = $1",
+		"select "+accountColumns+" from accounts where user_id = $1",
 		userId,
 	)
 	defer rows.Close()
@@ -56,14 +106,7 @@ func (this *AccountRepositoryPgx) GetAll(ctx context.Context, userId string) ([]
 	var accounts []entities.Account
 
 	for rows.Next() {
-		var account entities.Account
-		err := rows.Scan(
-			&account.ID,
-			&account.Balance,
-			&account.UserID,
-			&account.CreatedAt,
-		)
-
+		account, err := scanAccount(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -81,84 +124,273 @@ func (this *AccountRepositoryPgx) GetAll(ctx context.Context, userId string) ([]
 func (this *AccountRepositoryPgx) GetById(ctx context.Context, id string) (entities.Account, error) {
 	row := this.pool.QueryRow(
 		ctx,
-		"select id, balance, user_id, created_at from accounts where id = $1",
+		"select "+accountColumns+" from accounts where id = $1",
 		id,
 	)
 
-	var account entities.Account
-	err := row.Scan(
-		&account.ID,
-		&account.Balance,
-		&account.UserID,
-		&account.CreatedAt,
-	)
+	return scanAccount(row)
+}
 
+// UpdateStatus moves the account from one status to another, e.g. freezes an
+// active account. It returns ErrAccountStatusChanged when the account is not in from.
+func (this *AccountRepositoryPgx) UpdateStatus(ctx context.Context, id string, from string, to string) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		"update accounts set status = $1 where id = $2 and status = $3",
+		to,
+		id,
+		from,
+	)
 	if err != nil {
-		return entities.Account{}, err
+		return err
 	}
 
-	return account, nil
+	if tag.RowsAffected() == 0 {
+		return ErrAccountStatusChanged
+	}
+
+	return nil
 }
 
-func (this *AccountRepositoryPgx) UpdateBalance(ctx context.Context, id string, newBalance int64) error {
-	_, err := this.pool.Exec(
+// Close closes an account with zero balance, no card holds and no unpaid
+// loans together with its cards, and cancels standing orders from or to it.
+// The account is locked while it is checked, so no posting can change its
+// balance before it is closed. Its cards are locked before it, the order in
+// which card payments lock a card and its account, so a payment and the
+// closing cannot deadlock.
+func (this *AccountRepositoryPgx) Close(ctx context.Context, id string, closedAt int64) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
 		ctx,
-		"update accounts set balance = $1 where id = $2",
-		newBalance,
+		"select id from cards where account_id = $1 order by id for update",
 		id,
 	)
+	if err != nil {
+		return err
+	}
 
+	accounts, err := lockAccounts(ctx, tx, []string{id})
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	account := accounts[id]
+	if account.Status == "closed" {
+		return ErrAccountClosed
+	}
+	if account.Balance != 0 {
+		return ErrAccountNotEmpty
+	}
+	if account.HeldAmount != 0 {
+		return ErrAccountHasHolds
+	}
 
-func (this *AccountRepositoryPgx) Delete(ctx context.Context, id string) (string, error) {
-	_, err := this.pool.Exec(
+	var hasActiveLoans bool
+	err = tx.QueryRow(
 		ctx,
-		"delete from accounts where id = $1",
+		`select exists (
+			select 1 from payments p join loans l on l.id = p.loan_id
+			where l.account_id = $1 and not p.is_paid
+		)`,
+		id,
+	).Scan(&hasActiveLoans)
+	if err != nil {
+		return err
+	}
+	if hasActiveLoans {
+		return ErrAccountHasActiveLoans
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"update accounts set status = 'closed', closed_at = $1 where id = $2",
+		closedAt,
 		id,
 	)
+	if err != nil {
+		return err
+	}
 
+	_, err = tx.Exec(
+		ctx,
+		"update cards set status = 'closed', closed_at = $1 where account_id = $2 and status <> 'closed'",
+		closedAt,
+		id,
+	)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`update standing_orders set status = 'cancelled', updated_at = $1
+		where (from_account_id = $2 or to_account_id = $2) and status in ('active', 'paused')`,
+		closedAt,
+		id,
+	)
+	if err != nil {
+		return err
 	}
 
-	return id, nil
+	return tx.Commit(ctx)
 }
 
-func (this *AccountRepositoryPgx) Transfer(ctx context.Context, fromId string, toId string, amount int64) error {
+// SetOverdraft changes the overdraft of an account. The limit may not be
+// lowered below the amount the account is already overdrawn by, counting holds.
+func (this *AccountRepositoryPgx) SetOverdraft(ctx context.Context, id string, limit int64, rate float64) error {
 	tx, err := this.pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
+	accounts, err := lockAccounts(ctx, tx, []string{id})
+	if err != nil {
+		return err
+	}
+
+	account := accounts[id]
+	if account.Status == "closed" {
+		return ErrAccountClosed
+	}
+	if account.AvailableBalance < -limit {
+		return ErrOverdraftInUse
+	}
+
 	_, err = tx.Exec(
 		ctx,
-		"update accounts set balance = balance - $1 where id = $2",
-		amount,
-		fromId,
+		"update accounts set overdraft_limit = $1, overdraft_rate = $2 where id = $3",
+		limit,
+		rate,
+		id,
 	)
 	if err != nil {
-		println("first")
 		return err
 	}
 
-	_, err = tx.Exec(
+	return tx.Commit(ctx)
+}
+
+// GetOverdrawn returns open accounts with a negative balance.
+func (this *AccountRepositoryPgx) GetOverdrawn(ctx context.Context) ([]entities.Account, error) {
+	rows, err := this.pool.Query(
 		ctx,
-		"update accounts set balance = balance + $1 where id = $2",
-		amount,
-		toId,
+		"select "+accountColumns+" from accounts where balance < 0 and status <> 'closed'",
 	)
 	if err != nil {
-		println("second")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []entities.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// AccrueOverdraftInterest records the interest charged for the period from
+// fromTime to toTime. Nothing is charged when interest has been accrued since
+// fromTime, e.g. by another instance of the scheduler.
+func (this *AccountRepositoryPgx) AccrueOverdraftInterest(
+	ctx context.Context,
+	transaction entities.Transaction,
+	entry entities.JournalEntry,
+	fromTime int64,
+	toTime int64,
+) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	tx.Commit(ctx)
+	tag, err := tx.Exec(
+		ctx,
+		"update accounts set overdraft_accrued_at = $1 where id = $2 and coalesce(overdraft_accrued_at, 0) = $3",
+		toTime,
+		transaction.FromAccountId,
+		fromTime,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
 
-	return nil
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockAccounts locks the accounts for the rest of tx and returns them by id.
+// Rows are always locked in id order, so transactions touching the same
+// accounts wait for each other instead of deadlocking.
+func lockAccounts(ctx context.Context, tx pgx.Tx, ids []string) (map[string]entities.Account, error) {
+	sortedIds := slices.Clone(ids)
+	slices.Sort(sortedIds)
+
+	rows, err := tx.Query(
+		ctx,
+		"select "+accountColumns+" from accounts where id = any($1) order by id for update",
+		sortedIds,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[string]entities.Account, len(ids))
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts[account.ID] = account
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, ok := accounts[id]; !ok {
+			return nil, ErrAccountNotFound
+		}
+	}
+
+	return accounts, nil
+}
+
+// changeBalance adds change at the time at to the balance of an account
+// locked by lockAccounts. When the account becomes overdrawn, overdraft
+// interest starts to accrue at that time.
+func changeBalance(ctx context.Context, tx pgx.Tx, id string, change int64, at int64) error {
+	_, err := tx.Exec(
+		ctx,
+		`update accounts set
+				balance = balance + $1,
+				overdraft_accrued_at = case when balance >= 0 and balance + $1 < 0 then $3 else overdraft_accrued_at end
+		where id = $2`,
+		change,
+		id,
+		at,
+	)
+
+	return err
 }
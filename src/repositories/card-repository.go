@@ -3,13 +3,42 @@ package repositories
 import (
 	"bank-system/src/entities"
 	"context"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrCardStatusChanged means the card is no longer in the status the change expects
+var ErrCardStatusChanged = errors.New("Card status has changed")
+
+// ErrCardNotFound is returned when no card has the number looked up
+var ErrCardNotFound = errors.New("Card not found")
+
+var (
+	ErrCardDailyLimitExceeded   = errors.New("Daily limit of the card exceeded")
+	ErrCardMonthlyLimitExceeded = errors.New("Monthly limit of the card exceeded")
+	// ErrCardBlocked and ErrCardClosed are returned when a card is blocked or
+	// closed by the time a payment by it is recorded.
+	ErrCardBlocked = errors.New("Card is blocked")
+	ErrCardClosed  = errors.New("Card is closed")
+)
+
 type CardRepository interface {
 	Create(ctx context.Context, data entities.Card) (string, error)
 	GetById(ctx context.Context, id string) (entities.Card, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.Card, error)
+	GetByNumberHash(ctx context.Context, numberHash string) (entities.Card, error)
+	SetNumberIndex(ctx context.Context, id string, numberHash string, last4 string) error
+	UpdateStatus(ctx context.Context, id string, from string, to string) error
+	Close(ctx context.Context, id string, closedAt int64) error
+	Reissue(ctx context.Context, id string, data entities.Card) error
+	UpdateControls(ctx context.Context, id string, controls entities.CardControls) error
+	Pay(ctx context.Context, id string, transaction entities.Transaction, entry entities.JournalEntry) error
+	SetEncryption(ctx context.Context, id string, data entities.Card) error
+	GetWithStaleKey(ctx context.Context, keyId string) ([]entities.Card, error)
+	RewrapKey(ctx context.Context, id string, fromKeyId string, dataKey []byte, keyId string) error
 }
 
 type CardRepositoryPgx struct {
@@ -20,19 +49,37 @@ func NewCardRepository(pool *pgxpool.Pool) *CardRepositoryPgx {
 	return &CardRepositoryPgx{pool: pool}
 }
 
-func (this *CardRepositoryPgx) Create(ctx context.Context, data entities.Card) (string, error) {
-	_, err := this.pool.Exec(
+func createCard(ctx context.Context, db executor, data entities.Card) error {
+	_, err := db.Exec(
 		ctx,
-		"insert into cards (id, number, expiration, cvv, user_id, account_id, created_at) values ($1, $2, $3, $4, $5, $6, $7)",
+		`insert into cards (id, number, number_hash, expiration, cvv, data_key, key_id, last4, user_id, account_id, status, reissued_from,
+			single_limit, daily_limit, monthly_limit, online_enabled, blocked_mccs, created_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
 		data.ID,
 		data.Number,
+		data.NumberHash,
 		data.Expiration,
 		data.CVV,
+		data.DataKey,
+		data.KeyId,
+		data.Last4,
 		data.UserId,
 		data.AccountID,
+		data.Status,
+		nullableString(data.ReissuedFrom),
+		data.Controls.SingleLimit,
+		data.Controls.DailyLimit,
+		data.Controls.MonthlyLimit,
+		data.Controls.OnlineEnabled,
+		data.Controls.BlockedMccs,
 		data.CreatedAt,
 	)
 
+	return err
+}
+
+func (this *CardRepositoryPgx) Create(ctx context.Context, data entities.Card) (string, error) {
+	err := createCard(ctx, this.pool, data)
 	if err != nil {
 		return "", err
 	}
@@ -40,27 +87,338 @@ func (this *CardRepositoryPgx) Create(ctx context.Context, data entities.Card) (
 	return data.ID, nil
 }
 
-func (this *CardRepositoryPgx) GetById(ctx context.Context, id string) (entities.Card, error) {
-	row := this.pool.QueryRow(
-		ctx,
-		"select id, number, expiration, cvv, user_id, account_id, created_at from cards where id = $1",
-		id,
-	)
+const cardColumns = `id, number, coalesce(number_hash, ''), expiration, cvv, data_key, coalesce(key_id, ''),
+	coalesce(last4, ''), user_id, account_id,
+	status, coalesce(reissued_from, ''), single_limit, daily_limit, monthly_limit, online_enabled, blocked_mccs,
+	created_at, coalesce(closed_at, 0)`
 
+func scanCard(row pgx.Row) (entities.Card, error) {
 	var card entities.Card
+
 	err := row.Scan(
 		&card.ID,
 		&card.Number,
+		&card.NumberHash,
 		&card.Expiration,
 		&card.CVV,
+		&card.DataKey,
+		&card.KeyId,
+		&card.Last4,
 		&card.UserId,
 		&card.AccountID,
+		&card.Status,
+		&card.ReissuedFrom,
+		&card.Controls.SingleLimit,
+		&card.Controls.DailyLimit,
+		&card.Controls.MonthlyLimit,
+		&card.Controls.OnlineEnabled,
+		&card.Controls.BlockedMccs,
 		&card.CreatedAt,
+		&card.ClosedAt,
 	)
-
 	if err != nil {
 		return entities.Card{}, err
 	}
 
 	return card, nil
 }
+
+func scanCards(rows pgx.Rows) ([]entities.Card, error) {
+	defer rows.Close()
+
+	var cards []entities.Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, card)
+	}
+
+	return cards, nil
+}
+
+func (this *CardRepositoryPgx) GetById(ctx context.Context, id string) (entities.Card, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+cardColumns+" from cards where id = $1",
+		id,
+	)
+
+	return scanCard(row)
+}
+
+func (this *CardRepositoryPgx) GetByUserId(ctx context.Context, userId string) ([]entities.Card, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+cardColumns+" from cards where user_id = $1 order by created_at desc",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCards(rows)
+}
+
+// GetByNumberHash returns the card with the number hash or ErrCardNotFound.
+func (this *CardRepositoryPgx) GetByNumberHash(ctx context.Context, numberHash string) (entities.Card, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+cardColumns+" from cards where number_hash = $1",
+		numberHash,
+	)
+
+	card, err := scanCard(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entities.Card{}, ErrCardNotFound
+	}
+
+	return card, err
+}
+
+// SetEncryption stores the number and the expiration date of a card encrypted
+// with a key supplied by the client re-encrypted with a data key.
+func (this *CardRepositoryPgx) SetEncryption(ctx context.Context, id string, data entities.Card) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"update cards set number = $1, expiration = $2, data_key = $3, key_id = $4 where id = $5 and key_id is null",
+		data.Number,
+		data.Expiration,
+		data.DataKey,
+		data.KeyId,
+		id,
+	)
+
+	return err
+}
+
+// GetWithStaleKey returns the cards whose data keys are wrapped with a master
+// key other than keyId.
+func (this *CardRepositoryPgx) GetWithStaleKey(ctx context.Context, keyId string) ([]entities.Card, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+cardColumns+" from cards where key_id is not null and key_id <> $1",
+		keyId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCards(rows)
+}
+
+// RewrapKey replaces the data key of the card wrapped with the master key
+// fromKeyId by the same data key wrapped with the master key keyId. A card
+// already rewrapped, e.g. by another instance, is left as is.
+func (this *CardRepositoryPgx) RewrapKey(ctx context.Context, id string, fromKeyId string, dataKey []byte, keyId string) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"update cards set data_key = $1, key_id = $2 where id = $3 and key_id = $4",
+		dataKey,
+		keyId,
+		id,
+		fromKeyId,
+	)
+
+	return err
+}
+
+// SetNumberIndex stores the hash and the last digits of the number of a card
+// issued before they were kept.
+func (this *CardRepositoryPgx) SetNumberIndex(ctx context.Context, id string, numberHash string, last4 string) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"update cards set number_hash = $1, last4 = $2 where id = $3 and number_hash is null",
+		numberHash,
+		last4,
+		id,
+	)
+
+	return err
+}
+
+// UpdateStatus moves the card from one status to another, e.g. blocks an
+// active card. It returns ErrCardStatusChanged when the card is not in from.
+func (this *CardRepositoryPgx) UpdateStatus(ctx context.Context, id string, from string, to string) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		"update cards set status = $1 where id = $2 and status = $3",
+		to,
+		id,
+		from,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrCardStatusChanged
+	}
+
+	return nil
+}
+
+func closeCard(ctx context.Context, db executor, id string, closedAt int64) error {
+	tag, err := db.Exec(
+		ctx,
+		"update cards set status = 'closed', closed_at = $1 where id = $2 and status <> 'closed'",
+		closedAt,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrCardStatusChanged
+	}
+
+	return nil
+}
+
+// Close closes an active or blocked card for good.
+func (this *CardRepositoryPgx) Close(ctx context.Context, id string, closedAt int64) error {
+	return closeCard(ctx, this.pool, id, closedAt)
+}
+
+// Reissue closes the card and creates its replacement in one database transaction.
+func (this *CardRepositoryPgx) Reissue(ctx context.Context, id string, data entities.Card) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = closeCard(ctx, tx, id, data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = createCard(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateControls replaces the spending rules of an active or blocked card.
+func (this *CardRepositoryPgx) UpdateControls(ctx context.Context, id string, controls entities.CardControls) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		`update cards set single_limit = $1, daily_limit = $2, monthly_limit = $3, online_enabled = $4, blocked_mccs = $5
+			where id = $6 and status <> 'closed'`,
+		controls.SingleLimit,
+		controls.DailyLimit,
+		controls.MonthlyLimit,
+		controls.OnlineEnabled,
+		controls.BlockedMccs,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrCardStatusChanged
+	}
+
+	return nil
+}
+
+// Pay records a payment by the card once it is checked against the daily and
+// monthly limits of the card.
+func (this *CardRepositoryPgx) Pay(ctx context.Context, id string, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = checkCardSpending(ctx, tx, id, transaction.Amount, transaction.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkCardSpending locks the card and checks that it is still active and
+// that spending amount at createdAt keeps the card within its daily and
+// monthly limits. The status is checked again under the lock, since the card
+// may be blocked or closed after it was verified. Payments and authorized
+// holds of the card since the local midnight of the day and of the first day
+// of the month count towards the limits. The card stays locked until the
+// transaction ends, so concurrent payments are checked one by one. It must be
+// called before the account of the card is locked: cards are always locked
+// before accounts.
+func checkCardSpending(ctx context.Context, tx pgx.Tx, id string, amount int64, createdAt int64) error {
+	var status string
+	var dailyLimit, monthlyLimit int64
+	err := tx.QueryRow(
+		ctx,
+		"select status, daily_limit, monthly_limit from cards where id = $1 for update",
+		id,
+	).Scan(&status, &dailyLimit, &monthlyLimit)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case "blocked":
+		return ErrCardBlocked
+	case "closed":
+		return ErrCardClosed
+	}
+
+	at := time.Unix(createdAt, 0)
+
+	if dailyLimit > 0 {
+		dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+		spent, err := cardSpent(ctx, tx, id, dayStart.Unix())
+		if err != nil {
+			return err
+		}
+
+		if spent+amount > dailyLimit {
+			return ErrCardDailyLimitExceeded
+		}
+	}
+
+	if monthlyLimit > 0 {
+		monthStart := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, at.Location())
+		spent, err := cardSpent(ctx, tx, id, monthStart.Unix())
+		if err != nil {
+			return err
+		}
+
+		if spent+amount > monthlyLimit {
+			return ErrCardMonthlyLimitExceeded
+		}
+	}
+
+	return nil
+}
+
+// cardSpent sums the payments and the authorized holds of the card since the time.
+func cardSpent(ctx context.Context, tx pgx.Tx, id string, since int64) (int64, error) {
+	var spent int64
+	err := tx.QueryRow(
+		ctx,
+		`select (
+			coalesce((select sum(amount) from transactions where card_id = $1 and type = 'payment' and created_at >= $2), 0)
+			+ coalesce((select sum(amount) from holds where card_id = $1 and status = 'authorized' and created_at >= $2), 0)
+		)::bigint`,
+		id,
+		since,
+	).Scan(&spent)
+
+	return spent, err
+}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ExchangeRateRepository interface {
+	CreateMany(ctx context.Context, data []entities.ExchangeRate) error
+	GetLatest(ctx context.Context) ([]entities.ExchangeRate, error)
+}
+
+type ExchangeRateRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewExchangeRateRepository(pool *pgxpool.Pool) *ExchangeRateRepositoryPgx {
+	return &ExchangeRateRepositoryPgx{pool: pool}
+}
+
+func (this *ExchangeRateRepositoryPgx) CreateMany(ctx context.Context, data []entities.ExchangeRate) error {
+	batch := new(pgx.Batch)
+
+	for _, rate := range data {
+		batch.Queue(
+			"insert into exchange_rates (currency, rate, fetched_at) values ($1, $2, $3) on conflict do nothing",
+			rate.Currency,
+			rate.Rate,
+			rate.FetchedAt,
+		)
+	}
+
+	return this.pool.SendBatch(ctx, batch).Close()
+}
+
+// GetLatest returns the most recently fetched rate of every currency.
+func (this *ExchangeRateRepositoryPgx) GetLatest(ctx context.Context) ([]entities.ExchangeRate, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select distinct on (currency) currency, rate, fetched_at
+			from exchange_rates
+		order by currency, fetched_at desc`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []entities.ExchangeRate
+	for rows.Next() {
+		var rate entities.ExchangeRate
+
+		err = rows.Scan(
+			&rate.Currency,
+			&rate.Rate,
+			&rate.FetchedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// executor is implemented by both *pgxpool.Pool and pgx.Tx, so helpers
+// can be shared between plain queries and multi-statement transactions.
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
@@ -0,0 +1,276 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrHoldNotAuthorized is returned when a hold has been captured, voided or
+	// has expired by the time it is captured or released.
+	ErrHoldNotAuthorized = errors.New("Hold is no longer authorized")
+	// ErrHoldExists is returned when a hold with the same id has already been
+	// authorized, e.g. by an earlier attempt of the same request.
+	ErrHoldExists = errors.New("Hold has already been authorized")
+)
+
+type HoldRepository interface {
+	Authorize(ctx context.Context, data entities.Hold) error
+	GetById(ctx context.Context, id string) (entities.Hold, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.Hold, error)
+	Capture(ctx context.Context, data entities.Hold, transaction entities.Transaction, entry entities.JournalEntry) error
+	Release(ctx context.Context, data entities.Hold) error
+	GetExpired(ctx context.Context, now int64) ([]entities.Hold, error)
+}
+
+type HoldRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewHoldRepository(pool *pgxpool.Pool) *HoldRepositoryPgx {
+	return &HoldRepositoryPgx{pool: pool}
+}
+
+const holdColumns = `id, card_id, account_id, user_id, amount, captured_amount, currency, description, status,
+	coalesce(transaction_id, ''), expires_at, created_at, updated_at`
+
+func scanHold(row pgx.Row) (entities.Hold, error) {
+	var hold entities.Hold
+
+	err := row.Scan(
+		&hold.ID,
+		&hold.CardId,
+		&hold.AccountId,
+		&hold.UserId,
+		&hold.Amount,
+		&hold.CapturedAmount,
+		&hold.Currency,
+		&hold.Description,
+		&hold.Status,
+		&hold.TransactionId,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&hold.UpdatedAt,
+	)
+	if err != nil {
+		return entities.Hold{}, err
+	}
+
+	return hold, nil
+}
+
+func scanHolds(rows pgx.Rows) ([]entities.Hold, error) {
+	defer rows.Close()
+
+	var holds []entities.Hold
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		holds = append(holds, hold)
+	}
+
+	return holds, nil
+}
+
+// changeHeldAmount adds change to the amount held on an account locked by lockAccounts.
+func changeHeldAmount(ctx context.Context, tx pgx.Tx, id string, change int64) error {
+	_, err := tx.Exec(
+		ctx,
+		"update accounts set held_amount = held_amount + $1 where id = $2",
+		change,
+		id,
+	)
+
+	return err
+}
+
+// Authorize reserves the amount of the hold on its account. The available
+// balance is checked under the account lock like for a debit, so holds and
+// postings cannot together take it below the overdraft limit. The hold counts
+// towards the daily and monthly limits of the card like a payment.
+func (this *HoldRepositoryPgx) Authorize(ctx context.Context, data entities.Hold) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = checkCardSpending(ctx, tx, data.CardId, data.Amount, data.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := lockAccounts(ctx, tx, []string{data.AccountId})
+	if err != nil {
+		return err
+	}
+
+	account := accounts[data.AccountId]
+	switch {
+	case account.Status == "closed":
+		return ErrAccountClosed
+	case account.Status == "frozen":
+		return ErrAccountFrozen
+	case account.Currency != data.Currency:
+		return ErrCurrencyMismatch
+	case account.AvailableBalance-data.Amount < -account.OverdraftLimit:
+		return ErrInsufficientFunds
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into holds (id, card_id, account_id, user_id, amount, currency, description, status, expires_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		data.ID,
+		data.CardId,
+		data.AccountId,
+		data.UserId,
+		data.Amount,
+		data.Currency,
+		data.Description,
+		data.Status,
+		data.ExpiresAt,
+		data.CreatedAt,
+		data.UpdatedAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "holds_pkey" {
+		return ErrHoldExists
+	}
+	if err != nil {
+		return err
+	}
+
+	err = changeHeldAmount(ctx, tx, data.AccountId, data.Amount)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (this *HoldRepositoryPgx) GetById(ctx context.Context, id string) (entities.Hold, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+holdColumns+" from holds where id = $1",
+		id,
+	)
+
+	return scanHold(row)
+}
+
+func (this *HoldRepositoryPgx) GetByUserId(ctx context.Context, userId string) ([]entities.Hold, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+holdColumns+" from holds where user_id = $1 order by created_at desc",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanHolds(rows)
+}
+
+// release marks an authorized hold with the status of data and returns its
+// amount to the available balance of the locked account. A hold is captured
+// only before it expires.
+func release(ctx context.Context, tx pgx.Tx, data entities.Hold) error {
+	tag, err := tx.Exec(
+		ctx,
+		`update holds set status = $1, captured_amount = $2, updated_at = $3
+		where id = $4 and status = 'authorized' and ($1 <> 'captured' or expires_at > $3)`,
+		data.Status,
+		data.CapturedAmount,
+		data.UpdatedAt,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHoldNotAuthorized
+	}
+
+	return changeHeldAmount(ctx, tx, data.AccountId, -data.Amount)
+}
+
+// Capture debits the captured amount of the hold and releases the rest of it
+// in one database transaction.
+func (this *HoldRepositoryPgx) Capture(ctx context.Context, data entities.Hold, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = lockAccounts(ctx, tx, []string{data.AccountId})
+	if err != nil {
+		return err
+	}
+
+	err = release(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"update holds set transaction_id = $1 where id = $2",
+		transaction.ID,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Release voids or expires the hold, depending on the status of data.
+func (this *HoldRepositoryPgx) Release(ctx context.Context, data entities.Hold) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = lockAccounts(ctx, tx, []string{data.AccountId})
+	if err != nil {
+		return err
+	}
+
+	err = release(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetExpired returns authorized holds that have expired by now.
+func (this *HoldRepositoryPgx) GetExpired(ctx context.Context, now int64) ([]entities.Hold, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+holdColumns+" from holds where status = 'authorized' and expires_at <= $1 order by expires_at",
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanHolds(rows)
+}
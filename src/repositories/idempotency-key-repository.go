@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrIdempotencyKeyLost is returned when a request completes after its
+// reservation of the key has expired and been taken by a retry.
+var ErrIdempotencyKeyLost = errors.New("Idempotency key reservation has expired")
+
+type IdempotencyKeyRepository interface {
+	Reserve(ctx context.Context, data entities.IdempotencyKey, staleBefore int64) (bool, error)
+	Get(ctx context.Context, userId string, key string) (entities.IdempotencyKey, error)
+	Complete(ctx context.Context, data entities.IdempotencyKey) error
+	Release(ctx context.Context, data entities.IdempotencyKey) error
+}
+
+type IdempotencyKeyRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyKeyRepository(pool *pgxpool.Pool) *IdempotencyKeyRepositoryPgx {
+	return &IdempotencyKeyRepositoryPgx{pool: pool}
+}
+
+// Reserve stores a pending key and reports false if the user has already used
+// it. A key left pending by the same request since before staleBefore is
+// reserved again.
+func (this *IdempotencyKeyRepositoryPgx) Reserve(ctx context.Context, data entities.IdempotencyKey, staleBefore int64) (bool, error) {
+	result, err := this.pool.Exec(
+		ctx,
+		`insert into idempotency_keys (user_id, key, request_hash, status, created_at)
+			values ($1, $2, $3, 'pending', $4)
+		on conflict (user_id, key) do update set created_at = excluded.created_at
+			where idempotency_keys.status = 'pending' and idempotency_keys.request_hash = excluded.request_hash
+				and idempotency_keys.created_at < $5`,
+		data.UserId,
+		data.Key,
+		data.RequestHash,
+		data.CreatedAt,
+		staleBefore,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (this *IdempotencyKeyRepositoryPgx) Get(ctx context.Context, userId string, key string) (entities.IdempotencyKey, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		`select user_id, key, request_hash, status, coalesce(status_code, 0), coalesce(content_type, ''),
+			coalesce(response, ''::bytea), created_at, coalesce(completed_at, 0)
+			from idempotency_keys
+		where user_id = $1 and key = $2`,
+		userId,
+		key,
+	)
+
+	var idempotencyKey entities.IdempotencyKey
+	err := row.Scan(
+		&idempotencyKey.UserId,
+		&idempotencyKey.Key,
+		&idempotencyKey.RequestHash,
+		&idempotencyKey.Status,
+		&idempotencyKey.StatusCode,
+		&idempotencyKey.ContentType,
+		&idempotencyKey.Response,
+		&idempotencyKey.CreatedAt,
+		&idempotencyKey.CompletedAt,
+	)
+	if err != nil {
+		return entities.IdempotencyKey{}, err
+	}
+
+	return idempotencyKey, nil
+}
+
+// Complete stores the response of the request holding the reservation made
+// at data.CreatedAt. It fails with ErrIdempotencyKeyLost when the reservation
+// has expired and another request has reserved the key since.
+func (this *IdempotencyKeyRepositoryPgx) Complete(ctx context.Context, data entities.IdempotencyKey) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		`update idempotency_keys
+			set status = 'completed', status_code = $1, content_type = $2, response = $3, completed_at = $4
+		where user_id = $5 and key = $6 and status = 'pending' and created_at = $7`,
+		data.StatusCode,
+		data.ContentType,
+		data.Response,
+		data.CompletedAt,
+		data.UserId,
+		data.Key,
+		data.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrIdempotencyKeyLost
+	}
+
+	return nil
+}
+
+// Release deletes the reservation made at data.CreatedAt, so the request can
+// be retried with the same key.
+func (this *IdempotencyKeyRepositoryPgx) Release(ctx context.Context, data entities.IdempotencyKey) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"delete from idempotency_keys where user_id = $1 and key = $2 and status = 'pending' and created_at = $3",
+		data.UserId,
+		data.Key,
+		data.CreatedAt,
+	)
+
+	return err
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type KeyRateRepository interface {
+	Create(ctx context.Context, data entities.KeyRate) (string, error)
+	GetLatest(ctx context.Context) (entities.KeyRate, error)
+}
+
+type KeyRateRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewKeyRateRepository(pool *pgxpool.Pool) *KeyRateRepositoryPgx {
+	return &KeyRateRepositoryPgx{pool: pool}
+}
+
+func (this *KeyRateRepositoryPgx) Create(ctx context.Context, data entities.KeyRate) (string, error) {
+	_, err := this.pool.Exec(
+		ctx,
+		"insert into key_rates (id, rate, fetched_at) values ($1, $2, $3)",
+		data.ID,
+		data.Rate,
+		data.FetchedAt,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+func (this *KeyRateRepositoryPgx) GetLatest(ctx context.Context) (entities.KeyRate, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select id, rate, fetched_at from key_rates order by fetched_at desc limit 1",
+	)
+
+	var keyRate entities.KeyRate
+	err := row.Scan(
+		&keyRate.ID,
+		&keyRate.Rate,
+		&keyRate.FetchedAt,
+	)
+
+	if err != nil {
+		return entities.KeyRate{}, err
+	}
+
+	return keyRate, nil
+}
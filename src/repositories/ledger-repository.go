@@ -0,0 +1,370 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New("Journal entry is not balanced")
+	ErrAccountNotFound = errors.New("Account not found")
+	// ErrCurrencyMismatch means a journal entry posts to an account in another currency
+	ErrCurrencyMismatch = errors.New("Account currency does not match the entry currency")
+)
+
+type LedgerRepository interface {
+	Record(ctx context.Context, transaction entities.Transaction, entry entities.JournalEntry) error
+	RecordLinked(ctx context.Context, transactions []entities.Transaction, entries []entities.JournalEntry) error
+	GetAccounts(ctx context.Context) ([]entities.LedgerAccount, error)
+	GetTrialBalance(ctx context.Context) ([]entities.TrialBalance, error)
+	GetAccountBalance(ctx context.Context, accountId string, before int64) (int64, error)
+	GetAccountMovements(ctx context.Context, accountId string, from int64, to int64) ([]entities.StatementLine, error)
+}
+
+type LedgerRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewLedgerRepository(pool *pgxpool.Pool) *LedgerRepositoryPgx {
+	return &LedgerRepositoryPgx{pool: pool}
+}
+
+// Record stores the transaction together with its journal entry and applies
+// the postings to account balances in one database transaction.
+func (this *LedgerRepositoryPgx) Record(ctx context.Context, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RecordLinked stores transactions that are legs of one operation, e.g. both
+// sides of a currency conversion, with their entries in one database
+// transaction. The customer accounts of all entries are locked up front so
+// the legs cannot deadlock with another operation on the same accounts.
+func (this *LedgerRepositoryPgx) RecordLinked(ctx context.Context, transactions []entities.Transaction, entries []entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var customerIds []string
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if !entities.IsLedgerAccount(posting.AccountId) && !slices.Contains(customerIds, posting.AccountId) {
+				customerIds = append(customerIds, posting.AccountId)
+			}
+		}
+	}
+
+	_, err = lockAccounts(ctx, tx, customerIds)
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err = createTransaction(ctx, tx, transaction)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		err = postJournalEntry(ctx, tx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAccounts returns the balance of every bank-side account in every
+// currency it has been posted in.
+func (this *LedgerRepositoryPgx) GetAccounts(ctx context.Context) ([]entities.LedgerAccount, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select a.id, a.name, a.normal_side, b.currency, b.balance
+			from ledger_accounts a
+			join ledger_balances b on b.account_id = a.id
+		order by a.id, b.currency`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []entities.LedgerAccount
+	for rows.Next() {
+		var account entities.LedgerAccount
+
+		err = rows.Scan(
+			&account.ID,
+			&account.Name,
+			&account.NormalSide,
+			&account.Currency,
+			&account.Balance,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// GetTrialBalance totals postings per currency, since amounts in different
+// currencies cannot be added up.
+func (this *LedgerRepositoryPgx) GetTrialBalance(ctx context.Context) ([]entities.TrialBalance, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select
+			e.currency,
+			coalesce(sum(p.amount) filter (where p.side = 'debit'), 0),
+			coalesce(sum(p.amount) filter (where p.side = 'credit'), 0)
+		from postings p
+			join journal_entries e on e.id = p.entry_id
+		group by e.currency
+		order by e.currency`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trialBalances []entities.TrialBalance
+	for rows.Next() {
+		var trialBalance entities.TrialBalance
+
+		err = rows.Scan(
+			&trialBalance.Currency,
+			&trialBalance.Debit,
+			&trialBalance.Credit,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		trialBalance.IsBalanced = trialBalance.Debit == trialBalance.Credit
+		trialBalances = append(trialBalances, trialBalance)
+	}
+
+	return trialBalances, nil
+}
+
+// GetAccountBalance returns the balance of a customer account as of before,
+// summing the postings made to it earlier.
+func (this *LedgerRepositoryPgx) GetAccountBalance(ctx context.Context, accountId string, before int64) (int64, error) {
+	var balance int64
+
+	err := this.pool.QueryRow(
+		ctx,
+		`select coalesce(sum(case when p.side = 'credit' then p.amount else -p.amount end), 0)
+			from postings p
+			join journal_entries e on e.id = p.entry_id
+		where p.account_id = $1 and e.created_at < $2`,
+		accountId,
+		before,
+	).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// GetAccountMovements returns the transactions posted to a customer account
+// within [from, to) in posting order, each with its net effect on the
+// account. Balance of the lines is left for the caller to fill in.
+func (this *LedgerRepositoryPgx) GetAccountMovements(ctx context.Context, accountId string, from int64, to int64) ([]entities.StatementLine, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select t.id, t.type, t.description, coalesce(t.from_id, ''), coalesce(t.to_id, ''), e.created_at,
+				sum(case when p.side = 'credit' then p.amount else -p.amount end)
+			from postings p
+			join journal_entries e on e.id = p.entry_id
+			join transactions t on t.id = e.transaction_id
+		where p.account_id = $1 and e.created_at >= $2 and e.created_at < $3
+		group by t.id, t.type, t.description, t.from_id, t.to_id, e.created_at
+		order by e.created_at, min(p.id)`,
+		accountId,
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []entities.StatementLine
+	for rows.Next() {
+		var line entities.StatementLine
+		var fromId, toId string
+
+		err = rows.Scan(
+			&line.TransactionId,
+			&line.Type,
+			&line.Description,
+			&fromId,
+			&toId,
+			&line.CreatedAt,
+			&line.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		line.CounterpartyId = toId
+		if toId == accountId {
+			line.CounterpartyId = fromId
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// recordTransaction inserts the transaction and posts its journal entry within tx.
+func recordTransaction(ctx context.Context, tx pgx.Tx, transaction entities.Transaction, entry entities.JournalEntry) error {
+	err := createTransaction(ctx, tx, transaction)
+	if err != nil {
+		return err
+	}
+
+	return postJournalEntry(ctx, tx, entry)
+}
+
+// postJournalEntry inserts a balanced entry with its postings and updates the
+// balances of the accounts involved. Customer accounts are locked first and
+// bank accounts second, each in id order, and the balances are checked under
+// the lock, so a debit fails with ErrInsufficientFunds instead of taking the
+// available balance, net of card holds, below the overdraft limit even under
+// concurrent requests. Forced debits may exceed the limit and debit frozen
+// accounts, other debits of frozen accounts are rejected, and closed accounts
+// are not posted to at all. Customer accounts must be in the currency of the entry; bank
+// accounts keep a separate balance per currency.
+func postJournalEntry(ctx context.Context, tx pgx.Tx, entry entities.JournalEntry) error {
+	if !entry.IsBalanced() {
+		return ErrUnbalancedEntry
+	}
+
+	customerChanges := make(map[string]int64)
+	ledgerPostings := make(map[string][]entities.Posting)
+
+	for _, posting := range entry.Postings {
+		if entities.IsLedgerAccount(posting.AccountId) {
+			ledgerPostings[posting.AccountId] = append(ledgerPostings[posting.AccountId], posting)
+			continue
+		}
+
+		// Customer accounts are liabilities of the bank and grow on credit
+		if posting.Side == "credit" {
+			customerChanges[posting.AccountId] += posting.Amount
+		} else {
+			customerChanges[posting.AccountId] -= posting.Amount
+		}
+	}
+
+	customerIds := slices.Sorted(maps.Keys(customerChanges))
+
+	accounts, err := lockAccounts(ctx, tx, customerIds)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range customerIds {
+		if accounts[id].Status == "closed" {
+			return ErrAccountClosed
+		}
+		if accounts[id].Currency != entry.Currency {
+			return ErrCurrencyMismatch
+		}
+		// Credits are accepted even while the balance stays below the limit
+		if customerChanges[id] >= 0 || entry.Forced {
+			continue
+		}
+		if accounts[id].Status == "frozen" {
+			return ErrAccountFrozen
+		}
+		if accounts[id].AvailableBalance+customerChanges[id] < -accounts[id].OverdraftLimit {
+			return ErrInsufficientFunds
+		}
+	}
+
+	var nullableTransactionId *string
+	if entry.TransactionId != "" {
+		nullableTransactionId = &entry.TransactionId
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"insert into journal_entries (id, transaction_id, currency, description, created_at) values ($1, $2, $3, $4, $5)",
+		entry.ID,
+		nullableTransactionId,
+		entry.Currency,
+		entry.Description,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, posting := range entry.Postings {
+		_, err = tx.Exec(
+			ctx,
+			"insert into postings (entry_id, account_id, side, amount) values ($1, $2, $3, $4)",
+			entry.ID,
+			posting.AccountId,
+			posting.Side,
+			posting.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range customerIds {
+		err = changeBalance(ctx, tx, id, customerChanges[id], entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(ledgerPostings)) {
+		for _, posting := range ledgerPostings[id] {
+			_, err = tx.Exec(
+				ctx,
+				`insert into ledger_balances (account_id, currency, balance)
+					select id, $1, case when normal_side = $2 then $3 else -$3 end from ledger_accounts where id = $4
+				on conflict (account_id, currency) do update set balance = ledger_balances.balance + excluded.balance`,
+				entry.Currency,
+				posting.Side,
+				posting.Amount,
+				posting.AccountId,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package repositories
+
+import (
+	"bank-system/src/db"
+	"bank-system/src/entities"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to the database in TEST_DATABASE_URL and creates the
+// tables. The test is skipped when the variable is not set.
+func testPool(t *testing.T) *pgxpool.Pool {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("Failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	err = db.CreateTables(pool, ctx)
+	if err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+
+	return pool
+}
+
+// createTestAccounts creates a user with active ruble accounts holding
+// balance each, deleted with their transactions when the test ends.
+func createTestAccounts(t *testing.T, pool *pgxpool.Pool, count int, balance int64) []string {
+	ctx := context.Background()
+	userId := uuid.New().String()
+
+	_, err := pool.Exec(
+		ctx,
+		"insert into users (id, username, password, email) values ($1, $2, '', $3)",
+		userId,
+		"test-"+userId[:18],
+		"test-"+userId[:18]+"@example.com",
+	)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	ids := make([]string, 0, count)
+	accountRepository := NewAccountRepository(pool)
+	for range count {
+		id, err := accountRepository.Create(ctx, entities.Account{
+			ID:        uuid.New().String(),
+			Balance:   balance,
+			Currency:  entities.DefaultCurrency,
+			UserID:    userId,
+			Status:    "active",
+			CreatedAt: time.Now().Unix(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	t.Cleanup(func() {
+		_, err := pool.Exec(ctx, "delete from transactions where from_id = any($1) or to_id = any($1)", ids)
+		if err != nil {
+			t.Errorf("Failed to delete transactions: %v", err)
+		}
+
+		_, err = pool.Exec(ctx, "delete from users where id = $1", userId)
+		if err != nil {
+			t.Errorf("Failed to delete user: %v", err)
+		}
+	})
+
+	return ids
+}
+
+func testTransfer(from string, to string, amount int64) (entities.Transaction, entities.JournalEntry) {
+	transaction := entities.Transaction{
+		ID:            uuid.New().String(),
+		Amount:        amount,
+		Currency:      entities.DefaultCurrency,
+		FromAccountId: from,
+		ToAccountId:   to,
+		Type:          "transfer",
+		Description:   fmt.Sprintf("Test transfer of %d", amount),
+		CreatedAt:     time.Now().Unix(),
+	}
+
+	entry := entities.JournalEntry{
+		ID:            uuid.New().String(),
+		TransactionId: transaction.ID,
+		Currency:      transaction.Currency,
+		Description:   transaction.Description,
+		CreatedAt:     transaction.CreatedAt,
+	}
+	entry.Debit(from, amount)
+	entry.Credit(to, amount)
+
+	return transaction, entry
+}
+
+func TestRecordConcurrentTransfers(t *testing.T) {
+	pool := testPool(t)
+
+	const initialBalance = 1000
+	const transfers = 400
+
+	ids := createTestAccounts(t, pool, 2, initialBalance)
+	ledgerRepository := NewLedgerRepository(pool)
+
+	// A deadlock is detected by PostgreSQL and fails the transfer, a lock
+	// that is never released fails the test on the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// moved is the net amount transferred from the first account to the second
+	var moved atomic.Int64
+	var rejected atomic.Int64
+	errs := make(chan error, transfers)
+
+	var wg sync.WaitGroup
+	for i := range transfers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			from, to, sign := ids[0], ids[1], int64(1)
+			if i%2 == 1 {
+				from, to, sign = ids[1], ids[0], -1
+			}
+			amount := int64(1 + i*37%300)
+
+			transaction, entry := testTransfer(from, to, amount)
+			err := ledgerRepository.Record(ctx, transaction, entry)
+			if errors.Is(err, ErrInsufficientFunds) {
+				rejected.Add(1)
+				return
+			}
+			if err != nil {
+				errs <- fmt.Errorf("transfer %d from %s: %w", i, from, err)
+				return
+			}
+
+			moved.Add(sign * amount)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	if ctx.Err() != nil {
+		t.Fatalf("Transfers did not finish in time: %v", ctx.Err())
+	}
+	for err := range errs {
+		t.Errorf("Failed to record %v", err)
+	}
+
+	balances := make([]int64, len(ids))
+	for i, id := range ids {
+		var posted int64
+		err := pool.QueryRow(
+			context.Background(),
+			`select a.balance, coalesce(sum(case when p.side = 'credit' then p.amount else -p.amount end), 0)
+			from accounts a left join postings p on p.account_id = a.id
+			where a.id = $1 group by a.balance`,
+			id,
+		).Scan(&balances[i], &posted)
+		if err != nil {
+			t.Fatalf("Failed to get balance of %s: %v", id, err)
+		}
+
+		if balances[i] < 0 {
+			t.Errorf("Account %d has a negative balance %d", i, balances[i])
+		}
+		if balances[i] != initialBalance+posted {
+			t.Errorf("Account %d has balance %d, its postings add up to %d", i, balances[i], initialBalance+posted)
+		}
+	}
+
+	if sum := balances[0] + balances[1]; sum != 2*initialBalance {
+		t.Errorf("Balances sum to %d, want %d", sum, 2*initialBalance)
+	}
+	if balances[0] != initialBalance-moved.Load() {
+		t.Errorf("First account has balance %d, want %d", balances[0], initialBalance-moved.Load())
+	}
+
+	t.Logf("%d transfers recorded, %d rejected for insufficient funds", transfers-int(rejected.Load()), rejected.Load())
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLoanApplicationStatusChanged is returned when an application has left the
+// expected status before it could be updated, e.g. by a concurrent review.
+var ErrLoanApplicationStatusChanged = errors.New("Loan application status has changed")
+
+type LoanApplicationRepository interface {
+	Create(ctx context.Context, data entities.LoanApplication) (string, error)
+	GetById(ctx context.Context, id string) (entities.LoanApplication, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.LoanApplication, error)
+	GetAll(ctx context.Context, status string) ([]entities.LoanApplication, error)
+	Update(ctx context.Context, data entities.LoanApplication, fromStatuses []string) error
+}
+
+type LoanApplicationRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoanApplicationRepository(pool *pgxpool.Pool) *LoanApplicationRepositoryPgx {
+	return &LoanApplicationRepositoryPgx{pool: pool}
+}
+
+const loanApplicationColumns = "id, user_id, account_id, product_id, amount, term, schedule_type, status, coalesce(scoring_decision, ''), reasons, offered_amount, monthly_income, debt_to_income, approved_amount, coalesce(reviewed_by, ''), coalesce(loan_id, ''), created_at, updated_at"
+
+func scanLoanApplication(row pgx.Row) (entities.LoanApplication, error) {
+	var application entities.LoanApplication
+
+	err := row.Scan(
+		&application.ID,
+		&application.UserId,
+		&application.AccountId,
+		&application.ProductId,
+		&application.Amount,
+		&application.Term,
+		&application.ScheduleType,
+		&application.Status,
+		&application.ScoringDecision,
+		&application.Reasons,
+		&application.OfferedAmount,
+		&application.MonthlyIncome,
+		&application.DebtToIncome,
+		&application.ApprovedAmount,
+		&application.ReviewedBy,
+		&application.LoanId,
+		&application.CreatedAt,
+		&application.UpdatedAt,
+	)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	return application, nil
+}
+
+func nullableString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func (this *LoanApplicationRepositoryPgx) Create(ctx context.Context, data entities.LoanApplication) (string, error) {
+	_, err := this.pool.Exec(
+		ctx,
+		`insert into loan_applications (
+			id, user_id, account_id, product_id, amount, term, schedule_type, status, scoring_decision, reasons,
+			offered_amount, monthly_income, debt_to_income, approved_amount, reviewed_by, loan_id, created_at, updated_at
+		) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
+		data.ID,
+		data.UserId,
+		data.AccountId,
+		data.ProductId,
+		data.Amount,
+		data.Term,
+		data.ScheduleType,
+		data.Status,
+		nullableString(data.ScoringDecision),
+		data.Reasons,
+		data.OfferedAmount,
+		data.MonthlyIncome,
+		data.DebtToIncome,
+		data.ApprovedAmount,
+		nullableString(data.ReviewedBy),
+		nullableString(data.LoanId),
+		data.CreatedAt,
+		data.UpdatedAt,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+func (this *LoanApplicationRepositoryPgx) GetById(ctx context.Context, id string) (entities.LoanApplication, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+loanApplicationColumns+" from loan_applications where id = $1",
+		id,
+	)
+
+	return scanLoanApplication(row)
+}
+
+func (this *LoanApplicationRepositoryPgx) GetByUserId(ctx context.Context, userId string) ([]entities.LoanApplication, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanApplicationColumns+" from loan_applications where user_id = $1 order by created_at desc",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applications []entities.LoanApplication
+	for rows.Next() {
+		application, err := scanLoanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, application)
+	}
+
+	return applications, nil
+}
+
+// GetAll returns applications in the given status, or all of them when status is empty, oldest first.
+func (this *LoanApplicationRepositoryPgx) GetAll(ctx context.Context, status string) ([]entities.LoanApplication, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanApplicationColumns+" from loan_applications where $1 = '' or status = $1 order by created_at",
+		status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applications []entities.LoanApplication
+	for rows.Next() {
+		application, err := scanLoanApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, application)
+	}
+
+	return applications, nil
+}
+
+// Update saves the review state of an application provided it is still in
+// one of fromStatuses, so that two reviewers cannot act on it at once.
+func (this *LoanApplicationRepositoryPgx) Update(ctx context.Context, data entities.LoanApplication, fromStatuses []string) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		`update loan_applications
+			set status = $1, scoring_decision = $2, reasons = $3, offered_amount = $4, monthly_income = $5,
+				debt_to_income = $6, approved_amount = $7, reviewed_by = $8, loan_id = $9, updated_at = $10
+		where id = $11 and status = any($12)`,
+		data.Status,
+		nullableString(data.ScoringDecision),
+		data.Reasons,
+		data.OfferedAmount,
+		data.MonthlyIncome,
+		data.DebtToIncome,
+		data.ApprovedAmount,
+		nullableString(data.ReviewedBy),
+		nullableString(data.LoanId),
+		data.UpdatedAt,
+		data.ID,
+		fromStatuses,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrLoanApplicationStatusChanged
+	}
+
+	return nil
+}
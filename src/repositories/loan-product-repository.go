@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoanProductRepository interface {
+	Create(ctx context.Context, data entities.LoanProduct) (string, error)
+	GetAll(ctx context.Context, onlyActive bool) ([]entities.LoanProduct, error)
+	GetById(ctx context.Context, id string) (entities.LoanProduct, error)
+	Update(ctx context.Context, data entities.LoanProduct) (string, error)
+}
+
+type LoanProductRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoanProductRepository(pool *pgxpool.Pool) *LoanProductRepositoryPgx {
+	return &LoanProductRepositoryPgx{pool: pool}
+}
+
+const loanProductColumns = "id, name, rate_type, rate, margin, min_amount, max_amount, terms, fee, is_active, created_at"
+
+func scanLoanProduct(row pgx.Row) (entities.LoanProduct, error) {
+	var product entities.LoanProduct
+
+	err := row.Scan(
+		&product.ID,
+		&product.Name,
+		&product.RateType,
+		&product.Rate,
+		&product.Margin,
+		&product.MinAmount,
+		&product.MaxAmount,
+		&product.Terms,
+		&product.Fee,
+		&product.IsActive,
+		&product.CreatedAt,
+	)
+	if err != nil {
+		return entities.LoanProduct{}, err
+	}
+
+	return product, nil
+}
+
+func (this *LoanProductRepositoryPgx) Create(ctx context.Context, data entities.LoanProduct) (string, error) {
+	_, err := this.pool.Exec(
+		ctx,
+		"insert into loan_products ("+loanProductColumns+") values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		data.ID,
+		data.Name,
+		data.RateType,
+		data.Rate,
+		data.Margin,
+		data.MinAmount,
+		data.MaxAmount,
+		data.Terms,
+		data.Fee,
+		data.IsActive,
+		data.CreatedAt,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+func (this *LoanProductRepositoryPgx) GetAll(ctx context.Context, onlyActive bool) ([]entities.LoanProduct, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanProductColumns+" from loan_products where is_active or not $1 order by created_at",
+		onlyActive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []entities.LoanProduct
+	for rows.Next() {
+		product, err := scanLoanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, product)
+	}
+
+	return products, nil
+}
+
+func (this *LoanProductRepositoryPgx) GetById(ctx context.Context, id string) (entities.LoanProduct, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+loanProductColumns+" from loan_products where id = $1",
+		id,
+	)
+
+	return scanLoanProduct(row)
+}
+
+func (this *LoanProductRepositoryPgx) Update(ctx context.Context, data entities.LoanProduct) (string, error) {
+	_, err := this.pool.Exec(
+		ctx,
+		`update loan_products
+			set name = $1, rate_type = $2, rate = $3, margin = $4, min_amount = $5,
+				max_amount = $6, terms = $7, fee = $8, is_active = $9
+		where id = $10`,
+		data.Name,
+		data.RateType,
+		data.Rate,
+		data.Margin,
+		data.MinAmount,
+		data.MaxAmount,
+		data.Terms,
+		data.Fee,
+		data.IsActive,
+		data.ID,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
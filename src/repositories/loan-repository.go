@@ -3,13 +3,23 @@ package repositories
 import (
 	"bank-system/src/entities"
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrPaymentChanged is returned when a payment was repaid by another
+// repayment since it was read, so the repayment has to be allocated again.
+var ErrPaymentChanged = errors.New("Loan payment has changed")
+
 type LoanRepository interface {
 	Create(ctx context.Context, data entities.Loan) (string, error)
 	GetById(ctx context.Context, id string) (entities.Loan, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.Loan, error)
+	Disburse(ctx context.Context, applicationId string, loan entities.Loan, schedule []entities.Payment, transaction entities.Transaction, entry entities.JournalEntry) error
+	Repay(ctx context.Context, loanId string, repayments []entities.PaymentRepayment, paidAt int64, transaction entities.Transaction, entry entities.JournalEntry) error
+	Reschedule(ctx context.Context, loanId string, term int, principal int64, replacedIds []string, schedule []entities.Payment, transaction entities.Transaction, entry entities.JournalEntry) error
 }
 
 type LoanRepositoryPgx struct {
@@ -20,20 +30,33 @@ func NewLoanRepository(pool *pgxpool.Pool) *LoanRepositoryPgx {
 	return &LoanRepositoryPgx{pool: pool}
 }
 
-func (this *LoanRepositoryPgx) Create(ctx context.Context, data entities.Loan) (string, error) {
-	_, err := this.pool.Exec(
-		ctx,
-		"insert into loans (id, user_id, account_id, amount, interest_rate, term, start_date, debt) values ($1, $2, $3, $4, $5, $6, $7, $8)",
-		data.ID,
-		data.UserId,
-		data.AccountId,
-		data.Amount,
-		data.InterestRate,
-		data.Term,
-		data.StartDate,
-		data.Debt,
+const loanColumns = "id, user_id, account_id, amount, interest_rate, term, start_date, debt, schedule_type, coalesce(product_id, '')"
+
+func scanLoan(row pgx.Row) (entities.Loan, error) {
+	var loan entities.Loan
+	err := row.Scan(
+		&loan.ID,
+		&loan.UserId,
+		&loan.AccountId,
+		&loan.Amount,
+		&loan.InterestRate,
+		&loan.Term,
+		&loan.StartDate,
+		&loan.Debt,
+		&loan.ScheduleType,
+		&loan.ProductId,
 	)
 
+	if err != nil {
+		return entities.Loan{}, err
+	}
+
+	return loan, nil
+}
+
+func (this *LoanRepositoryPgx) Create(ctx context.Context, data entities.Loan) (string, error) {
+	err := createLoan(ctx, this.pool, data)
+
 	if err != nil {
 		return "", err
 	}
@@ -44,25 +67,235 @@ func (this *LoanRepositoryPgx) Create(ctx context.Context, data entities.Loan) (
 func (this *LoanRepositoryPgx) GetById(ctx context.Context, id string) (entities.Loan, error) {
 	row := this.pool.QueryRow(
 		ctx,
-		"select id, user_id, account_id, amount, interest_rate, term, start_date, debt from loans where id = $1",
+		"select "+loanColumns+" from loans where id = $1",
 		id,
 	)
 
-	var loan entities.Loan
-	err := row.Scan(
-		&loan.ID,
-		&loan.UserId,
-		&loan.AccountId,
-		&loan.Amount,
-		&loan.InterestRate,
-		&loan.Term,
-		&loan.StartDate,
-		&loan.Debt,
+	return scanLoan(row)
+}
+
+func (this *LoanRepositoryPgx) GetByUserId(ctx context.Context, userId string) ([]entities.Loan, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanColumns+" from loans where user_id = $1 order by start_date",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var loans []entities.Loan
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		loans = append(loans, loan)
+	}
+
+	return loans, nil
+}
+
+// Disburse creates the loan with its payment schedule, records the
+// disbursement transaction with its journal entry and marks the approved
+// application as disbursed atomically. It fails with
+// ErrLoanApplicationStatusChanged when the application is no longer approved.
+func (this *LoanRepositoryPgx) Disburse(ctx context.Context, applicationId string, loan entities.Loan, schedule []entities.Payment, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		"update loan_applications set status = 'disbursed', loan_id = $1, updated_at = $2 where id = $3 and status = 'approved'",
+		loan.ID,
+		transaction.CreatedAt,
+		applicationId,
 	)
+	if err != nil {
+		return err
+	}
 
+	if tag.RowsAffected() == 0 {
+		return ErrLoanApplicationStatusChanged
+	}
+
+	err = createLoan(ctx, tx, loan)
 	if err != nil {
-		return entities.Loan{}, err
+		return err
 	}
 
-	return loan, nil
+	err = insertPayments(ctx, tx, schedule)
+	if err != nil {
+		return err
+	}
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Repay adds the repaid parts to the payments, reduces the debt by the repaid
+// principal and records the repayment transaction with its journal entry
+// atomically. The parts are added to the stored amounts under the row locks,
+// and the repayment fails with ErrPaymentChanged when a part would exceed what
+// is due, i.e. when a concurrent repayment has settled it since it was read.
+func (this *LoanRepositoryPgx) Repay(ctx context.Context, loanId string, repayments []entities.PaymentRepayment, paidAt int64, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var principal int64
+	for _, repayment := range repayments {
+		err = repayPayment(ctx, tx, loanId, repayment, paidAt)
+		if err != nil {
+			return err
+		}
+
+		principal += repayment.Principal
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		"update loans set debt = debt - $1 where id = $2 and debt >= $1",
+		principal,
+		loanId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrPaymentChanged
+	}
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Reschedule replaces the given unpaid payments with a new schedule, reduces
+// the debt by the prepaid principal, stores the new term and records the
+// transaction with its journal entry in the same database transaction. It
+// fails with ErrPaymentChanged when any of the replaced payments was repaid,
+// even partially, since it was read.
+func (this *LoanRepositoryPgx) Reschedule(ctx context.Context, loanId string, term int, principal int64, replacedIds []string, schedule []entities.Payment, transaction entities.Transaction, entry entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(
+		ctx,
+		`delete from payments
+		where loan_id = $1 and id = any($2) and is_paid = false
+			and principal_paid = 0 and interest_paid = 0 and penalty_paid = 0`,
+		loanId,
+		replacedIds,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() != int64(len(replacedIds)) {
+		return ErrPaymentChanged
+	}
+
+	err = insertPayments(ctx, tx, schedule)
+	if err != nil {
+		return err
+	}
+
+	tag, err = tx.Exec(
+		ctx,
+		"update loans set debt = debt - $1, term = $2 where id = $3 and debt >= $1",
+		principal,
+		term,
+		loanId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrPaymentChanged
+	}
+
+	err = recordTransaction(ctx, tx, transaction, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// paymentOutstandingAfter is what remains due on a payment after the parts
+// $1 (interest), $2 (principal) and $3 (penalty) are repaid. Columns refer to
+// the row as locked by the update, so a penalty accrued meanwhile is included.
+const paymentOutstandingAfter = "(interest_part - interest_paid - $1 + principal_part - principal_paid - $2 + penalty_part - penalty_paid - $3)"
+
+// repayPayment adds the repaid parts to a payment and marks it paid once
+// nothing is outstanding.
+func repayPayment(ctx context.Context, tx pgx.Tx, loanId string, repayment entities.PaymentRepayment, paidAt int64) error {
+	tag, err := tx.Exec(
+		ctx,
+		`update payments set
+				interest_paid = interest_paid + $1,
+				principal_paid = principal_paid + $2,
+				penalty_paid = penalty_paid + $3,
+				is_paid = `+paymentOutstandingAfter+` = 0,
+				status = case when `+paymentOutstandingAfter+` = 0 then 'paid' else status end,
+				date = case when `+paymentOutstandingAfter+` = 0 then $4 else date end
+		where id = $5 and loan_id = $6 and is_paid = false
+			and interest_paid + $1 <= interest_part
+			and principal_paid + $2 <= principal_part
+			and penalty_paid + $3 <= penalty_part`,
+		repayment.Interest,
+		repayment.Principal,
+		repayment.Penalty,
+		paidAt,
+		repayment.PaymentId,
+		loanId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrPaymentChanged
+	}
+
+	return nil
+}
+
+func createLoan(ctx context.Context, db executor, data entities.Loan) error {
+	_, err := db.Exec(
+		ctx,
+		"insert into loans (id, user_id, account_id, amount, interest_rate, term, start_date, debt, schedule_type, product_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		data.ID,
+		data.UserId,
+		data.AccountId,
+		data.Amount,
+		data.InterestRate,
+		data.Term,
+		data.StartDate,
+		data.Debt,
+		data.ScheduleType,
+		data.ProductId,
+	)
+
+	return err
 }
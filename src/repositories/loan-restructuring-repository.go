@@ -0,0 +1,311 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrLoanRestructuringStatusChanged is returned when a restructuring has
+	// already been reviewed by the time it is approved or rejected.
+	ErrLoanRestructuringStatusChanged = errors.New("Loan restructuring is no longer pending")
+	// ErrScheduleChanged is returned when installments being replaced were
+	// paid, even partially, or became overdue while the new schedule was
+	// being built.
+	ErrScheduleChanged = errors.New("Payment schedule has changed")
+)
+
+type LoanRestructuringRepository interface {
+	Create(ctx context.Context, data entities.LoanRestructuring) (string, error)
+	GetById(ctx context.Context, id string) (entities.LoanRestructuring, error)
+	GetByLoanId(ctx context.Context, loanId string) ([]entities.LoanRestructuring, error)
+	GetAll(ctx context.Context, status string) ([]entities.LoanRestructuring, error)
+	Approve(ctx context.Context, data entities.LoanRestructuring, loan entities.Loan, replaced []entities.Payment, schedule []entities.Payment, entry *entities.JournalEntry) error
+	Reject(ctx context.Context, data entities.LoanRestructuring) error
+}
+
+type LoanRestructuringRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoanRestructuringRepository(pool *pgxpool.Pool) *LoanRestructuringRepositoryPgx {
+	return &LoanRestructuringRepositoryPgx{pool: pool}
+}
+
+const loanRestructuringColumns = "id, loan_id, user_id, extra_term, grace_months, coalesce(new_rate, 0), reason, status, coalesce(review_comment, ''), coalesce(reviewed_by, ''), created_at, updated_at"
+
+func scanLoanRestructuring(row pgx.Row) (entities.LoanRestructuring, error) {
+	var restructuring entities.LoanRestructuring
+
+	err := row.Scan(
+		&restructuring.ID,
+		&restructuring.LoanId,
+		&restructuring.UserId,
+		&restructuring.ExtraTerm,
+		&restructuring.GraceMonths,
+		&restructuring.NewRate,
+		&restructuring.Reason,
+		&restructuring.Status,
+		&restructuring.ReviewComment,
+		&restructuring.ReviewedBy,
+		&restructuring.CreatedAt,
+		&restructuring.UpdatedAt,
+	)
+	if err != nil {
+		return entities.LoanRestructuring{}, err
+	}
+
+	return restructuring, nil
+}
+
+func (this *LoanRestructuringRepositoryPgx) Create(ctx context.Context, data entities.LoanRestructuring) (string, error) {
+	var nullableNewRate *float64
+	if data.NewRate != 0 {
+		nullableNewRate = &data.NewRate
+	}
+
+	_, err := this.pool.Exec(
+		ctx,
+		`insert into loan_restructurings (id, loan_id, user_id, extra_term, grace_months, new_rate, reason, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		data.ID,
+		data.LoanId,
+		data.UserId,
+		data.ExtraTerm,
+		data.GraceMonths,
+		nullableNewRate,
+		data.Reason,
+		data.Status,
+		data.CreatedAt,
+		data.UpdatedAt,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+func (this *LoanRestructuringRepositoryPgx) GetById(ctx context.Context, id string) (entities.LoanRestructuring, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+loanRestructuringColumns+" from loan_restructurings where id = $1",
+		id,
+	)
+
+	return scanLoanRestructuring(row)
+}
+
+func (this *LoanRestructuringRepositoryPgx) GetByLoanId(ctx context.Context, loanId string) ([]entities.LoanRestructuring, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanRestructuringColumns+" from loan_restructurings where loan_id = $1 order by created_at desc",
+		loanId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var restructurings []entities.LoanRestructuring
+	for rows.Next() {
+		restructuring, err := scanLoanRestructuring(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		restructurings = append(restructurings, restructuring)
+	}
+
+	return restructurings, nil
+}
+
+// GetAll returns restructurings in the given status, or all of them when status is empty, oldest first.
+func (this *LoanRestructuringRepositoryPgx) GetAll(ctx context.Context, status string) ([]entities.LoanRestructuring, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+loanRestructuringColumns+" from loan_restructurings where $1 = '' or status = $1 order by created_at",
+		status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var restructurings []entities.LoanRestructuring
+	for rows.Next() {
+		restructuring, err := scanLoanRestructuring(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		restructurings = append(restructurings, restructuring)
+	}
+
+	return restructurings, nil
+}
+
+func reviewLoanRestructuring(ctx context.Context, db executor, data entities.LoanRestructuring) error {
+	result, err := db.Exec(
+		ctx,
+		`update loan_restructurings set status = $1, review_comment = $2, reviewed_by = $3, updated_at = $4
+		where id = $5 and status = 'pending'`,
+		data.Status,
+		nullableString(data.ReviewComment),
+		nullableString(data.ReviewedBy),
+		data.UpdatedAt,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrLoanRestructuringStatusChanged
+	}
+
+	return nil
+}
+
+// Approve marks the restructuring approved, moves the replaced installments to
+// payment_history and stores the new schedule, debt, term and rate of the loan
+// atomically. The entry, if any, capitalises overdue interest and penalty.
+// The new debt is computed from the replaced installments as read, so they
+// are locked first and the approval fails with ErrScheduleChanged unless they
+// are unchanged.
+func (this *LoanRestructuringRepositoryPgx) Approve(ctx context.Context, data entities.LoanRestructuring, loan entities.Loan, replaced []entities.Payment, schedule []entities.Payment, entry *entities.JournalEntry) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = reviewLoanRestructuring(ctx, tx, data)
+	if err != nil {
+		return err
+	}
+
+	err = lockUnchangedPayments(ctx, tx, loan.ID, replaced)
+	if err != nil {
+		return err
+	}
+
+	replacedIds := make([]string, 0, len(replaced))
+	for _, payment := range replaced {
+		replacedIds = append(replacedIds, payment.ID)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into payment_history (
+			id, loan_id, restructuring_id, amount, date, due_date, principal_part, interest_part,
+			principal_paid, interest_paid, penalty_part, penalty_paid, status, archived_at
+		)
+		select id, loan_id, $1, amount, date, due_date, principal_part, interest_part,
+			principal_paid, interest_paid, penalty_part, penalty_paid, status, $2
+			from payments
+		where loan_id = $3 and id = any($4)`,
+		data.ID,
+		data.UpdatedAt,
+		loan.ID,
+		replacedIds,
+	)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		ctx,
+		"delete from payments where loan_id = $1 and id = any($2) and is_paid = false",
+		loan.ID,
+		replacedIds,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() != int64(len(replacedIds)) {
+		return ErrScheduleChanged
+	}
+
+	err = insertPayments(ctx, tx, schedule)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"update loans set debt = $1, term = $2, interest_rate = $3 where id = $4",
+		loan.Debt,
+		loan.Term,
+		loan.InterestRate,
+		loan.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		err = postJournalEntry(ctx, tx, *entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockUnchangedPayments locks the unpaid payments for the rest of tx and
+// fails with ErrScheduleChanged unless each is stored as it was read, i.e. it
+// has not been repaid, charged a penalty or become overdue since.
+func lockUnchangedPayments(ctx context.Context, tx pgx.Tx, loanId string, payments []entities.Payment) error {
+	ids := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		ids = append(ids, payment.ID)
+	}
+
+	rows, err := tx.Query(
+		ctx,
+		"select "+paymentColumns+" from payments where loan_id = $1 and id = any($2) and is_paid = false order by id for update",
+		loanId,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]entities.Payment, len(payments))
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return err
+		}
+
+		stored[payment.ID] = payment
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		current, ok := stored[payment.ID]
+		if !ok ||
+			current.Status != payment.Status ||
+			current.PrincipalPaid != payment.PrincipalPaid ||
+			current.InterestPaid != payment.InterestPaid ||
+			current.PenaltyPart != payment.PenaltyPart ||
+			current.PenaltyPaid != payment.PenaltyPaid {
+			return ErrScheduleChanged
+		}
+	}
+
+	return nil
+}
+
+func (this *LoanRestructuringRepositoryPgx) Reject(ctx context.Context, data entities.LoanRestructuring) error {
+	return reviewLoanRestructuring(ctx, this.pool, data)
+}
@@ -13,8 +13,14 @@ type PaymentRepository interface {
 	Create(ctx context.Context, data entities.Payment) (string, error)
 	CreateMany(ctx context.Context, data []entities.Payment) ([]string, error)
 	GetByLoanId(ctx context.Context, id string) ([]entities.Payment, error)
+	GetHistoryByLoanId(ctx context.Context, id string) ([]entities.ArchivedPayment, error)
 	Update(ctx context.Context, data entities.Payment) (string, error)
 	GetOverdue(ctx context.Context) ([]entities.Payment, error)
+	GetDueForDebit(ctx context.Context, now int64, maxAttempts int) ([]entities.Payment, error)
+	GetUnpaidOverdue(ctx context.Context) ([]entities.Payment, error)
+	MarkOverdue(ctx context.Context, id string) error
+	RecordDebitAttempt(ctx context.Context, id string, nextDebitAt int64) error
+	AccruePenalty(ctx context.Context, id string, penalty int64, fromTime int64, toTime int64) error
 }
 
 type PaymentRepositoryPgx struct {
@@ -25,16 +31,60 @@ func NewPaymentRepository(pool *pgxpool.Pool) *PaymentRepositoryPgx {
 	return &PaymentRepositoryPgx{pool: pool}
 }
 
+const paymentColumns = "id, loan_id, amount, date, due_date, principal_part, interest_part, principal_paid, interest_paid, penalty_part, penalty_paid, penalty_accrued_at, status, is_paid, debit_attempts, next_debit_at"
+
+func scanPayment(row pgx.Row) (entities.Payment, error) {
+	var payment entities.Payment
+	var nullableDate *int64
+	var nullableNextDebitAt *int64
+	var nullablePenaltyAccruedAt *int64
+
+	err := row.Scan(
+		&payment.ID,
+		&payment.LoanId,
+		&payment.Amount,
+		&nullableDate,
+		&payment.DueDate,
+		&payment.PrincipalPart,
+		&payment.InterestPart,
+		&payment.PrincipalPaid,
+		&payment.InterestPaid,
+		&payment.PenaltyPart,
+		&payment.PenaltyPaid,
+		&nullablePenaltyAccruedAt,
+		&payment.Status,
+		&payment.IsPaid,
+		&payment.DebitAttempts,
+		&nullableNextDebitAt,
+	)
+	if err != nil {
+		return entities.Payment{}, err
+	}
+
+	if nullableDate != nil {
+		payment.Date = *nullableDate
+	}
+	if nullableNextDebitAt != nil {
+		payment.NextDebitAt = *nullableNextDebitAt
+	}
+	if nullablePenaltyAccruedAt != nil {
+		payment.PenaltyAccruedAt = *nullablePenaltyAccruedAt
+	}
+
+	return payment, nil
+}
+
 func (this *PaymentRepositoryPgx) Create(ctx context.Context, data entities.Payment) (string, error) {
 	_, err := this.pool.Exec(
 		ctx,
-		"insert into payments (id, loan_id, amount, due_date, principal_part, interest_part, is_paid) values ($1, $2, $3, $4, $5, $6, $7, $8)",
+		"insert into payments (id, loan_id, amount, due_date, principal_part, interest_part, status, is_paid) values ($1, $2, $3, $4, $5, $6, $7, $8)",
 		data.ID,
 		data.LoanId,
 		data.Amount,
 		data.DueDate,
 		data.PrincipalPart,
 		data.InterestPart,
+		data.Status,
 		data.IsPaid,
 	)
 
@@ -42,7 +92,7 @@ func (this *PaymentRepositoryPgx) Create(ctx context.Context, data entities.Paym
 		return "", err
 	}
 
-	return "", nil
+	return data.ID, nil
 }
 
 func (this *PaymentRepositoryPgx) CreateMany(ctx context.Context, data []entities.Payment) ([]string, error) {
@@ -52,24 +102,7 @@ func (this *PaymentRepositoryPgx) CreateMany(ctx context.Context, data []entitie
 	}
 	defer tx.Rollback(ctx)
 
-	batch := new(pgx.Batch)
-
-	for _, payment := range data {
-		batch.Queue(
-			"insert into payments (id, loan_id, amount, due_date, principal_part, interest_part, is_paid) values ($1, $2, $3, $4, $5, $6, $7)",
-			payment.ID,
-			payment.LoanId,
-			payment.Amount,
-			payment.DueDate,
-			payment.PrincipalPart,
-			payment.InterestPart,
-			payment.IsPaid,
-		)
-	}
-
-	result := tx.SendBatch(ctx, batch)
-
-	err = result.Close()
+	err = insertPayments(ctx, tx, data)
 	if err != nil {
 		return []string{}, err
 	}
@@ -90,7 +123,7 @@ func (this *PaymentRepositoryPgx) CreateMany(ctx context.Context, data []entitie
 func (this *PaymentRepositoryPgx) GetByLoanId(ctx context.Context, id string) ([]entities.Payment, error) {
 	rows, err := this.pool.Query(
 		ctx,
-		"select id, loan_id, amount, date, due_date, principal_part, interest_part, is_paid from payments where loan_id = $1",
+		"select "+paymentColumns+" from payments where loan_id = $1 order by due_date",
 		id,
 	)
 	if err != nil {
@@ -100,26 +133,59 @@ func (this *PaymentRepositoryPgx) GetByLoanId(ctx context.Context, id string) ([
 
 	var payments []entities.Payment
 	for rows.Next() {
-		var payment entities.Payment
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return []entities.Payment{}, err
+		}
+
+		payments = append(payments, payment)
+	}
 
+	return payments, nil
+}
+
+// GetHistoryByLoanId returns installments replaced by restructurings of the loan.
+func (this *PaymentRepositoryPgx) GetHistoryByLoanId(ctx context.Context, id string) ([]entities.ArchivedPayment, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select id, loan_id, restructuring_id, amount, date, due_date, principal_part, interest_part,
+			principal_paid, interest_paid, penalty_part, penalty_paid, status, archived_at
+			from payment_history
+		where loan_id = $1 order by archived_at, due_date`,
+		id,
+	)
+	if err != nil {
+		return []entities.ArchivedPayment{}, err
+	}
+	defer rows.Close()
+
+	var payments []entities.ArchivedPayment
+	for rows.Next() {
+		var payment entities.ArchivedPayment
 		var nullableDate *int64
 
 		err = rows.Scan(
 			&payment.ID,
 			&payment.LoanId,
+			&payment.RestructuringId,
 			&payment.Amount,
 			&nullableDate,
 			&payment.DueDate,
 			&payment.PrincipalPart,
 			&payment.InterestPart,
-			&payment.IsPaid,
+			&payment.PrincipalPaid,
+			&payment.InterestPaid,
+			&payment.PenaltyPart,
+			&payment.PenaltyPaid,
+			&payment.Status,
+			&payment.ArchivedAt,
 		)
-		if nullableDate != nil {
-			payment.Date = *nullableDate
+		if err != nil {
+			return []entities.ArchivedPayment{}, err
 		}
 
-		if err != nil {
-			return []entities.Payment{}, err
+		if nullableDate != nil {
+			payment.Date = *nullableDate
 		}
 
 		payments = append(payments, payment)
@@ -129,18 +195,7 @@ func (this *PaymentRepositoryPgx) GetByLoanId(ctx context.Context, id string) ([
 }
 
 func (this *PaymentRepositoryPgx) Update(ctx context.Context, data entities.Payment) (string, error) {
-	_, err := this.pool.Exec(
-		ctx,
-		"update payments set amount = $1, date = $2, due_date = $3, principal_part = $4, interest_part = $5, status = $6, is_paid = $7 where id = $1",
-		data.Amount,
-		data.Date,
-		data.DueDate,
-		data.PrincipalPart,
-		data.InterestPart,
-		data.Status,
-		data.IsPaid,
-	)
-
+	err := updatePayment(ctx, this.pool, data)
 	if err != nil {
 		return "", err
 	}
@@ -154,8 +209,8 @@ func (this *PaymentRepositoryPgx) GetOverdue(ctx context.Context) ([]entities.Pa
 
 	rows, err := this.pool.Query(
 		ctx,
-		`select id, loan_id, amount, date, due_date, principal_part, interest_part, status, is_paid 
-			from payments 
+		`select `+paymentColumns+`
+			from payments
 		where due_date < $1 and is_paid = false and (status = 'new')`,
 		currentTime,
 	)
@@ -166,27 +221,66 @@ func (this *PaymentRepositoryPgx) GetOverdue(ctx context.Context) ([]entities.Pa
 
 	var payments []entities.Payment
 	for rows.Next() {
-		var payment entities.Payment
-		var nullableDate *int64
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return []entities.Payment{}, err
+		}
 
-		err = rows.Scan(
-			&payment.ID,
-			&payment.LoanId,
-			&payment.Amount,
-			&nullableDate,
-			&payment.DueDate,
-			&payment.PrincipalPart,
-			&payment.InterestPart,
-			&payment.Status,
-			&payment.IsPaid,
-		)
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
 
+// GetDueForDebit returns unpaid payments whose due date has come and which
+// have not exhausted their automatic debit attempts, oldest first.
+func (this *PaymentRepositoryPgx) GetDueForDebit(ctx context.Context, now int64, maxAttempts int) ([]entities.Payment, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select `+paymentColumns+`
+			from payments
+		where due_date <= $1 and is_paid = false and status in ('new', 'overdue')
+			and debit_attempts < $2 and (next_debit_at is null or next_debit_at <= $1)
+		order by due_date`,
+		now,
+		maxAttempts,
+	)
+	if err != nil {
+		return []entities.Payment{}, err
+	}
+	defer rows.Close()
+
+	var payments []entities.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
 		if err != nil {
 			return []entities.Payment{}, err
 		}
 
-		if nullableDate != nil {
-			payment.Date = *nullableDate
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+// GetUnpaidOverdue returns payments already marked as overdue and still not paid.
+func (this *PaymentRepositoryPgx) GetUnpaidOverdue(ctx context.Context) ([]entities.Payment, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select `+paymentColumns+`
+			from payments
+		where is_paid = false and status = 'overdue'`,
+	)
+	if err != nil {
+		return []entities.Payment{}, err
+	}
+	defer rows.Close()
+
+	var payments []entities.Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return []entities.Payment{}, err
 		}
 
 		payments = append(payments, payment)
@@ -194,3 +288,101 @@ func (this *PaymentRepositoryPgx) GetOverdue(ctx context.Context) ([]entities.Pa
 
 	return payments, nil
 }
+
+// MarkOverdue marks a new payment that is still unpaid as overdue. Only the
+// status is written, so repayments and penalties stored since the payment
+// was read are kept.
+func (this *PaymentRepositoryPgx) MarkOverdue(ctx context.Context, id string) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"update payments set status = 'overdue' where id = $1 and is_paid = false and status = 'new'",
+		id,
+	)
+
+	return err
+}
+
+func (this *PaymentRepositoryPgx) RecordDebitAttempt(ctx context.Context, id string, nextDebitAt int64) error {
+	_, err := this.pool.Exec(
+		ctx,
+		"update payments set debit_attempts = debit_attempts + 1, next_debit_at = $1 where id = $2 and is_paid = false",
+		nextDebitAt,
+		id,
+	)
+
+	return err
+}
+
+// AccruePenalty adds penalty accrued over [fromTime, toTime). The update is
+// skipped when the penalty has already been accrued from fromTime, so
+// concurrent runs cannot charge the same period twice.
+func (this *PaymentRepositoryPgx) AccruePenalty(ctx context.Context, id string, penalty int64, fromTime int64, toTime int64) error {
+	_, err := this.pool.Exec(
+		ctx,
+		`update payments set penalty_part = penalty_part + $1, penalty_accrued_at = $2
+		where id = $3 and is_paid = false and coalesce(penalty_accrued_at, due_date) = $4`,
+		penalty,
+		toTime,
+		id,
+		fromTime,
+	)
+
+	return err
+}
+
+// updatePayment stores a payment. The penalty and the time it is accrued up
+// to are left as they are, since only AccruePenalty changes them.
+func updatePayment(ctx context.Context, db executor, data entities.Payment) error {
+	var nullableDate *int64
+	if data.Date != 0 {
+		nullableDate = &data.Date
+	}
+	var nullableNextDebitAt *int64
+	if data.NextDebitAt != 0 {
+		nullableNextDebitAt = &data.NextDebitAt
+	}
+
+	_, err := db.Exec(
+		ctx,
+		`update payments
+			set amount = $1, date = $2, due_date = $3, principal_part = $4, interest_part = $5,
+				principal_paid = $6, interest_paid = $7, penalty_paid = $8,
+				status = $9, is_paid = $10, debit_attempts = $11, next_debit_at = $12
+		where id = $13`,
+		data.Amount,
+		nullableDate,
+		data.DueDate,
+		data.PrincipalPart,
+		data.InterestPart,
+		data.PrincipalPaid,
+		data.InterestPaid,
+		data.PenaltyPaid,
+		data.Status,
+		data.IsPaid,
+		data.DebitAttempts,
+		nullableNextDebitAt,
+		data.ID,
+	)
+
+	return err
+}
+
+func insertPayments(ctx context.Context, tx pgx.Tx, payments []entities.Payment) error {
+	batch := new(pgx.Batch)
+
+	for _, payment := range payments {
+		batch.Queue(
+			"insert into payments (id, loan_id, amount, due_date, principal_part, interest_part, status, is_paid) values ($1, $2, $3, $4, $5, $6, $7, $8)",
+			payment.ID,
+			payment.LoanId,
+			payment.Amount,
+			payment.DueDate,
+			payment.PrincipalPart,
+			payment.InterestPart,
+			payment.Status,
+			payment.IsPaid,
+		)
+	}
+
+	return tx.SendBatch(ctx, batch).Close()
+}
@@ -0,0 +1,300 @@
+package repositories
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrStandingOrderClosed is returned when a standing order has been completed
+// or cancelled by the time it is changed.
+var ErrStandingOrderClosed = errors.New("Standing order is completed or cancelled")
+
+type StandingOrderRepository interface {
+	Create(ctx context.Context, data entities.StandingOrder) (string, error)
+	GetById(ctx context.Context, id string) (entities.StandingOrder, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.StandingOrder, error)
+	Update(ctx context.Context, data entities.StandingOrder) error
+	GetDue(ctx context.Context, now int64) ([]entities.StandingOrder, error)
+	Claim(ctx context.Context, id string, nextRunAt int64, now int64, claimedUntil int64) (bool, error)
+	RecordRun(ctx context.Context, data entities.StandingOrder, run entities.StandingOrderRun) error
+	GetRuns(ctx context.Context, orderId string) ([]entities.StandingOrderRun, error)
+}
+
+type StandingOrderRepositoryPgx struct {
+	pool *pgxpool.Pool
+}
+
+func NewStandingOrderRepository(pool *pgxpool.Pool) *StandingOrderRepositoryPgx {
+	return &StandingOrderRepositoryPgx{pool: pool}
+}
+
+const standingOrderColumns = `id, user_id, from_account_id, to_account_id, amount, description, convert_currency,
+	frequency, interval_count, start_date, coalesce(end_date, 0), next_run_at, status, failed_attempts,
+	coalesce(last_run_at, 0), coalesce(last_error, ''), created_at, updated_at`
+
+func scanStandingOrder(row pgx.Row) (entities.StandingOrder, error) {
+	var order entities.StandingOrder
+
+	err := row.Scan(
+		&order.ID,
+		&order.UserId,
+		&order.FromAccountId,
+		&order.ToAccountId,
+		&order.Amount,
+		&order.Description,
+		&order.Convert,
+		&order.Frequency,
+		&order.Interval,
+		&order.StartDate,
+		&order.EndDate,
+		&order.NextRunAt,
+		&order.Status,
+		&order.FailedAttempts,
+		&order.LastRunAt,
+		&order.LastError,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return entities.StandingOrder{}, err
+	}
+
+	return order, nil
+}
+
+func scanStandingOrders(rows pgx.Rows) ([]entities.StandingOrder, error) {
+	defer rows.Close()
+
+	var orders []entities.StandingOrder
+	for rows.Next() {
+		order, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func nullableInt64(value int64) *int64 {
+	if value == 0 {
+		return nil
+	}
+
+	return &value
+}
+
+func (this *StandingOrderRepositoryPgx) Create(ctx context.Context, data entities.StandingOrder) (string, error) {
+	_, err := this.pool.Exec(
+		ctx,
+		`insert into standing_orders (id, user_id, from_account_id, to_account_id, amount, description, convert_currency,
+				frequency, interval_count, start_date, end_date, next_run_at, status, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		data.ID,
+		data.UserId,
+		data.FromAccountId,
+		data.ToAccountId,
+		data.Amount,
+		data.Description,
+		data.Convert,
+		data.Frequency,
+		data.Interval,
+		data.StartDate,
+		nullableInt64(data.EndDate),
+		data.NextRunAt,
+		data.Status,
+		data.CreatedAt,
+		data.UpdatedAt,
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	return data.ID, nil
+}
+
+func (this *StandingOrderRepositoryPgx) GetById(ctx context.Context, id string) (entities.StandingOrder, error) {
+	row := this.pool.QueryRow(
+		ctx,
+		"select "+standingOrderColumns+" from standing_orders where id = $1",
+		id,
+	)
+
+	return scanStandingOrder(row)
+}
+
+func (this *StandingOrderRepositoryPgx) GetByUserId(ctx context.Context, userId string) ([]entities.StandingOrder, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		"select "+standingOrderColumns+" from standing_orders where user_id = $1 order by created_at desc",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanStandingOrders(rows)
+}
+
+// Update saves the terms and the status set by the user. The schedule is
+// kept, it belongs to the scheduler, except that a paused order being resumed
+// continues at data.NextRunAt with no failed attempts. Orders already
+// completed or cancelled are left as they are.
+func (this *StandingOrderRepositoryPgx) Update(ctx context.Context, data entities.StandingOrder) error {
+	tag, err := this.pool.Exec(
+		ctx,
+		`update standing_orders
+			set amount = $1, description = $2, convert_currency = $3, end_date = $4,
+				next_run_at = case when status = 'paused' and $6 = 'active' then $5 else next_run_at end,
+				failed_attempts = case when status = 'paused' and $6 = 'active' then $7 else failed_attempts end,
+				status = $6, updated_at = $8
+		where id = $9 and status in ('active', 'paused')`,
+		data.Amount,
+		data.Description,
+		data.Convert,
+		nullableInt64(data.EndDate),
+		data.NextRunAt,
+		data.Status,
+		data.FailedAttempts,
+		data.UpdatedAt,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrStandingOrderClosed
+	}
+
+	return nil
+}
+
+// GetDue returns active orders whose next transfer is due and which are not
+// being run, earliest first.
+func (this *StandingOrderRepositoryPgx) GetDue(ctx context.Context, now int64) ([]entities.StandingOrder, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select `+standingOrderColumns+` from standing_orders
+		where status = 'active' and next_run_at <= $1 and coalesce(claimed_until, 0) <= $1
+		order by next_run_at`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanStandingOrders(rows)
+}
+
+// Claim marks a due order as being run until claimedUntil, so that it is not
+// picked up again meanwhile. The next run is kept, so a run interrupted before
+// it is recorded is retried for the same scheduled time. It reports false
+// when the order has changed since it was read, e.g. when another instance
+// has claimed it.
+func (this *StandingOrderRepositoryPgx) Claim(ctx context.Context, id string, nextRunAt int64, now int64, claimedUntil int64) (bool, error) {
+	tag, err := this.pool.Exec(
+		ctx,
+		`update standing_orders set claimed_until = $1
+		where id = $2 and status = 'active' and next_run_at = $3 and coalesce(claimed_until, 0) <= $4`,
+		claimedUntil,
+		id,
+		nextRunAt,
+		now,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RecordRun stores an attempt and the resulting schedule of the order. The
+// order is completed when data says so, otherwise its status is kept, since
+// the user may have paused or cancelled it during the run.
+func (this *StandingOrderRepositoryPgx) RecordRun(ctx context.Context, data entities.StandingOrder, run entities.StandingOrderRun) error {
+	tx, err := this.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(
+		ctx,
+		`insert into standing_order_runs (id, order_id, transaction_id, status, error, scheduled_at, run_at)
+			values ($1, $2, $3, $4, $5, $6, $7)`,
+		run.ID,
+		run.OrderId,
+		nullableString(run.TransactionId),
+		run.Status,
+		nullableString(run.Error),
+		run.ScheduledAt,
+		run.RunAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`update standing_orders
+			set next_run_at = $1, failed_attempts = $2, last_run_at = $3, last_error = $4, updated_at = $5,
+				claimed_until = null, status = case when $6 = 'completed' and status in ('active', 'paused') then $6 else status end
+		where id = $7`,
+		data.NextRunAt,
+		data.FailedAttempts,
+		nullableInt64(data.LastRunAt),
+		nullableString(data.LastError),
+		data.UpdatedAt,
+		data.Status,
+		data.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (this *StandingOrderRepositoryPgx) GetRuns(ctx context.Context, orderId string) ([]entities.StandingOrderRun, error) {
+	rows, err := this.pool.Query(
+		ctx,
+		`select id, order_id, coalesce(transaction_id, ''), status, coalesce(error, ''), scheduled_at, run_at
+			from standing_order_runs
+		where order_id = $1 order by run_at desc`,
+		orderId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []entities.StandingOrderRun
+	for rows.Next() {
+		var run entities.StandingOrderRun
+
+		err = rows.Scan(
+			&run.ID,
+			&run.OrderId,
+			&run.TransactionId,
+			&run.Status,
+			&run.Error,
+			&run.ScheduledAt,
+			&run.RunAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
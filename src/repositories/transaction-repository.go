@@ -3,10 +3,16 @@ package repositories
 import (
 	"bank-system/src/entities"
 	"context"
+	"errors"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrTransactionExists is returned when a transaction with the same id has
+// already been recorded, e.g. a transfer keyed on what it pays for.
+var ErrTransactionExists = errors.New("Transaction has already been recorded")
+
 type TransactionRepository interface {
 	Create(ctx context.Context, data entities.Transaction) (string, error)
 	GetByAccountId(ctx context.Context, accountId string) ([]entities.Transaction, error)
@@ -20,17 +26,7 @@ func NewTransactionRepository(pool *pgxpool.Pool) *TransactionRepositoryPgx {
 }
 
 func (this *TransactionRepositoryPgx) Create(ctx context.Context, data entities.Transaction) (string, error) {
-	_, err := this.pool.Exec(
-		ctx,
-		"insert into transactions (id, amount, from_id, to_id, type, description, created_at) values ($1, $2, $3, $4, $5, $6, $7)",
-		data.ID,
-		data.Amount,
-		data.FromAccountId,
-		data.ToAccountId,
-		data.Type,
-		data.Description,
-		data.CreatedAt,
-	)
+	err := createTransaction(ctx, this.pool, data)
 
 	if err != nil {
 		return "", err
@@ -42,7 +38,7 @@ func (this *TransactionRepositoryPgx) Create(ctx context.Context, data entities.
 func (this *TransactionRepositoryPgx) GetByAccountId(ctx context.Context, id string) ([]entities.Transaction, error) {
 	rows, err := this.pool.Query(
 		ctx,
-		"select id, amount, from_id, to_id, type, description, created_at from transactions where from_id = $1 or to_id = $1",
+		"select id, amount, currency, from_id, to_id, type, description, created_at, linked_id, card_id from transactions where from_id = $1 or to_id = $1",
 		id,
 	)
 	if err != nil {
@@ -55,20 +51,31 @@ func (this *TransactionRepositoryPgx) GetByAccountId(ctx context.Context, id str
 		var transaction entities.Transaction
 
 		var nullableTo *string
+		var nullableLinkedId *string
+		var nullableCardId *string
 
 		err := rows.Scan(
 			&transaction.ID,
 			&transaction.Amount,
+			&transaction.Currency,
 			&transaction.FromAccountId,
 			// &transaction.ToAccountId,
 			&nullableTo,
 			&transaction.Type,
 			&transaction.Description,
 			&transaction.CreatedAt,
+			&nullableLinkedId,
+			&nullableCardId,
 		)
 		if nullableTo != nil {
 			transaction.ToAccountId = *nullableTo
 		}
+		if nullableLinkedId != nil {
+			transaction.LinkedTransactionId = *nullableLinkedId
+		}
+		if nullableCardId != nil {
+			transaction.CardId = *nullableCardId
+		}
 
 		if err != nil {
 			return []entities.Transaction{}, err
@@ -78,3 +85,27 @@ func (this *TransactionRepositoryPgx) GetByAccountId(ctx context.Context, id str
 	}
 	return transactions, nil
 }
+
+func createTransaction(ctx context.Context, db executor, data entities.Transaction) error {
+	_, err := db.Exec(
+		ctx,
+		"insert into transactions (id, amount, currency, from_id, to_id, type, description, created_at, linked_id, card_id) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		data.ID,
+		data.Amount,
+		data.Currency,
+		data.FromAccountId,
+		data.ToAccountId,
+		data.Type,
+		data.Description,
+		data.CreatedAt,
+		nullableString(data.LinkedTransactionId),
+		nullableString(data.CardId),
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "transactions_pkey" {
+		return ErrTransactionExists
+	}
+
+	return err
+}
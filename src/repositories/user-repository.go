@@ -10,6 +10,7 @@ import (
 type UserRepository interface {
 	Create(ctx context.Context, user *entities.User) (string, error)
 	FindByUsername(ctx context.Context, username string) (entities.User, error)
+	GetById(ctx context.Context, id string) (entities.User, error)
 }
 
 type UserRepositoryPgx struct {
@@ -23,11 +24,12 @@ func NewUserRepository(pool *pgxpool.Pool) *UserRepositoryPgx {
 func (this *UserRepositoryPgx) Create(ctx context.Context, user *entities.User) (string, error) {
 	_, err := this.pool.Exec(
 		ctx,
-		"insert into users (id, username, password, email) values ($1, $2, $3, $4)",
+		"insert into users (id, username, password, email, role) values ($1, $2, $3, $4, $5)",
 		user.ID,
 		user.Username,
 		user.Password,
 		user.Email,
+		user.Role,
 	)
 
 	if err != nil {
@@ -42,9 +44,25 @@ func (this *UserRepositoryPgx) FindByUsername(ctx context.Context, username stri
 
 	this.pool.QueryRow(
 		ctx,
-		"select id, username, password, email from users where username = $1",
+		"select id, username, password, email, role from users where username = $1",
 		username,
-	).Scan(&user.ID, &user.Username, &user.Password, &user.Email)
+	).Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role)
+
+	return user, nil
+}
+
+func (this *UserRepositoryPgx) GetById(ctx context.Context, id string) (entities.User, error) {
+	user := entities.User{}
+
+	err := this.pool.QueryRow(
+		ctx,
+		"select id, username, password, email, role from users where id = $1",
+		id,
+	).Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role)
+
+	if err != nil {
+		return entities.User{}, err
+	}
 
 	return user, nil
 }
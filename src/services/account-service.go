@@ -1,10 +1,13 @@
 package services
 
 import (
+	"bank-system/config"
 	"bank-system/src/entities"
 	"bank-system/src/repositories"
 	"context"
 	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,39 +15,58 @@ import (
 )
 
 type AccountService interface {
-	Create(ctx context.Context, userId string) (string, error)
+	Create(ctx context.Context, userId string, data entities.CreateAccountDto) (string, error)
 	GetAll(ctx context.Context, userId string) ([]entities.Account, error)
 	GetById(ctx context.Context, accountId string) (entities.Account, error)
 	UpdateBalance(ctx context.Context, accountId string, userId string, data entities.UpdateAccountBalanceDto) (string, error)
-	Delete(ctx context.Context, accountId string) (string, error)
+	Freeze(ctx context.Context, userId string, accountId string) (string, error)
+	Unfreeze(ctx context.Context, userId string, accountId string) (string, error)
+	Close(ctx context.Context, userId string, accountId string) (string, error)
+	UpdateOverdraft(ctx context.Context, userId string, accountId string, data entities.UpdateOverdraftDto) (entities.Account, error)
 	Transfer(ctx context.Context, userId string, data entities.TransferDto) (string, error)
+	TransferOnce(ctx context.Context, userId string, transactionId string, data entities.TransferDto) (string, error)
+	Exchange(ctx context.Context, userId string, data entities.ExchangeDto) (entities.ExchangeResponseDto, error)
 }
 
 type accountService struct {
-	accountRepository  repositories.AccountRepository
-	transactionService TransactionService
-	logger             *logrus.Logger
+	accountRepository    repositories.AccountRepository
+	ledgerRepository     repositories.LedgerRepository
+	exchangeRateProvider ExchangeRateProvider
+	exchangeConfig       config.ExchangeConfig
+	overdraftConfig      config.OverdraftConfig
+	logger               *logrus.Logger
 }
 
 func NewAccountService(
 	accountRepository repositories.AccountRepository,
-	transactionService TransactionService,
+	ledgerRepository repositories.LedgerRepository,
+	exchangeRateProvider ExchangeRateProvider,
 	logger *logrus.Logger,
 ) AccountService {
 	return &accountService{
-		accountRepository:  accountRepository,
-		transactionService: transactionService,
-		logger:             logger,
+		accountRepository:    accountRepository,
+		ledgerRepository:     ledgerRepository,
+		exchangeRateProvider: exchangeRateProvider,
+		exchangeConfig:       config.LoadExchangeConfig(),
+		overdraftConfig:      config.LoadOverdraftConfig(),
+		logger:               logger,
 	}
 }
 
-func (this *accountService) Create(ctx context.Context, userId string) (string, error) {
+func (this *accountService) Create(ctx context.Context, userId string, data entities.CreateAccountDto) (string, error) {
+	currency := data.Currency
+	if currency == "" {
+		currency = entities.DefaultCurrency
+	}
+
 	accountId, err := this.accountRepository.Create(
 		ctx,
 		entities.Account{
 			ID:        uuid.New().String(),
 			Balance:   0,
+			Currency:  currency,
 			UserID:    userId,
+			Status:    "active",
 			CreatedAt: time.Now().Unix(),
 		},
 	)
@@ -92,57 +114,156 @@ func (this *accountService) UpdateBalance(ctx context.Context, accountId string,
 		return "", errors.New("Unauthorised")
 	}
 
-	var newBalance int64
-
-	if data.Type == "deposit" {
-		newBalance = account.Balance + data.Amount
+	transaction := entities.Transaction{
+		ID:          requestId(ctx, userId),
+		Amount:      data.Amount,
+		Currency:    account.Currency,
+		ToAccountId: accountId,
+		Type:        data.Type,
+		Description: "",
+		CreatedAt:   time.Now().Unix(),
 	}
-	if data.Type == "withdrawal" {
-		newBalance = account.Balance - data.Amount
+	entry := newJournalEntry(transaction)
+
+	// Money enters and leaves the bank through the cash account
+	switch data.Type {
+	case "deposit":
+		entry.Debit(entities.CashLedgerAccount, data.Amount)
+		entry.Credit(accountId, data.Amount)
+	case "withdrawal", "payment":
+		entry.Debit(accountId, data.Amount)
+		entry.Credit(entities.CashLedgerAccount, data.Amount)
+	default:
+		this.logger.Errorf("Unsupported balance operation: %s", data.Type)
+		return "", errors.New("Unsupported balance operation")
 	}
 
-	err = this.accountRepository.UpdateBalance(ctx, accountId, newBalance)
+	err = this.ledgerRepository.Record(ctx, transaction, entry)
 	if err != nil {
 		this.logger.Errorf("Failed to update account: %v", err)
-		return "", err
+		return "", requestError(err)
 	}
 
 	this.logger.Info("Balance updated: ", accountId)
 
-	transactionId, err := this.transactionService.Create(
-		ctx,
-		userId,
-		entities.Transaction{
-			ID:          uuid.New().String(),
-			Amount:      data.Amount,
-			ToAccountId: accountId,
-			Type:        data.Type,
-			Description: "",
-			CreatedAt:   time.Now().Unix(),
-		},
-	)
+	return transaction.ID, nil
+}
+
+// getOwned returns the account if it belongs to the user.
+func (this *accountService) getOwned(ctx context.Context, userId string, accountId string) (entities.Account, error) {
+	account, err := this.accountRepository.GetById(ctx, accountId)
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return entities.Account{}, err
+	}
+
+	if account.UserID != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.Account{}, errors.New("Unauthorised")
+	}
+
+	return account, nil
+}
+
+// Freeze blocks debits from the account. Credits, e.g. incoming transfers, are still accepted.
+func (this *accountService) Freeze(ctx context.Context, userId string, accountId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, accountId)
 	if err != nil {
-		this.logger.Errorf("Failed to create transaction: %v", err)
 		return "", err
 	}
 
-	this.logger.Info("Transaction created: ", transactionId)
+	err = this.accountRepository.UpdateStatus(ctx, accountId, "active", "frozen")
+	if err != nil {
+		this.logger.Errorf("Failed to freeze account %s: %v", accountId, err)
+		return "", err
+	}
 
-	return transactionId, nil
+	this.logger.Info("Account frozen: ", accountId)
+
+	return accountId, nil
+}
+
+func (this *accountService) Unfreeze(ctx context.Context, userId string, accountId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, accountId)
+	if err != nil {
+		return "", err
+	}
+
+	err = this.accountRepository.UpdateStatus(ctx, accountId, "frozen", "active")
+	if err != nil {
+		this.logger.Errorf("Failed to unfreeze account %s: %v", accountId, err)
+		return "", err
+	}
+
+	this.logger.Info("Account unfrozen: ", accountId)
+
+	return accountId, nil
 }
 
-func (this *accountService) Delete(ctx context.Context, accountId string) (string, error) {
-	deletedAccountId, err := this.accountRepository.Delete(ctx, accountId)
+// UpdateOverdraft opts the account in to an overdraft up to data.Limit at the
+// current interest rate of the bank, or out of it when the limit is 0.
+func (this *accountService) UpdateOverdraft(ctx context.Context, userId string, accountId string, data entities.UpdateOverdraftDto) (entities.Account, error) {
+	account, err := this.getOwned(ctx, userId, accountId)
+	if err != nil {
+		return entities.Account{}, err
+	}
+
+	// The limits and the interest rate are set in rubles
+	if data.Limit > 0 && account.Currency != entities.DefaultCurrency {
+		this.logger.Errorf("Overdraft requested for a %s account %s", account.Currency, accountId)
+		return entities.Account{}, errors.New("Overdraft is available for RUB accounts only")
+	}
+
+	if data.Limit > this.overdraftConfig.MaxLimit {
+		this.logger.Errorf("Overdraft limit %d exceeds the maximum %d", data.Limit, this.overdraftConfig.MaxLimit)
+		return entities.Account{}, errors.New("Overdraft limit exceeds the maximum")
+	}
 
+	err = this.accountRepository.SetOverdraft(ctx, accountId, data.Limit, this.overdraftConfig.InterestRate)
+	if err != nil {
+		this.logger.Errorf("Failed to update overdraft of account %s: %v", accountId, err)
+		return entities.Account{}, err
+	}
+
+	account.OverdraftLimit = data.Limit
+	account.OverdraftRate = this.overdraftConfig.InterestRate
+
+	return account, nil
+}
+
+// Close closes an account with zero balance, no holds and no unpaid loans. Closed
+// accounts and their transactions are kept for statements and history.
+func (this *accountService) Close(ctx context.Context, userId string, accountId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, accountId)
 	if err != nil {
-		this.logger.Errorf("Failed to delete account: %v", err)
 		return "", err
 	}
 
-	return deletedAccountId, nil
+	err = this.accountRepository.Close(ctx, accountId, time.Now().Unix())
+	if err != nil {
+		this.logger.Errorf("Failed to close account %s: %v", accountId, err)
+		return "", err
+	}
+
+	this.logger.Info("Account closed: ", accountId)
+
+	return accountId, nil
 }
 
 func (this *accountService) Transfer(ctx context.Context, userId string, data entities.TransferDto) (string, error) {
+	transactionId, err := this.TransferOnce(ctx, userId, requestId(ctx, userId), data)
+	if err != nil {
+		return "", requestError(err)
+	}
+
+	return transactionId, nil
+}
+
+// TransferOnce makes a transfer recorded as transactionId, the debit leg when
+// the transfer is converted. It fails with repositories.ErrTransactionExists
+// when a transaction with this id has been recorded, so callers that derive
+// the id from what they pay for cannot pay twice.
+func (this *accountService) TransferOnce(ctx context.Context, userId string, transactionId string, data entities.TransferDto) (string, error) {
 	account, err := this.accountRepository.GetById(ctx, data.FromAccountId)
 	if err != nil {
 		this.logger.Errorf("Failed to get account: %v", err)
@@ -152,12 +273,43 @@ func (this *accountService) Transfer(ctx context.Context, userId string, data en
 		this.logger.Errorf("Unauthorised")
 		return "", errors.New("Unauthorised")
 	}
-	if account.Balance < data.Amount {
-		this.logger.Errorf("Insufficient balance")
-		return "", errors.New("Insufficient balance")
+
+	recipient, err := this.accountRepository.GetById(ctx, data.ToAccountId)
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return "", err
+	}
+
+	if recipient.Currency != account.Currency {
+		if !data.Convert {
+			this.logger.Errorf("Transfer from %s to %s account without conversion", account.Currency, recipient.Currency)
+			return "", errors.New("Account currencies differ, conversion is required")
+		}
+
+		exchange, err := this.convertBetween(ctx, transactionId, account, recipient, data.Amount, "transfer", data.Description)
+		if err != nil {
+			return "", err
+		}
+
+		return exchange.DebitTransactionId, nil
+	}
+
+	transaction := entities.Transaction{
+		ID:            transactionId,
+		Amount:        data.Amount,
+		Currency:      account.Currency,
+		FromAccountId: data.FromAccountId,
+		ToAccountId:   data.ToAccountId,
+		Type:          "transfer",
+		Description:   data.Description,
+		CreatedAt:     time.Now().Unix(),
 	}
+	entry := newJournalEntry(transaction)
+	entry.Debit(data.FromAccountId, data.Amount)
+	entry.Credit(data.ToAccountId, data.Amount)
 
-	err = this.accountRepository.Transfer(ctx, data.FromAccountId, data.ToAccountId, data.Amount)
+	// The balance is checked under the account lock in the same database transaction
+	err = this.ledgerRepository.Record(ctx, transaction, entry)
 	if err != nil {
 		this.logger.Errorf("Failed to transfer money: %v", err)
 		return "", err
@@ -165,19 +317,156 @@ func (this *accountService) Transfer(ctx context.Context, userId string, data en
 
 	this.logger.Info("Transfer successful")
 
-	transactionId, err := this.transactionService.Create(
+	return transaction.ID, nil
+}
+
+// convert prices amount in minor units of from in the currency to at the
+// exchange rate less the spread of the bank. It returns the amount due to the
+// customer and the spread, both in minor units of to.
+func (this *accountService) convert(ctx context.Context, amount int64, from string, to string) (int64, int64, error) {
+	fromCurrency, ok := entities.GetCurrency(from)
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported currency %s", from)
+	}
+	toCurrency, ok := entities.GetCurrency(to)
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported currency %s", to)
+	}
+
+	fromRate, err := this.exchangeRateProvider.GetRate(ctx, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	toRate, err := this.exchangeRateProvider.GetRate(ctx, to)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	gross := convertAmount(amount, fromCurrency, toCurrency, fromRate, toRate)
+	fee := int64(math.Ceil(float64(gross) * this.exchangeConfig.Spread / 100))
+
+	return gross - fee, fee, nil
+}
+
+// convertBetween debits from in its currency and credits to with the
+// converted amount. Each leg is a transaction in its own currency balanced
+// against the currency position of the bank, the spread is booked as income,
+// and the legs are linked to each other. The debit leg is recorded as debitId.
+func (this *accountService) convertBetween(
+	ctx context.Context,
+	debitId string,
+	from entities.Account,
+	to entities.Account,
+	amount int64,
+	transactionType string,
+	description string,
+) (entities.ExchangeResponseDto, error) {
+	converted, fee, err := this.convert(ctx, amount, from.Currency, to.Currency)
+	if err != nil {
+		this.logger.Errorf("Failed to convert %s to %s: %v", from.Currency, to.Currency, err)
+		return entities.ExchangeResponseDto{}, errors.New("Failed to convert currency")
+	}
+	if converted <= 0 {
+		this.logger.Errorf("Amount %d %s converts to nothing in %s", amount, from.Currency, to.Currency)
+		return entities.ExchangeResponseDto{}, errors.New("Amount is too small to convert")
+	}
+
+	now := time.Now().Unix()
+	debit := entities.Transaction{
+		ID:            debitId,
+		Amount:        amount,
+		Currency:      from.Currency,
+		FromAccountId: from.ID,
+		Type:          transactionType,
+		Description:   description,
+		CreatedAt:     now,
+	}
+	credit := entities.Transaction{
+		ID:          uuid.New().String(),
+		Amount:      converted,
+		Currency:    to.Currency,
+		ToAccountId: to.ID,
+		Type:        transactionType,
+		Description: description,
+		CreatedAt:   now,
+	}
+	debit.LinkedTransactionId = credit.ID
+	credit.LinkedTransactionId = debit.ID
+
+	debitEntry := newJournalEntry(debit)
+	debitEntry.Debit(from.ID, amount)
+	debitEntry.Credit(entities.FxLedgerAccount, amount)
+
+	creditEntry := newJournalEntry(credit)
+	creditEntry.Debit(entities.FxLedgerAccount, converted+fee)
+	creditEntry.Credit(to.ID, converted)
+	creditEntry.Credit(entities.FxIncomeLedgerAccount, fee)
+
+	err = this.ledgerRepository.RecordLinked(
 		ctx,
-		userId,
-		entities.Transaction{
-			ID:            uuid.New().String(),
-			Amount:        data.Amount,
-			FromAccountId: data.FromAccountId,
-			ToAccountId:   data.ToAccountId,
-			Type:          "transfer",
-			Description:   data.Description,
-			CreatedAt:     time.Now().Unix(),
-		},
+		[]entities.Transaction{debit, credit},
+		[]entities.JournalEntry{debitEntry, creditEntry},
 	)
+	if err != nil {
+		this.logger.Errorf("Failed to convert money: %v", err)
+		return entities.ExchangeResponseDto{}, err
+	}
 
-	return transactionId, nil
+	this.logger.Infof("Converted %d %s to %d %s", amount, from.Currency, converted, to.Currency)
+
+	// The effective rate, in units of the currencies rather than minor units
+	fromCurrency, _ := entities.GetCurrency(from.Currency)
+	toCurrency, _ := entities.GetCurrency(to.Currency)
+	rate := (float64(converted) / math.Pow10(toCurrency.MinorUnits)) / (float64(amount) / math.Pow10(fromCurrency.MinorUnits))
+
+	return entities.ExchangeResponseDto{
+		DebitTransactionId:  debit.ID,
+		CreditTransactionId: credit.ID,
+		Amount:              amount,
+		Currency:            from.Currency,
+		ConvertedAmount:     converted,
+		ConvertedCurrency:   to.Currency,
+		Rate:                rate,
+		Fee:                 fee,
+	}, nil
+}
+
+// Exchange converts money between two accounts of the user in different currencies.
+func (this *accountService) Exchange(ctx context.Context, userId string, data entities.ExchangeDto) (entities.ExchangeResponseDto, error) {
+	from, err := this.accountRepository.GetById(ctx, data.FromAccountId)
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return entities.ExchangeResponseDto{}, err
+	}
+
+	to, err := this.accountRepository.GetById(ctx, data.ToAccountId)
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return entities.ExchangeResponseDto{}, err
+	}
+
+	if from.UserID != userId || to.UserID != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.ExchangeResponseDto{}, errors.New("Unauthorised")
+	}
+
+	if from.Currency == to.Currency {
+		this.logger.Errorf("Exchange between %s accounts %s and %s", from.Currency, from.ID, to.ID)
+		return entities.ExchangeResponseDto{}, errors.New("Accounts are in the same currency")
+	}
+
+	exchange, err := this.convertBetween(
+		ctx,
+		requestId(ctx, userId),
+		from,
+		to,
+		data.Amount,
+		"exchange",
+		fmt.Sprintf("Exchange %s to %s", from.Currency, to.Currency),
+	)
+	if err != nil {
+		return entities.ExchangeResponseDto{}, requestError(err)
+	}
+
+	return exchange, nil
 }
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bank-system/src/utils"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// CardKeyProvider wraps the data encryption keys of cards with master keys
+// it keeps. A KMS or HSM implements it with its encrypt and decrypt
+// operations, so the master keys never leave it.
+type CardKeyProvider interface {
+	// WrapKey encrypts a data key with the current master key and returns the
+	// id of the master key with the wrapped key.
+	WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error)
+	// UnwrapKey decrypts a data key wrapped with the master key keyId.
+	UnwrapKey(ctx context.Context, keyId string, wrappedKey []byte) ([]byte, error)
+	// CurrentKeyId is the master key new data keys are wrapped with.
+	CurrentKeyId() string
+}
+
+type localCardKeyProvider struct {
+	keys         map[string][]byte
+	currentKeyId string
+}
+
+// NewLocalCardKeyProvider keeps the master keys in memory. keys are comma or
+// newline separated "id:base64 key" pairs of 32-byte keys, e.g. from the
+// environment or a file. Keys other than the current one are kept to unwrap
+// data keys until they are rotated.
+func NewLocalCardKeyProvider(keys string, currentKeyId string) (CardKeyProvider, error) {
+	provider := &localCardKeyProvider{
+		keys:         make(map[string][]byte),
+		currentKeyId: currentKeyId,
+	}
+
+	pairs := strings.FieldsFunc(keys, func(r rune) bool {
+		return r == ',' || r == '\n'
+	})
+	for _, pair := range pairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid master key %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("master key %s must be 32 bytes encoded in base64", id)
+		}
+
+		provider.keys[id] = key
+	}
+
+	if _, ok := provider.keys[currentKeyId]; !ok {
+		return nil, fmt.Errorf("no master key %s", currentKeyId)
+	}
+
+	return provider, nil
+}
+
+func (this *localCardKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	wrappedKey, err := utils.EncryptWithAES(dataKey, this.keys[this.currentKeyId])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return this.currentKeyId, wrappedKey, nil
+}
+
+func (this *localCardKeyProvider) UnwrapKey(ctx context.Context, keyId string, wrappedKey []byte) ([]byte, error) {
+	key, ok := this.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("no master key %s", keyId)
+	}
+
+	return utils.DecryptWithAES(wrappedKey, key)
+}
+
+func (this *localCardKeyProvider) CurrentKeyId() string {
+	return this.currentKeyId
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"bank-system/config"
 	"bank-system/src/entities"
 	"bank-system/src/repositories"
 	"bank-system/src/utils"
@@ -9,33 +10,59 @@ import (
 
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrCardNotIndexed is returned when a card is paid with by its number before
+// the number has been indexed, which needs the number decrypted once.
+var ErrCardNotIndexed = errors.New("Card number is not indexed yet, pass the pgpKey of the card or read it once with POST /cards/info")
+
 type CardService interface {
 	Create(ctx context.Context, userId string, data entities.CreateCardDto) (entities.CreateCardResponseDto, error)
 	GetInfo(ctx context.Context, userId string, data entities.GetCardInfoDto) (entities.GetCardInfoResponseDto, error)
+	GetAll(ctx context.Context, userId string) ([]entities.CardResponseDto, error)
+	Block(ctx context.Context, userId string, cardId string) (string, error)
+	Unblock(ctx context.Context, userId string, cardId string) (string, error)
+	Close(ctx context.Context, userId string, cardId string) (string, error)
+	Reissue(ctx context.Context, userId string, cardId string) (entities.CreateCardResponseDto, error)
+	GetControls(ctx context.Context, userId string, cardId string) (entities.CardControls, error)
+	UpdateControls(ctx context.Context, userId string, cardId string, data entities.CardControls) (entities.CardControls, error)
 	Pay(ctx context.Context, userId string, data entities.PayCardDto) (string, error)
+	Authorize(ctx context.Context, userId string, data entities.AuthorizeCardDto) (entities.Hold, error)
+	GetHolds(ctx context.Context, userId string) ([]entities.Hold, error)
+	GetHold(ctx context.Context, userId string, holdId string) (entities.Hold, error)
+	Capture(ctx context.Context, adminId string, holdId string, data entities.CaptureHoldDto) (entities.Hold, error)
+	Void(ctx context.Context, adminId string, holdId string) (entities.Hold, error)
+	RotateKeys(ctx context.Context) (int, error)
 }
 
 type cardService struct {
-	accountService AccountService
-	cardRepository repositories.CardRepository
-	logger         *logrus.Logger
+	accountService  AccountService
+	cardRepository  repositories.CardRepository
+	holdRepository  repositories.HoldRepository
+	cardKeyProvider CardKeyProvider
+	cardConfig      config.CardConfig
+	logger          *logrus.Logger
 }
 
 func NewCardService(
 	accountService AccountService,
 	cardRepository repositories.CardRepository,
+	holdRepository repositories.HoldRepository,
+	cardKeyProvider CardKeyProvider,
 	logger *logrus.Logger,
 ) CardService {
 	return &cardService{
-		accountService: accountService,
-		cardRepository: cardRepository,
-		logger:         logger,
+		accountService:  accountService,
+		cardRepository:  cardRepository,
+		holdRepository:  holdRepository,
+		cardKeyProvider: cardKeyProvider,
+		cardConfig:      config.LoadCardConfig(),
+		logger:          logger,
 	}
 }
 
@@ -49,10 +76,11 @@ func (this *cardService) generateCardNumber() string {
 		cardNumber[i] = byte(rand.Intn(10)) + '0'
 	}
 
+	// Every second digit is doubled, starting with the one next to the check digit
 	sum := 0
 	for i := len(cardNumber) - 1; i >= 0; i-- {
 		digit := int(cardNumber[i] - '0')
-		if (len(cardNumber)-i)%2 == 0 {
+		if (len(cardNumber)-i)%2 == 1 {
 			digit *= 2
 			if digit > 9 {
 				digit -= 9
@@ -79,6 +107,12 @@ func (this *cardService) generateCVV() string {
 	return string(cvv)
 }
 
+// hashCardNumber returns the keyed hash the card is found by. Unlike the
+// encrypted number it is the same for every card with this number.
+func (this *cardService) hashCardNumber(cardNumber string) string {
+	return utils.HashWithHMAC(cardNumber, this.cardConfig.NumberHashKey)
+}
+
 func (this *cardService) hashCVV(cvv string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(cvv), bcrypt.DefaultCost)
 	if err != nil {
@@ -87,163 +121,715 @@ func (this *cardService) hashCVV(cvv string) (string, error) {
 	return string(hash), nil
 }
 
-func (this *cardService) Create(ctx context.Context, userId string, data entities.CreateCardDto) (entities.CreateCardResponseDto, error) {
-	account, err := this.accountService.GetById(ctx, data.AccountID)
-
+// encrypt encrypts the number and the expiration date of the card with a new
+// data key of the card and wraps the key with the current master key.
+func (this *cardService) encrypt(ctx context.Context, card *entities.Card, cardNumber string, expiration string) error {
+	dataKey, err := utils.GenerateKey()
 	if err != nil {
-		this.logger.Errorf("Failed to get account: %v", err)
-		return entities.CreateCardResponseDto{}, err
-	}
-	if account.UserID != userId {
-		this.logger.Error("Unauthorised")
-		return entities.CreateCardResponseDto{}, errors.New("Unauthorised")
+		this.logger.Errorf("Failed to generate card data key: %v", err)
+		return err
 	}
 
-	cardNumber := this.generateCardNumber()
-	encryptedCardNumber, err := utils.EncryptWithPGP(
-		cardNumber,
-		data.PGPKey,
-	)
+	card.Number, err = utils.EncryptWithAES([]byte(cardNumber), dataKey)
 	if err != nil {
 		this.logger.Errorf("Failed to encrypt card number: %v", err)
-		return entities.CreateCardResponseDto{}, err
+		return err
 	}
 
-	expiration := time.Now().AddDate(5, 0, 0).Format("2006-01-02")
-	encryptedCardExpiration, err := utils.EncryptWithPGP(expiration, data.PGPKey)
+	card.Expiration, err = utils.EncryptWithAES([]byte(expiration), dataKey)
 	if err != nil {
 		this.logger.Errorf("Failed to encrypt card expiration: %v", err)
-		return entities.CreateCardResponseDto{}, err
+		return err
+	}
+
+	card.KeyId, card.DataKey, err = this.cardKeyProvider.WrapKey(ctx, dataKey)
+	if err != nil {
+		this.logger.Errorf("Failed to wrap card data key: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// decrypt returns the number and the expiration date of the card.
+func (this *cardService) decrypt(ctx context.Context, card entities.Card, pgpKey string) (string, string, error) {
+	if card.KeyId == "" {
+		return this.decryptLegacy(ctx, card, pgpKey)
+	}
+
+	dataKey, err := this.cardKeyProvider.UnwrapKey(ctx, card.KeyId, card.DataKey)
+	if err != nil {
+		this.logger.Errorf("Failed to unwrap data key of card %s: %v", card.ID, err)
+		return "", "", err
+	}
+
+	cardNumber, err := utils.DecryptWithAES(card.Number, dataKey)
+	if err != nil {
+		this.logger.Errorf("Failed to decrypt card number: %v", err)
+		return "", "", err
+	}
+
+	expiration, err := utils.DecryptWithAES(card.Expiration, dataKey)
+	if err != nil {
+		this.logger.Errorf("Failed to decrypt card expiration: %v", err)
+		return "", "", err
+	}
+
+	return string(cardNumber), string(expiration), nil
+}
+
+// decryptLegacy decrypts a card encrypted with a key supplied by the client
+// and re-encrypts it with a data key, so the client key is not needed again.
+func (this *cardService) decryptLegacy(ctx context.Context, card entities.Card, pgpKey string) (string, string, error) {
+	if pgpKey == "" {
+		this.logger.Errorf("No pgpKey for card %s encrypted with a client key", card.ID)
+		return "", "", errors.New("pgpKey is required for the card")
+	}
+
+	cardNumber, err := utils.DecryptWithPGP(card.Number, pgpKey)
+	if err != nil {
+		this.logger.Errorf("Failed to decrypt card number: %v", err)
+		return "", "", err
+	}
+
+	expiration, err := utils.DecryptWithPGP(card.Expiration, pgpKey)
+	if err != nil {
+		this.logger.Errorf("Failed to decrypt card expiration: %v", err)
+		return "", "", err
 	}
 
+	err = this.encrypt(ctx, &card, cardNumber, expiration)
+	if err == nil {
+		err = this.cardRepository.SetEncryption(ctx, card.ID, card)
+	}
+	if err != nil {
+		this.logger.Errorf("Failed to re-encrypt card %s: %v", card.ID, err)
+	} else {
+		this.logger.Info("Card re-encrypted with a data key: ", card.ID)
+	}
+
+	return cardNumber, expiration, nil
+}
+
+// issue generates the number, expiration date and CVV of a new card of the
+// account and returns the card to store together with its details for the user.
+func (this *cardService) issue(ctx context.Context, userId string, accountId string) (entities.Card, entities.CreateCardResponseDto, error) {
+	cardNumber := this.generateCardNumber()
+	expiration := time.Now().AddDate(5, 0, 0).Format("2006-01-02")
+
 	cvv := this.generateCVV()
 	cvvHash, err := this.hashCVV(cvv)
 	if err != nil {
 		this.logger.Errorf("Failed to hash cvv: %v", err)
-		return entities.CreateCardResponseDto{}, err
+		return entities.Card{}, entities.CreateCardResponseDto{}, err
 	}
 
-	cardId, err := this.cardRepository.Create(
-		ctx,
-		entities.Card{
-			ID:         uuid.New().String(),
-			Number:     encryptedCardNumber,
-			Expiration: encryptedCardExpiration,
-			CVV:        cvvHash,
-			UserId:     userId,
-			AccountID:  data.AccountID,
-			CreatedAt:  time.Now().Unix(),
+	card := entities.Card{
+		ID:         uuid.New().String(),
+		NumberHash: this.hashCardNumber(cardNumber),
+		CVV:        cvvHash,
+		Last4:      cardNumber[len(cardNumber)-4:],
+		UserId:     userId,
+		AccountID:  accountId,
+		Status:     "active",
+		Controls: entities.CardControls{
+			OnlineEnabled: true,
+			BlockedMccs:   []string{},
 		},
-	)
+		CreatedAt: time.Now().Unix(),
+	}
 
+	err = this.encrypt(ctx, &card, cardNumber, expiration)
 	if err != nil {
-		this.logger.Errorf("Failed to create card: %v", err)
-		return entities.CreateCardResponseDto{}, err
+		return entities.Card{}, entities.CreateCardResponseDto{}, err
 	}
 
 	createdCard := entities.CreateCardResponseDto{
-		ID:         cardId,
+		ID:         card.ID,
 		Number:     cardNumber,
 		Expiration: expiration,
 		CVV:        cvv,
 	}
+
+	return card, createdCard, nil
+}
+
+// getActiveAccount returns the account of the user if new cards may be issued for it.
+func (this *cardService) getActiveAccount(ctx context.Context, userId string, accountId string) (entities.Account, error) {
+	account, err := this.accountService.GetById(ctx, accountId)
+
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return entities.Account{}, err
+	}
+	if account.UserID != userId {
+		this.logger.Error("Unauthorised")
+		return entities.Account{}, errors.New("Unauthorised")
+	}
+	if account.Status != "active" {
+		this.logger.Errorf("Card requested for %s account %s", account.Status, account.ID)
+		return entities.Account{}, errors.New("Account is not active")
+	}
+
+	return account, nil
+}
+
+func (this *cardService) Create(ctx context.Context, userId string, data entities.CreateCardDto) (entities.CreateCardResponseDto, error) {
+	_, err := this.getActiveAccount(ctx, userId, data.AccountID)
+	if err != nil {
+		return entities.CreateCardResponseDto{}, err
+	}
+
+	card, createdCard, err := this.issue(ctx, userId, data.AccountID)
+	if err != nil {
+		return entities.CreateCardResponseDto{}, err
+	}
+
+	_, err = this.cardRepository.Create(ctx, card)
+	if err != nil {
+		this.logger.Errorf("Failed to create card: %v", err)
+		return entities.CreateCardResponseDto{}, err
+	}
+
 	return createdCard, nil
 }
 
-func (this *cardService) GetInfo(ctx context.Context, userId string, data entities.GetCardInfoDto) (entities.GetCardInfoResponseDto, error) {
-	card, err := this.cardRepository.GetById(ctx, data.CardId)
+func (this *cardService) GetAll(ctx context.Context, userId string) ([]entities.CardResponseDto, error) {
+	cards, err := this.cardRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get cards: %v", err)
+		return nil, err
+	}
+
+	response := make([]entities.CardResponseDto, len(cards))
+	for i, card := range cards {
+		response[i] = entities.CardResponseDto{
+			ID:           card.ID,
+			MaskedNumber: entities.MaskCardNumber(card.Last4),
+			AccountID:    card.AccountID,
+			Status:       card.Status,
+			ReissuedFrom: card.ReissuedFrom,
+			CreatedAt:    card.CreatedAt,
+			ClosedAt:     card.ClosedAt,
+		}
+	}
+
+	return response, nil
+}
+
+// getOwned returns the card if it belongs to the user.
+func (this *cardService) getOwned(ctx context.Context, userId string, cardId string) (entities.Card, error) {
+	card, err := this.cardRepository.GetById(ctx, cardId)
 	if err != nil {
 		this.logger.Errorf("Failed to get card: %v", err)
-		return entities.GetCardInfoResponseDto{}, err
+		return entities.Card{}, err
 	}
 
 	if card.UserId != userId {
 		this.logger.Error("Unauthorised")
-		return entities.GetCardInfoResponseDto{}, errors.New("Unauthorised")
+		return entities.Card{}, errors.New("Unauthorised")
 	}
 
-	decryptedCardNumber, err := utils.DecryptWithPGP(card.Number, data.PGPKey)
+	return card, nil
+}
+
+// Block stops payments by the card until it is unblocked. Authorized holds
+// can still be captured.
+func (this *cardService) Block(ctx context.Context, userId string, cardId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return "", err
+	}
+
+	err = this.cardRepository.UpdateStatus(ctx, cardId, "active", "blocked")
+	if err != nil {
+		this.logger.Errorf("Failed to block card %s: %v", cardId, err)
+		return "", err
+	}
+
+	this.logger.Info("Card blocked: ", cardId)
+
+	return cardId, nil
+}
+
+func (this *cardService) Unblock(ctx context.Context, userId string, cardId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return "", err
+	}
+
+	err = this.cardRepository.UpdateStatus(ctx, cardId, "blocked", "active")
+	if err != nil {
+		this.logger.Errorf("Failed to unblock card %s: %v", cardId, err)
+		return "", err
+	}
+
+	this.logger.Info("Card unblocked: ", cardId)
+
+	return cardId, nil
+}
+
+func (this *cardService) Close(ctx context.Context, userId string, cardId string) (string, error) {
+	_, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return "", err
+	}
+
+	err = this.cardRepository.Close(ctx, cardId, time.Now().Unix())
+	if err != nil {
+		this.logger.Errorf("Failed to close card %s: %v", cardId, err)
+		return "", err
+	}
+
+	this.logger.Info("Card closed: ", cardId)
+
+	return cardId, nil
+}
+
+// Reissue replaces an active or blocked card, e.g. a lost one, with a new
+// card of the same account and closes the old one.
+func (this *cardService) Reissue(ctx context.Context, userId string, cardId string) (entities.CreateCardResponseDto, error) {
+	oldCard, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return entities.CreateCardResponseDto{}, err
+	}
+
+	if oldCard.Status == "closed" {
+		this.logger.Errorf("Reissue of closed card %s", cardId)
+		return entities.CreateCardResponseDto{}, repositories.ErrCardStatusChanged
+	}
+
+	_, err = this.getActiveAccount(ctx, userId, oldCard.AccountID)
+	if err != nil {
+		return entities.CreateCardResponseDto{}, err
+	}
+
+	card, createdCard, err := this.issue(ctx, userId, oldCard.AccountID)
+	if err != nil {
+		return entities.CreateCardResponseDto{}, err
+	}
+	card.ReissuedFrom = oldCard.ID
+	// The replacement keeps the spending rules of the old card
+	card.Controls = oldCard.Controls
+
+	err = this.cardRepository.Reissue(ctx, oldCard.ID, card)
+	if err != nil {
+		this.logger.Errorf("Failed to reissue card %s: %v", cardId, err)
+		return entities.CreateCardResponseDto{}, err
+	}
+
+	this.logger.Infof("Card %s reissued as %s", oldCard.ID, card.ID)
+
+	return createdCard, nil
+}
+
+func (this *cardService) GetInfo(ctx context.Context, userId string, data entities.GetCardInfoDto) (entities.GetCardInfoResponseDto, error) {
+	card, err := this.getOwned(ctx, userId, data.CardId)
 	if err != nil {
-		this.logger.Errorf("Failed to decrypt card number: %v", err)
 		return entities.GetCardInfoResponseDto{}, err
 	}
-	decryptedCardExpiration, err := utils.DecryptWithPGP(card.Expiration, data.PGPKey)
+
+	decryptedCardNumber, decryptedCardExpiration, err := this.decrypt(ctx, card, data.PGPKey)
 	if err != nil {
-		this.logger.Errorf("Failed to decrypt card expiration: %v", err)
 		return entities.GetCardInfoResponseDto{}, err
 	}
 
+	// Cards issued before the number index are indexed once their owner reads them
+	if card.NumberHash == "" {
+		err = this.cardRepository.SetNumberIndex(ctx, card.ID, this.hashCardNumber(decryptedCardNumber), decryptedCardNumber[len(decryptedCardNumber)-4:])
+		if err != nil {
+			this.logger.Errorf("Failed to index card number of card %s: %v", card.ID, err)
+		}
+	}
+
 	decryptedCard := entities.GetCardInfoResponseDto{
 		ID:         card.ID,
 		Number:     decryptedCardNumber,
 		Expiration: decryptedCardExpiration,
 		UserId:     card.UserId,
 		AccountID:  card.AccountID,
+		Status:     card.Status,
 		CreatedAt:  card.CreatedAt,
 	}
 
 	return decryptedCard, nil
 }
 
-func (this *cardService) Pay(ctx context.Context, userId string, data entities.PayCardDto) (string, error) {
-	card, err := this.cardRepository.GetById(ctx, data.CardId)
+// indexCards indexes the numbers of the cards of the user issued before the
+// number index, decrypting cards still encrypted with a client key with
+// pgpKey. It reports whether some cards could not be decrypted.
+func (this *cardService) indexCards(ctx context.Context, userId string, pgpKey string) (bool, error) {
+	cards, err := this.cardRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get cards: %v", err)
+		return false, err
+	}
+
+	skipped := false
+	for _, card := range cards {
+		if card.NumberHash != "" {
+			continue
+		}
+
+		cardNumber, _, err := this.decrypt(ctx, card, pgpKey)
+		if err != nil {
+			skipped = true
+			continue
+		}
+
+		err = this.cardRepository.SetNumberIndex(ctx, card.ID, this.hashCardNumber(cardNumber), cardNumber[len(cardNumber)-4:])
+		if err != nil {
+			this.logger.Errorf("Failed to index card number of card %s: %v", card.ID, err)
+			return false, err
+		}
+
+		this.logger.Info("Card number indexed: ", card.ID)
+	}
+
+	return skipped, nil
+}
+
+// verify returns the active card of the user with the number if the
+// expiration date and the CVV match and the card has not expired. Cards of
+// the user issued before the number index are indexed first when the number
+// is not found.
+func (this *cardService) verify(ctx context.Context, userId string, cardNumber string, expiration string, cvv string, pgpKey string) (entities.Card, error) {
+	numberHash := this.hashCardNumber(cardNumber)
+
+	card, err := this.cardRepository.GetByNumberHash(ctx, numberHash)
+	if errors.Is(err, repositories.ErrCardNotFound) {
+		skipped, indexErr := this.indexCards(ctx, userId, pgpKey)
+		if indexErr != nil {
+			return entities.Card{}, indexErr
+		}
+
+		card, err = this.cardRepository.GetByNumberHash(ctx, numberHash)
+		if errors.Is(err, repositories.ErrCardNotFound) && skipped {
+			this.logger.Errorf("Card of user %s not found among indexed cards, some cards are not indexed", userId)
+			return entities.Card{}, ErrCardNotIndexed
+		}
+	}
 	if err != nil {
 		this.logger.Errorf("Failed to get card: %v", err)
-		return "", err
+		return entities.Card{}, err
 	}
 	if card.UserId != userId {
 		this.logger.Error("Unauthorised")
-		return "", errors.New("Unauthorised")
+		return entities.Card{}, errors.New("Unauthorised")
+	}
+
+	if card.Status != "active" {
+		this.logger.Errorf("Payment by %s card %s", card.Status, card.ID)
+		return entities.Card{}, fmt.Errorf("Card is %s", card.Status)
 	}
 
-	decryptedCardExpiration, err := utils.DecryptWithPGP(card.Expiration, data.PGPKey)
+	_, decryptedCardExpiration, err := this.decrypt(ctx, card, pgpKey)
 	if err != nil {
-		this.logger.Errorf("Failed to decrypt card expiration: %v", err)
-		return "", err
+		return entities.Card{}, err
 	}
 
 	expirationTime, err := time.Parse("2006-01-02", decryptedCardExpiration)
 	if err != nil {
 		this.logger.Errorf("Failed to parse card expiration: %v", err)
-		return "", err
+		return entities.Card{}, err
 	}
 
 	if time.Now().After(expirationTime) {
 		this.logger.Error("Card expired")
-		return "", errors.New("Card expired")
+		return entities.Card{}, errors.New("Card expired")
 	}
 
-	if decryptedCardExpiration != data.Expiration {
+	if decryptedCardExpiration != expiration {
 		this.logger.Error("Invalid card expiration")
-		return "", errors.New("Invalid card expiration")
+		return entities.Card{}, errors.New("Invalid card expiration")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(card.CVV), []byte(data.CVV))
+	err = bcrypt.CompareHashAndPassword([]byte(card.CVV), []byte(cvv))
 	if err != nil {
 		this.logger.Errorf("Failed to compare cvv: %v", err)
-		return "", errors.New("Invalid cvv")
+		return entities.Card{}, errors.New("Invalid cvv")
+	}
+
+	return card, nil
+}
+
+func (this *cardService) GetControls(ctx context.Context, userId string, cardId string) (entities.CardControls, error) {
+	card, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return entities.CardControls{}, err
+	}
+
+	return card.Controls, nil
+}
+
+func (this *cardService) UpdateControls(ctx context.Context, userId string, cardId string, data entities.CardControls) (entities.CardControls, error) {
+	_, err := this.getOwned(ctx, userId, cardId)
+	if err != nil {
+		return entities.CardControls{}, err
+	}
+
+	if data.BlockedMccs == nil {
+		data.BlockedMccs = []string{}
+	}
+
+	err = this.cardRepository.UpdateControls(ctx, cardId, data)
+	if err != nil {
+		this.logger.Errorf("Failed to update controls of card %s: %v", cardId, err)
+		return entities.CardControls{}, err
+	}
+
+	this.logger.Info("Card controls updated: ", cardId)
+
+	return data, nil
+}
+
+// checkControls checks a payment by the card against the rules that do not
+// depend on its past payments. The daily and monthly limits are checked when
+// the payment is recorded.
+func (this *cardService) checkControls(card entities.Card, amount int64, mcc string, online bool) error {
+	if card.Controls.SingleLimit > 0 && amount > card.Controls.SingleLimit {
+		this.logger.Errorf("Payment of %d exceeds the single limit of card %s", amount, card.ID)
+		return errors.New("Amount exceeds the single payment limit of the card")
+	}
+
+	if online && !card.Controls.OnlineEnabled {
+		this.logger.Errorf("Online payment by card %s with online payments disabled", card.ID)
+		return errors.New("Online payments are disabled for the card")
+	}
+
+	if mcc != "" && card.Controls.BlocksMcc(mcc) {
+		this.logger.Errorf("Payment by card %s at blocked merchant category %s", card.ID, mcc)
+		return errors.New("Merchant category is blocked for the card")
+	}
+
+	return nil
+}
+
+func (this *cardService) Pay(ctx context.Context, userId string, data entities.PayCardDto) (string, error) {
+	card, err := this.verify(ctx, userId, data.CardNumber, data.Expiration, data.CVV, data.PGPKey)
+	if err != nil {
+		return "", err
+	}
+
+	err = this.checkControls(card, data.Amount, data.Mcc, data.Online)
+	if err != nil {
+		return "", err
 	}
 
 	account, err := this.accountService.GetById(ctx, card.AccountID)
 	if err != nil {
-		this.logger.Errorf("Failed to get account: %v", err)
 		return "", err
 	}
 
-	if account.Balance < data.Amount {
-		this.logger.Error("Insufficient funds")
-		return "", errors.New("Insufficient funds")
+	transaction := entities.Transaction{
+		ID:          requestId(ctx, userId),
+		Amount:      data.Amount,
+		Currency:    account.Currency,
+		ToAccountId: card.AccountID,
+		Type:        "payment",
+		Description: "",
+		CreatedAt:   time.Now().Unix(),
+		CardId:      card.ID,
 	}
+	entry := newJournalEntry(transaction)
+	entry.Debit(card.AccountID, data.Amount)
+	entry.Credit(entities.CashLedgerAccount, data.Amount)
 
-	transactionId, err := this.accountService.UpdateBalance(
-		ctx,
-		account.ID,
-		userId,
-		entities.UpdateAccountBalanceDto{
-			Amount: data.Amount,
-			Type:   "payment",
-		},
-	)
+	err = this.cardRepository.Pay(ctx, card.ID, transaction, entry)
+	if err != nil {
+		this.logger.Errorf("Failed to pay by card %s: %v", card.ID, err)
+		return "", requestError(err)
+	}
+
+	this.logger.Info("Card payment: ", transaction.ID)
+
+	return transaction.ID, nil
+}
+
+// Authorize reserves the amount on the account of the card until the hold is
+// captured or voided, or expires after the configured time.
+func (this *cardService) Authorize(ctx context.Context, userId string, data entities.AuthorizeCardDto) (entities.Hold, error) {
+	card, err := this.verify(ctx, userId, data.CardNumber, data.Expiration, data.CVV, data.PGPKey)
+	if err != nil {
+		return entities.Hold{}, err
+	}
+
+	err = this.checkControls(card, data.Amount, data.Mcc, data.Online)
+	if err != nil {
+		return entities.Hold{}, err
+	}
+
+	account, err := this.accountService.GetById(ctx, card.AccountID)
+	if err != nil {
+		return entities.Hold{}, err
+	}
+
+	now := time.Now()
+	hold := entities.Hold{
+		ID:          requestId(ctx, userId),
+		CardId:      card.ID,
+		AccountId:   card.AccountID,
+		UserId:      userId,
+		Amount:      data.Amount,
+		Currency:    account.Currency,
+		Description: data.Description,
+		Status:      "authorized",
+		ExpiresAt:   now.Add(this.cardConfig.HoldTTL).Unix(),
+		CreatedAt:   now.Unix(),
+		UpdatedAt:   now.Unix(),
+	}
+
+	err = this.holdRepository.Authorize(ctx, hold)
+	if err != nil {
+		this.logger.Errorf("Failed to authorize card payment: %v", err)
+		return entities.Hold{}, requestError(err)
+	}
+
+	this.logger.Info("Card payment authorized: ", hold.ID)
+
+	return hold, nil
+}
+
+func (this *cardService) GetHolds(ctx context.Context, userId string) ([]entities.Hold, error) {
+	holds, err := this.holdRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get holds: %v", err)
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func (this *cardService) GetHold(ctx context.Context, userId string, holdId string) (entities.Hold, error) {
+	hold, err := this.holdRepository.GetById(ctx, holdId)
+	if err != nil {
+		this.logger.Errorf("Failed to get hold: %v", err)
+		return entities.Hold{}, err
+	}
+
+	if hold.UserId != userId {
+		this.logger.Error("Unauthorised")
+		return entities.Hold{}, errors.New("Unauthorised")
+	}
+
+	return hold, nil
+}
+
+// Capture debits data.Amount, or the whole hold when it is 0, and releases
+// the rest of the held amount. Holds are captured on behalf of the merchant,
+// never by the cardholder, and only until they expire.
+func (this *cardService) Capture(ctx context.Context, adminId string, holdId string, data entities.CaptureHoldDto) (entities.Hold, error) {
+	hold, err := this.holdRepository.GetById(ctx, holdId)
+	if err != nil {
+		this.logger.Errorf("Failed to get hold: %v", err)
+		return entities.Hold{}, err
+	}
+
+	now := time.Now().Unix()
+	if now >= hold.ExpiresAt {
+		this.logger.Errorf("Capture of hold %s expired at %d", hold.ID, hold.ExpiresAt)
+		return entities.Hold{}, errors.New("Hold has expired")
+	}
+
+	amount := data.Amount
+	if amount == 0 {
+		amount = hold.Amount
+	}
+
+	if amount > hold.Amount {
+		this.logger.Errorf("Capture of %d exceeds hold %s of %d", amount, hold.ID, hold.Amount)
+		return entities.Hold{}, errors.New("Capture amount exceeds the held amount")
+	}
+
+	transaction := entities.Transaction{
+		ID:          uuid.New().String(),
+		Amount:      amount,
+		Currency:    hold.Currency,
+		ToAccountId: hold.AccountId,
+		Type:        "payment",
+		Description: hold.Description,
+		CreatedAt:   now,
+		CardId:      hold.CardId,
+	}
+	entry := newJournalEntry(transaction)
+	// The funds were reserved when the payment was authorized
+	entry.Forced = true
+	entry.Debit(hold.AccountId, amount)
+	entry.Credit(entities.CashLedgerAccount, amount)
+
+	hold.Status = "captured"
+	hold.CapturedAmount = amount
+	hold.TransactionId = transaction.ID
+	hold.UpdatedAt = now
+
+	err = this.holdRepository.Capture(ctx, hold, transaction, entry)
+	if err != nil {
+		this.logger.Errorf("Failed to capture hold %s: %v", hold.ID, err)
+		return entities.Hold{}, err
+	}
+
+	this.logger.Infof("Hold %s captured by %s", hold.ID, adminId)
+
+	return hold, nil
+}
+
+// Void releases the hold without a debit on behalf of the merchant, the
+// cardholder cannot cancel a payment they have authorized.
+func (this *cardService) Void(ctx context.Context, adminId string, holdId string) (entities.Hold, error) {
+	hold, err := this.holdRepository.GetById(ctx, holdId)
+	if err != nil {
+		this.logger.Errorf("Failed to get hold: %v", err)
+		return entities.Hold{}, err
+	}
+
+	hold.Status = "voided"
+	hold.UpdatedAt = time.Now().Unix()
+
+	err = this.holdRepository.Release(ctx, hold)
+	if err != nil {
+		this.logger.Errorf("Failed to void hold %s: %v", hold.ID, err)
+		return entities.Hold{}, err
+	}
+
+	this.logger.Infof("Hold %s voided by %s", hold.ID, adminId)
+
+	return hold, nil
+}
+
+// RotateKeys rewraps the data keys of cards wrapped with previous master keys
+// with the current one and returns how many cards were rewrapped. The card
+// data stays encrypted with the same data keys.
+func (this *cardService) RotateKeys(ctx context.Context) (int, error) {
+	keyId := this.cardKeyProvider.CurrentKeyId()
+
+	cards, err := this.cardRepository.GetWithStaleKey(ctx, keyId)
+	if err != nil {
+		this.logger.Errorf("Failed to get cards to rotate keys of: %v", err)
+		return 0, err
+	}
+
+	rotated := 0
+	for _, card := range cards {
+		dataKey, err := this.cardKeyProvider.UnwrapKey(ctx, card.KeyId, card.DataKey)
+		if err != nil {
+			this.logger.Errorf("Failed to unwrap data key of card %s: %v", card.ID, err)
+			continue
+		}
+
+		newKeyId, wrappedKey, err := this.cardKeyProvider.WrapKey(ctx, dataKey)
+		if err != nil {
+			this.logger.Errorf("Failed to wrap data key of card %s: %v", card.ID, err)
+			continue
+		}
+
+		err = this.cardRepository.RewrapKey(ctx, card.ID, card.KeyId, wrappedKey, newKeyId)
+		if err != nil {
+			this.logger.Errorf("Failed to rewrap data key of card %s: %v", card.ID, err)
+			continue
+		}
+
+		rotated++
+	}
 
-	return transactionId, err
+	return rotated, nil
 }
@@ -0,0 +1,62 @@
+package services
+
+import "testing"
+
+// luhnValid reports whether the last digit of number is its Luhn check digit.
+func luhnValid(number string) bool {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if (len(number)-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+
+	return sum%10 == 0
+}
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		valid  bool
+	}{
+		{"4539578763621486", true},
+		{"4111111111111111", true},
+		{"5555555555554444", true},
+		{"4539578763621487", false},
+		{"4111111111111112", false},
+	}
+
+	for _, test := range tests {
+		if valid := luhnValid(test.number); valid != test.valid {
+			t.Errorf("luhnValid(%s) = %v, want %v", test.number, valid, test.valid)
+		}
+	}
+}
+
+func TestGenerateCardNumberPassesLuhnCheck(t *testing.T) {
+	service := &cardService{}
+
+	for range 1000 {
+		number := service.generateCardNumber()
+
+		if len(number) != 16 {
+			t.Fatalf("got card number %s of %d digits, want 16", number, len(number))
+		}
+		if number[0] < '4' || number[0] > '6' {
+			t.Errorf("got card number %s, want it to start with 4, 5 or 6", number)
+		}
+		for _, digit := range number {
+			if digit < '0' || digit > '9' {
+				t.Fatalf("got card number %s with a non-digit", number)
+			}
+		}
+		if !luhnValid(number) {
+			t.Errorf("card number %s fails the Luhn check", number)
+		}
+	}
+}
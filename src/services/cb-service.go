@@ -2,15 +2,36 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/beevik/etree"
 )
 
+// KeyRateProvider returns the current Central Bank key rate, percent per year.
+type KeyRateProvider interface {
+	GetKeyRate(ctx context.Context) (float64, error)
+}
+
+type cbrKeyRateProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewCbrKeyRateProvider queries the DailyInfo SOAP service of the Central Bank at url.
+func NewCbrKeyRateProvider(url string) KeyRateProvider {
+	return &cbrKeyRateProvider{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
 func buildSOAPRequest() string {
 	fromDate := time.Now().AddDate(0, 0, -30).Format("2006-01-02")
 	toDate := time.Now().Format("2006-01-02")
@@ -25,11 +46,12 @@ func buildSOAPRequest() string {
         </soap12:Envelope>`, fromDate, toDate)
 }
 
-func sendRequest(soapRequest string) ([]byte, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest(
+// sendSOAPRequest calls the method action of the DailyInfo service at url.
+func sendSOAPRequest(ctx context.Context, client *http.Client, url string, action string, soapRequest string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
-		"https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx",
+		url,
 		bytes.NewBuffer([]byte(soapRequest)),
 	)
 	if err != nil {
@@ -37,13 +59,18 @@ func sendRequest(soapRequest string) ([]byte, error) {
 	}
 	// Установка заголовков
 	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
-	req.Header.Set("SOAPAction", "http://web.cbr.ru/KeyRate")
+	req.Header.Set("SOAPAction", "http://web.cbr.ru/"+action)
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка запроса: %v", err)
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("неожиданный статус ответа: %d", resp.StatusCode)
+	}
+
 	// Чтение ответа
 	rawBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -78,18 +105,90 @@ func parseXMLResponse(rawBody []byte) (float64, error) {
 	return rate, nil
 }
 
-func GetCentralBankRate() (float64, error) {
+func (this *cbrKeyRateProvider) GetKeyRate(ctx context.Context) (float64, error) {
 	soapRequest := buildSOAPRequest()
-	rawBody, err := sendRequest(soapRequest)
+	rawBody, err := sendSOAPRequest(ctx, this.client, this.url, "KeyRate", soapRequest)
 	if err != nil {
 		return 0, err
 	}
-	rate, err := parseXMLResponse(rawBody)
+
+	return parseXMLResponse(rawBody)
+}
+
+// ExchangeRateSource returns the prices in rubles of one unit of every
+// currency it quotes, keyed by ISO 4217 code.
+type ExchangeRateSource interface {
+	GetRates(ctx context.Context) (map[string]float64, error)
+}
+
+type cbrExchangeRateSource struct {
+	url    string
+	client *http.Client
+}
+
+// NewCbrExchangeRateSource queries the official daily rates of the Central Bank at url.
+func NewCbrExchangeRateSource(url string) ExchangeRateSource {
+	return &cbrExchangeRateSource{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func buildCursOnDateRequest(date time.Time) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+        <soap12:Envelope xmlns:soap12="http://www.w3.org/2003/05/soap-envelope">
+            <soap12:Body>
+                <GetCursOnDate xmlns="http://web.cbr.ru/">
+                    <On_date>%s</On_date>
+                </GetCursOnDate>
+            </soap12:Body>
+        </soap12:Envelope>`, date.Format("2006-01-02"))
+}
+
+// parseCursOnDateResponse returns the rate of one unit of every currency;
+// the Central Bank quotes some of them per 10 or 100 units (Vnom).
+func parseCursOnDateResponse(rawBody []byte) (map[string]float64, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(rawBody); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга XML: %v", err)
+	}
+
+	valutes := doc.FindElements("//diffgram/ValuteData/ValuteCursOnDate")
+	if len(valutes) == 0 {
+		return nil, errors.New("данные по курсам валют не найдены")
+	}
+
+	rates := make(map[string]float64, len(valutes))
+	for _, valute := range valutes {
+		code := valute.FindElement("./VchCode")
+		nominal := valute.FindElement("./Vnom")
+		curs := valute.FindElement("./Vcurs")
+		if code == nil || nominal == nil || curs == nil {
+			return nil, errors.New("теги VchCode, Vnom или Vcurs отсутствуют")
+		}
+
+		parsedNominal, err := strconv.ParseFloat(strings.TrimSpace(nominal.Text()), 64)
+		if err != nil || parsedNominal <= 0 {
+			return nil, fmt.Errorf("ошибка конвертации номинала: %s", nominal.Text())
+		}
+
+		parsedCurs, err := strconv.ParseFloat(strings.TrimSpace(curs.Text()), 64)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка конвертации курса: %v", err)
+		}
+
+		rates[strings.TrimSpace(code.Text())] = parsedCurs / parsedNominal
+	}
+
+	return rates, nil
+}
+
+func (this *cbrExchangeRateSource) GetRates(ctx context.Context) (map[string]float64, error) {
+	soapRequest := buildCursOnDateRequest(time.Now())
+	rawBody, err := sendSOAPRequest(ctx, this.client, this.url, "GetCursOnDate", soapRequest)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	// Добавление маржи
-	rate += 5
-	return rate, nil
+	return parseCursOnDateResponse(rawBody)
 }
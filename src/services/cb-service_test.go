@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// keyRateResponse is a KeyRate response of the DailyInfo service, newest rate first.
+const keyRateResponse = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema">
+  <soap:Body>
+    <KeyRateResponse xmlns="http://web.cbr.ru/">
+      <KeyRateResult>
+        <xs:schema id="KeyRate" xmlns="" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:msdata="urn:schemas-microsoft-com:xml-msdata">
+          <xs:element name="KeyRate" msdata:IsDataSet="true" msdata:UseCurrentLocale="true">
+            <xs:complexType>
+              <xs:choice minOccurs="0" maxOccurs="unbounded">
+                <xs:element name="KR">
+                  <xs:complexType>
+                    <xs:sequence>
+                      <xs:element name="DT" type="xs:dateTime" minOccurs="0" />
+                      <xs:element name="Rate" type="xs:decimal" minOccurs="0" />
+                    </xs:sequence>
+                  </xs:complexType>
+                </xs:element>
+              </xs:choice>
+            </xs:complexType>
+          </xs:element>
+        </xs:schema>
+        <diffgr:diffgram xmlns:msdata="urn:schemas-microsoft-com:xml-msdata" xmlns:diffgr="urn:schemas-microsoft-com:xml-diffgram-v1">
+          <KeyRate xmlns="">
+            <KR diffgr:id="KR1" msdata:rowOrder="0">
+              <DT>2025-06-09T00:00:00+03:00</DT>
+              <Rate>20.00</Rate>
+            </KR>
+            <KR diffgr:id="KR2" msdata:rowOrder="1">
+              <DT>2025-06-06T00:00:00+03:00</DT>
+              <Rate>21.00</Rate>
+            </KR>
+          </KeyRate>
+        </diffgr:diffgram>
+      </KeyRateResult>
+    </KeyRateResponse>
+  </soap:Body>
+</soap:Envelope>`
+
+// fakeCbrServer answers every request with status and body and counts the requests.
+func fakeCbrServer(t *testing.T, status *atomic.Int32, body *atomic.Value) (*httptest.Server, *atomic.Int32) {
+	requests := &atomic.Int32{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		if r.Method != http.MethodPost || r.Header.Get("SOAPAction") != "http://web.cbr.ru/KeyRate" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		request, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(request), "<KeyRate xmlns=\"http://web.cbr.ru/\">") {
+			http.Error(w, "unexpected body", http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(int(status.Load()))
+		fmt.Fprint(w, body.Load().(string))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+func TestParseXMLResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		rate    float64
+		wantErr bool
+	}{
+		{"key rate response", keyRateResponse, 20, false},
+		{"not xml", "Service Unavailable", 0, true},
+		{"truncated", keyRateResponse[:len(keyRateResponse)/2], 0, true},
+		{"no rates", strings.Replace(keyRateResponse, "KR diffgr", "KX diffgr", -1), 0, true},
+		{"no rate tag", strings.Replace(keyRateResponse, "<Rate>20.00</Rate>", "", 1), 0, true},
+		{"rate is not a number", strings.Replace(keyRateResponse, "20.00", "n/a", 1), 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rate, err := parseXMLResponse([]byte(test.body))
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got rate %v, want an error", rate)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if rate != test.rate {
+				t.Errorf("got rate %v, want %v", rate, test.rate)
+			}
+		})
+	}
+}
+
+func TestCbrKeyRateProviderGetKeyRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		rate    float64
+		wantErr bool
+	}{
+		{"key rate response", http.StatusOK, keyRateResponse, 20, false},
+		{"malformed response", http.StatusOK, "<soap:Envelope><soap:Body>", 0, true},
+		{"outage", http.StatusServiceUnavailable, "Service Unavailable", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := &atomic.Int32{}
+			status.Store(int32(test.status))
+			body := &atomic.Value{}
+			body.Store(test.body)
+			server, _ := fakeCbrServer(t, status, body)
+
+			rate, err := NewCbrKeyRateProvider(server.URL).GetKeyRate(context.Background())
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got rate %v, want an error", rate)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if rate != test.rate {
+				t.Errorf("got rate %v, want %v", rate, test.rate)
+			}
+		})
+	}
+}
+
+func TestCbrKeyRateProviderUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	if rate, err := NewCbrKeyRateProvider(url).GetKeyRate(context.Background()); err == nil {
+		t.Fatalf("got rate %v, want an error", rate)
+	}
+}
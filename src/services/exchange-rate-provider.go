@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExchangeRateProvider returns the price in rubles of one unit of a currency.
+type ExchangeRateProvider interface {
+	GetRate(ctx context.Context, currency string) (float64, error)
+}
+
+type staticExchangeRateProvider struct {
+	rates map[string]float64
+}
+
+// NewStaticExchangeRateProvider returns the configured rates, the ruble always costs 1.
+func NewStaticExchangeRateProvider(rates map[string]float64) ExchangeRateProvider {
+	return &staticExchangeRateProvider{rates: rates}
+}
+
+func (this *staticExchangeRateProvider) GetRate(ctx context.Context, currency string) (float64, error) {
+	if currency == entities.DefaultCurrency {
+		return 1, nil
+	}
+
+	rate, ok := this.rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+
+	return rate, nil
+}
+
+type cachedExchangeRateProvider struct {
+	cache *rateCache[map[string]float64]
+}
+
+// NewCachedExchangeRateProvider keeps the rates returned by source for ttl
+// and persists every fetched set. When source fails, the last known good
+// rates are used, from memory or from the database, while they are not
+// older than maxAge; older rates are refused so that money is not converted
+// at outdated prices.
+func NewCachedExchangeRateProvider(
+	source ExchangeRateSource,
+	exchangeRateRepository repositories.ExchangeRateRepository,
+	ttl time.Duration,
+	maxAge time.Duration,
+	logger *logrus.Logger,
+) ExchangeRateProvider {
+	return &cachedExchangeRateProvider{
+		cache: &rateCache[map[string]float64]{
+			name:   "exchange rates",
+			ttl:    ttl,
+			maxAge: maxAge,
+			logger: logger,
+			fetch:  source.GetRates,
+			save: func(ctx context.Context, rates map[string]float64, fetchedAt time.Time) error {
+				exchangeRates := make([]entities.ExchangeRate, 0, len(rates))
+				for currency, rate := range rates {
+					exchangeRates = append(exchangeRates, entities.ExchangeRate{
+						Currency:  currency,
+						Rate:      rate,
+						FetchedAt: fetchedAt.Unix(),
+					})
+				}
+
+				return exchangeRateRepository.CreateMany(ctx, exchangeRates)
+			},
+			getLatest: func(ctx context.Context) (map[string]float64, time.Time, error) {
+				exchangeRates, err := exchangeRateRepository.GetLatest(ctx)
+				if err != nil {
+					return nil, time.Time{}, err
+				}
+				if len(exchangeRates) == 0 {
+					return nil, time.Time{}, errors.New("no exchange rates saved")
+				}
+
+				// The set is as old as its oldest rate
+				rates := make(map[string]float64, len(exchangeRates))
+				fetchedAt := exchangeRates[0].FetchedAt
+				for _, exchangeRate := range exchangeRates {
+					rates[exchangeRate.Currency] = exchangeRate.Rate
+					fetchedAt = min(fetchedAt, exchangeRate.FetchedAt)
+				}
+
+				return rates, time.Unix(fetchedAt, 0), nil
+			},
+		},
+	}
+}
+
+func (this *cachedExchangeRateProvider) GetRate(ctx context.Context, currency string) (float64, error) {
+	if currency == entities.DefaultCurrency {
+		return 1, nil
+	}
+
+	rates, err := this.cache.get(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rate, ok := rates[currency]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+
+	return rate, nil
+}
+
+// convertAmount converts amount in minor units of from into minor units of
+// to, given the prices in rubles of one unit of each currency. The result is
+// rounded to the nearest minor unit.
+func convertAmount(amount int64, from entities.Currency, to entities.Currency, fromRate float64, toRate float64) int64 {
+	units := float64(amount) / math.Pow10(from.MinorUnits)
+	converted := units * fromRate / toRate
+
+	return int64(math.Round(converted * math.Pow10(to.MinorUnits)))
+}
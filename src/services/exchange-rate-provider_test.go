@@ -0,0 +1,126 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeExchangeRateSource struct {
+	failing atomic.Bool
+	calls   atomic.Int32
+}
+
+func (this *fakeExchangeRateSource) GetRates(ctx context.Context) (map[string]float64, error) {
+	this.calls.Add(1)
+
+	if this.failing.Load() {
+		return nil, errors.New("Central Bank is unavailable")
+	}
+
+	return map[string]float64{"USD": 90, "EUR": 100}, nil
+}
+
+type fakeExchangeRateRepository struct {
+	mutex sync.Mutex
+	rates []entities.ExchangeRate
+}
+
+func (this *fakeExchangeRateRepository) CreateMany(ctx context.Context, data []entities.ExchangeRate) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.rates = append(this.rates, data...)
+
+	return nil
+}
+
+func (this *fakeExchangeRateRepository) GetLatest(ctx context.Context) ([]entities.ExchangeRate, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	latest := make(map[string]entities.ExchangeRate)
+	for _, rate := range this.rates {
+		if rate.FetchedAt >= latest[rate.Currency].FetchedAt {
+			latest[rate.Currency] = rate
+		}
+	}
+
+	rates := make([]entities.ExchangeRate, 0, len(latest))
+	for _, rate := range latest {
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+func TestCachedExchangeRateProviderUsesRatesUntilMaxAge(t *testing.T) {
+	source := &fakeExchangeRateSource{}
+	provider := NewCachedExchangeRateProvider(source, &fakeExchangeRateRepository{}, 10*time.Millisecond, 100*time.Millisecond, discardLogger())
+
+	rate, err := provider.GetRate(context.Background(), "USD")
+	if err != nil || rate != 90 {
+		t.Fatalf("got rate %v and error %v, want 90", rate, err)
+	}
+
+	source.failing.Store(true)
+	time.Sleep(20 * time.Millisecond)
+
+	rate, err = provider.GetRate(context.Background(), "USD")
+	if err != nil || rate != 90 {
+		t.Fatalf("got rate %v and error %v, want the last known rate 90", rate, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Rates older than the max age are refused, the source is queried again
+	// right away instead of after the retry delay
+	rate, err = provider.GetRate(context.Background(), "USD")
+	if err == nil {
+		t.Fatalf("got rate %v fetched more than the max age ago, want an error", rate)
+	}
+	if calls := source.calls.Load(); calls != 3 {
+		t.Errorf("got %d requests to the source, want 3", calls)
+	}
+}
+
+func TestCachedExchangeRateProviderFallsBackToSavedRates(t *testing.T) {
+	tests := []struct {
+		name    string
+		age     time.Duration
+		wantErr bool
+	}{
+		{"recent rates", time.Hour, false},
+		{"outdated rates", 48 * time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := &fakeExchangeRateSource{}
+			source.failing.Store(true)
+
+			repository := &fakeExchangeRateRepository{}
+			repository.CreateMany(context.Background(), []entities.ExchangeRate{
+				{Currency: "USD", Rate: 80, FetchedAt: time.Now().Add(-test.age).Unix()},
+			})
+
+			provider := NewCachedExchangeRateProvider(source, repository, time.Hour, 24*time.Hour, discardLogger())
+
+			rate, err := provider.GetRate(context.Background(), "USD")
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got rate %v, want an error", rate)
+				}
+				return
+			}
+
+			if err != nil || rate != 80 {
+				t.Fatalf("got rate %v and error %v, want the saved rate 80", rate, err)
+			}
+		})
+	}
+}
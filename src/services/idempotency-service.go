@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bank-system/config"
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("Idempotency key has already been used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("Request with this idempotency key is still in progress")
+	// ErrRequestProcessed is returned when the money movement of a request
+	// sent with an Idempotency-Key has already been recorded by an earlier
+	// attempt whose response was not stored
+	ErrRequestProcessed = errors.New("Request with this idempotency key has already been processed")
+)
+
+// requestId returns the id of the transaction or hold a request records. For
+// a request sent with an Idempotency-Key, which the idempotency middleware
+// puts in the context, it is derived from the user and the key, so an attempt
+// retried after the key has been released or its lease has expired fails
+// with ErrRequestProcessed when the earlier attempt has committed, instead of
+// moving the money again.
+func requestId(ctx context.Context, userId string) string {
+	key, ok := ctx.Value("idempotencyKey").(string)
+	if !ok || key == "" {
+		return uuid.New().String()
+	}
+
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("idempotency-key:%s:%s", userId, key))).String()
+}
+
+// requestError reports a transaction or hold that already exists under the
+// id returned by requestId as ErrRequestProcessed.
+func requestError(err error) error {
+	if errors.Is(err, repositories.ErrTransactionExists) || errors.Is(err, repositories.ErrHoldExists) {
+		return ErrRequestProcessed
+	}
+
+	return err
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, userId string, key string, requestHash string) (entities.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, data entities.IdempotencyKey) error
+	Release(ctx context.Context, data entities.IdempotencyKey) error
+}
+
+type idempotencyService struct {
+	idempotencyKeyRepository repositories.IdempotencyKeyRepository
+	idempotencyConfig        config.IdempotencyConfig
+	logger                   *logrus.Logger
+}
+
+func NewIdempotencyService(
+	idempotencyKeyRepository repositories.IdempotencyKeyRepository,
+	logger *logrus.Logger,
+) IdempotencyService {
+	return &idempotencyService{
+		idempotencyKeyRepository: idempotencyKeyRepository,
+		idempotencyConfig:        config.LoadIdempotencyConfig(),
+		logger:                   logger,
+	}
+}
+
+// Begin reserves the key for a new request and reports true, or returns the
+// completed earlier request with the same key and reports false. A key left
+// pending for longer than the lease timeout, e.g. by a request interrupted by
+// a restart, is reserved again for a retry of the same request; the retry
+// records under the same requestId, so it cannot repeat a committed attempt.
+func (this *idempotencyService) Begin(ctx context.Context, userId string, key string, requestHash string) (entities.IdempotencyKey, bool, error) {
+	now := time.Now()
+	idempotencyKey := entities.IdempotencyKey{
+		UserId:      userId,
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      "pending",
+		CreatedAt:   now.Unix(),
+	}
+
+	staleBefore := now.Add(-this.idempotencyConfig.LeaseTimeout).Unix()
+	reserved, err := this.idempotencyKeyRepository.Reserve(ctx, idempotencyKey, staleBefore)
+	if err != nil {
+		this.logger.Errorf("Failed to reserve idempotency key: %v", err)
+		return entities.IdempotencyKey{}, false, err
+	}
+	if reserved {
+		return idempotencyKey, true, nil
+	}
+
+	stored, err := this.idempotencyKeyRepository.Get(ctx, userId, key)
+	if err != nil {
+		this.logger.Errorf("Failed to get idempotency key: %v", err)
+		return entities.IdempotencyKey{}, false, err
+	}
+
+	if stored.RequestHash != requestHash {
+		this.logger.Errorf("Idempotency key %s of user %s reused with a different request", key, userId)
+		return entities.IdempotencyKey{}, false, ErrIdempotencyKeyReused
+	}
+	if stored.Status == "pending" {
+		return entities.IdempotencyKey{}, false, ErrIdempotencyKeyInProgress
+	}
+
+	return stored, false, nil
+}
+
+func (this *idempotencyService) Complete(ctx context.Context, data entities.IdempotencyKey) error {
+	data.Status = "completed"
+	data.CompletedAt = time.Now().Unix()
+
+	err := this.idempotencyKeyRepository.Complete(ctx, data)
+	if err != nil {
+		this.logger.Errorf("Failed to save response for idempotency key: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Release drops the reservation of a request whose response must not be
+// replayed, e.g. a server error, so it can be retried with the same key. The
+// retry records under the same requestId, so if the failed attempt has
+// committed anyway it gets ErrRequestProcessed.
+func (this *idempotencyService) Release(ctx context.Context, data entities.IdempotencyKey) error {
+	err := this.idempotencyKeyRepository.Release(ctx, data)
+	if err != nil {
+		this.logger.Errorf("Failed to release idempotency key: %v", err)
+		return err
+	}
+
+	return nil
+}
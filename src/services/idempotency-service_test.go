@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRequestIdIsDerivedFromIdempotencyKey(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "idempotencyKey", "key-1")
+
+	if requestId(ctx, "user-1") != requestId(ctx, "user-1") {
+		t.Fatal("retries with the same key get different ids")
+	}
+	if requestId(ctx, "user-1") == requestId(ctx, "user-2") {
+		t.Fatal("users sharing a key get the same id")
+	}
+
+	other := context.WithValue(context.Background(), "idempotencyKey", "key-2")
+	if requestId(ctx, "user-1") == requestId(other, "user-1") {
+		t.Fatal("different keys get the same id")
+	}
+
+	if requestId(context.Background(), "user-1") == requestId(context.Background(), "user-1") {
+		t.Fatal("requests without a key get the same id")
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{repositories.ErrTransactionExists, ErrRequestProcessed},
+		{fmt.Errorf("record: %w", repositories.ErrTransactionExists), ErrRequestProcessed},
+		{repositories.ErrHoldExists, ErrRequestProcessed},
+		{repositories.ErrInsufficientFunds, repositories.ErrInsufficientFunds},
+	}
+
+	for _, test := range tests {
+		if got := requestError(test.err); !errors.Is(got, test.want) {
+			t.Errorf("requestError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
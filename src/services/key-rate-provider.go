@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type staticKeyRateProvider struct {
+	rate float64
+}
+
+// NewStaticKeyRateProvider always returns the configured rate, e.g. for
+// local development or when the Central Bank must not be queried at all.
+func NewStaticKeyRateProvider(rate float64) KeyRateProvider {
+	return &staticKeyRateProvider{rate: rate}
+}
+
+func (this *staticKeyRateProvider) GetKeyRate(ctx context.Context) (float64, error) {
+	return this.rate, nil
+}
+
+type cachedKeyRateProvider struct {
+	cache *rateCache[float64]
+}
+
+// NewCachedKeyRateProvider keeps the rate returned by provider for ttl and
+// persists every fetched value. When provider fails, the last known good
+// rate is returned, from memory or from the database, however old it is.
+func NewCachedKeyRateProvider(
+	provider KeyRateProvider,
+	keyRateRepository repositories.KeyRateRepository,
+	ttl time.Duration,
+	logger *logrus.Logger,
+) KeyRateProvider {
+	return &cachedKeyRateProvider{
+		cache: &rateCache[float64]{
+			name:   "key rate",
+			ttl:    ttl,
+			logger: logger,
+			fetch:  provider.GetKeyRate,
+			save: func(ctx context.Context, rate float64, fetchedAt time.Time) error {
+				_, err := keyRateRepository.Create(
+					ctx,
+					entities.KeyRate{
+						ID:        uuid.New().String(),
+						Rate:      rate,
+						FetchedAt: fetchedAt.Unix(),
+					},
+				)
+
+				return err
+			},
+			getLatest: func(ctx context.Context) (float64, time.Time, error) {
+				keyRate, err := keyRateRepository.GetLatest(ctx)
+				if err != nil {
+					return 0, time.Time{}, err
+				}
+
+				return keyRate.Rate, time.Unix(keyRate.FetchedAt, 0), nil
+			},
+		},
+	}
+}
+
+func (this *cachedKeyRateProvider) GetKeyRate(ctx context.Context) (float64, error) {
+	return this.cache.get(ctx)
+}
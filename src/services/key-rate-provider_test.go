@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeKeyRateRepository struct {
+	mutex sync.Mutex
+	rates []entities.KeyRate
+}
+
+func (this *fakeKeyRateRepository) Create(ctx context.Context, data entities.KeyRate) (string, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.rates = append(this.rates, data)
+
+	return data.ID, nil
+}
+
+func (this *fakeKeyRateRepository) GetLatest(ctx context.Context) (entities.KeyRate, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.rates) == 0 {
+		return entities.KeyRate{}, errors.New("no rows in result set")
+	}
+
+	return this.rates[len(this.rates)-1], nil
+}
+
+func (this *fakeKeyRateRepository) count() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.rates)
+}
+
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return logger
+}
+
+type cachedKeyRateTest struct {
+	status     *atomic.Int32
+	body       *atomic.Value
+	requests   *atomic.Int32
+	repository *fakeKeyRateRepository
+	provider   KeyRateProvider
+}
+
+func newCachedKeyRateTest(t *testing.T, ttl time.Duration) *cachedKeyRateTest {
+	test := &cachedKeyRateTest{
+		status:     &atomic.Int32{},
+		body:       &atomic.Value{},
+		repository: &fakeKeyRateRepository{},
+	}
+	test.serve(http.StatusOK, keyRateResponse)
+
+	server, requests := fakeCbrServer(t, test.status, test.body)
+	test.requests = requests
+	test.provider = NewCachedKeyRateProvider(NewCbrKeyRateProvider(server.URL), test.repository, ttl, discardLogger())
+
+	return test
+}
+
+func (this *cachedKeyRateTest) serve(status int, body string) {
+	this.status.Store(int32(status))
+	this.body.Store(body)
+}
+
+func (this *cachedKeyRateTest) wantRate(t *testing.T, want float64, wantRequests int32) {
+	t.Helper()
+
+	rate, err := this.provider.GetKeyRate(context.Background())
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if rate != want {
+		t.Errorf("got rate %v, want %v", rate, want)
+	}
+	if requests := this.requests.Load(); requests != wantRequests {
+		t.Errorf("got %d requests to the Central Bank, want %d", requests, wantRequests)
+	}
+}
+
+func TestCachedKeyRateProviderKeepsRateForTTL(t *testing.T) {
+	test := newCachedKeyRateTest(t, time.Hour)
+
+	test.wantRate(t, 20, 1)
+	test.serve(http.StatusOK, strings.Replace(keyRateResponse, "20.00", "18.50", 1))
+	test.wantRate(t, 20, 1)
+
+	if saved := test.repository.count(); saved != 1 {
+		t.Errorf("got %d saved rates, want 1", saved)
+	}
+}
+
+func TestCachedKeyRateProviderRefreshesAfterTTL(t *testing.T) {
+	test := newCachedKeyRateTest(t, 10*time.Millisecond)
+
+	test.wantRate(t, 20, 1)
+	test.serve(http.StatusOK, strings.Replace(keyRateResponse, "20.00", "18.50", 1))
+	time.Sleep(20 * time.Millisecond)
+	test.wantRate(t, 18.5, 2)
+
+	if saved := test.repository.count(); saved != 2 {
+		t.Errorf("got %d saved rates, want 2", saved)
+	}
+}
+
+func TestCachedKeyRateProviderFallsBackToLastKnownRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"outage", http.StatusServiceUnavailable, "Service Unavailable"},
+		{"malformed response", http.StatusOK, "<soap:Envelope><soap:Body>"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cached := newCachedKeyRateTest(t, 10*time.Millisecond)
+
+			cached.wantRate(t, 20, 1)
+			cached.serve(test.status, test.body)
+			time.Sleep(20 * time.Millisecond)
+			cached.wantRate(t, 20, 2)
+			// a failed provider is not queried again before rateRetryDelay
+			cached.wantRate(t, 20, 2)
+		})
+	}
+}
+
+func TestCachedKeyRateProviderFallsBackToSavedRate(t *testing.T) {
+	test := newCachedKeyRateTest(t, time.Hour)
+	test.repository.Create(context.Background(), entities.KeyRate{ID: "saved", Rate: 19, FetchedAt: time.Now().Unix()})
+	test.serve(http.StatusServiceUnavailable, "Service Unavailable")
+
+	test.wantRate(t, 19, 1)
+}
+
+func TestCachedKeyRateProviderFailsWithoutKnownRate(t *testing.T) {
+	test := newCachedKeyRateTest(t, time.Hour)
+	test.serve(http.StatusServiceUnavailable, "Service Unavailable")
+
+	if rate, err := test.provider.GetKeyRate(context.Background()); err == nil {
+		t.Fatalf("got rate %v, want an error", rate)
+	}
+}
+
+func TestCachedKeyRateProviderServesCacheDuringFetch(t *testing.T) {
+	test := newCachedKeyRateTest(t, 10*time.Millisecond)
+	test.wantRate(t, 20, 1)
+
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, keyRateResponse)
+	}))
+	t.Cleanup(slowServer.Close)
+	t.Cleanup(func() { close(release) })
+	test.provider.(*cachedKeyRateProvider).cache.fetch = NewCbrKeyRateProvider(slowServer.URL).GetKeyRate
+	time.Sleep(20 * time.Millisecond)
+
+	go test.provider.GetKeyRate(context.Background())
+	for !test.provider.(*cachedKeyRateProvider).cache.isFetching() {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan float64)
+	go func() {
+		rate, _ := test.provider.GetKeyRate(context.Background())
+		done <- rate
+	}()
+
+	select {
+	case rate := <-done:
+		if rate != 20 {
+			t.Errorf("got rate %v, want 20", rate)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GetKeyRate waited for the Central Bank while a cached rate was known")
+	}
+}
+
+func (this *rateCache[T]) isFetching() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.fetching
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerService interface {
+	GetAccounts(ctx context.Context) ([]entities.LedgerAccount, error)
+	GetTrialBalance(ctx context.Context) ([]entities.TrialBalance, error)
+}
+
+type ledgerService struct {
+	ledgerRepository repositories.LedgerRepository
+	logger           *logrus.Logger
+}
+
+func NewLedgerService(
+	ledgerRepository repositories.LedgerRepository,
+	logger *logrus.Logger,
+) LedgerService {
+	return &ledgerService{
+		ledgerRepository: ledgerRepository,
+		logger:           logger,
+	}
+}
+
+// newJournalEntry starts an empty journal entry for transaction, in its currency.
+func newJournalEntry(transaction entities.Transaction) entities.JournalEntry {
+	return entities.JournalEntry{
+		ID:            uuid.New().String(),
+		TransactionId: transaction.ID,
+		Currency:      transaction.Currency,
+		Description:   transaction.Description,
+		CreatedAt:     transaction.CreatedAt,
+	}
+}
+
+func (this *ledgerService) GetAccounts(ctx context.Context) ([]entities.LedgerAccount, error) {
+	accounts, err := this.ledgerRepository.GetAccounts(ctx)
+	if err != nil {
+		this.logger.Errorf("Failed to get ledger accounts: %v", err)
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (this *ledgerService) GetTrialBalance(ctx context.Context) ([]entities.TrialBalance, error) {
+	trialBalances, err := this.ledgerRepository.GetTrialBalance(ctx)
+	if err != nil {
+		this.logger.Errorf("Failed to get trial balance: %v", err)
+		return nil, err
+	}
+
+	return trialBalances, nil
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanApplicationService interface {
+	Submit(ctx context.Context, userId string, data entities.LoanApplyDto) (entities.LoanApplication, error)
+	GetByUserId(ctx context.Context, userId string) ([]entities.LoanApplication, error)
+	Cancel(ctx context.Context, userId string, applicationId string) (entities.LoanApplication, error)
+	GetAll(ctx context.Context, status string) ([]entities.LoanApplication, error)
+	Approve(ctx context.Context, adminId string, applicationId string, data entities.LoanApplicationApproveDto) (entities.LoanApplication, error)
+	Reject(ctx context.Context, adminId string, applicationId string, data entities.LoanApplicationRejectDto) (entities.LoanApplication, error)
+}
+
+type loanApplicationService struct {
+	loanApplicationRepository repositories.LoanApplicationRepository
+	accountService            AccountService
+	loanProductService        LoanProductService
+	loanService               LoanService
+	scoringService            ScoringService
+	logger                    *logrus.Logger
+}
+
+func NewLoanApplicationService(
+	loanApplicationRepository repositories.LoanApplicationRepository,
+	accountService AccountService,
+	loanProductService LoanProductService,
+	loanService LoanService,
+	scoringService ScoringService,
+	logger *logrus.Logger,
+) LoanApplicationService {
+	return &loanApplicationService{
+		loanApplicationRepository: loanApplicationRepository,
+		accountService:            accountService,
+		loanProductService:        loanProductService,
+		loanService:               loanService,
+		scoringService:            scoringService,
+		logger:                    logger,
+	}
+}
+
+// checkProductTerms verifies that the amount and term fit the product offer.
+func (this *loanApplicationService) checkProductTerms(product entities.LoanProduct, amount int64, term int) error {
+	if !product.IsActive {
+		this.logger.Errorf("Loan product %s is not active", product.ID)
+		return errors.New("Loan product is not available")
+	}
+	if amount < product.MinAmount || amount > product.MaxAmount {
+		this.logger.Errorf("Amount %d is out of product %s limits", amount, product.ID)
+		return fmt.Errorf("Amount must be between %d and %d", product.MinAmount, product.MaxAmount)
+	}
+	if !product.AllowsTerm(term) {
+		this.logger.Errorf("Term %d is not allowed by product %s", term, product.ID)
+		return fmt.Errorf("Term must be one of %v", product.Terms)
+	}
+
+	return nil
+}
+
+// Submit registers an application and scores it. Applications failing the
+// scoring are rejected right away, the rest wait for an administrator.
+func (this *loanApplicationService) Submit(ctx context.Context, userId string, data entities.LoanApplyDto) (entities.LoanApplication, error) {
+	account, err := this.accountService.GetById(ctx, data.AccountId)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	if account.UserID != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.LoanApplication{}, errors.New("Unauthorised")
+	}
+
+	if account.Status != "active" {
+		this.logger.Errorf("Loan requested to %s account %s", account.Status, account.ID)
+		return entities.LoanApplication{}, errors.New("Account is not active")
+	}
+
+	// Loan products and schedules are in rubles
+	if account.Currency != entities.DefaultCurrency {
+		this.logger.Errorf("Loan requested to a %s account %s", account.Currency, account.ID)
+		return entities.LoanApplication{}, errors.New("Loans are issued to RUB accounts only")
+	}
+
+	product, err := this.loanProductService.GetById(ctx, data.ProductId)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	err = this.checkProductTerms(product, data.Amount, data.Term)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	scheduleType := data.ScheduleType
+	if scheduleType == "" {
+		scheduleType = "annuity"
+	}
+
+	now := time.Now().Unix()
+	application := entities.LoanApplication{
+		ID:           uuid.New().String(),
+		UserId:       userId,
+		AccountId:    data.AccountId,
+		ProductId:    product.ID,
+		Amount:       data.Amount,
+		Term:         data.Term,
+		ScheduleType: scheduleType,
+		Status:       "submitted",
+		Reasons:      []string{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	_, err = this.loanApplicationRepository.Create(ctx, application)
+	if err != nil {
+		this.logger.Errorf("Failed to save loan application: %v", err)
+		return entities.LoanApplication{}, err
+	}
+
+	interestRate, err := this.loanProductService.GetInterestRate(ctx, product)
+	if err != nil {
+		// The application stays submitted and is reviewed without a score
+		return application, nil
+	}
+
+	decision, err := this.scoringService.Evaluate(ctx, userId, application, product, interestRate)
+	if err != nil {
+		this.logger.Errorf("Failed to score loan application %s: %v", application.ID, err)
+		return application, nil
+	}
+
+	application.Status = "under_review"
+	if decision.Status == "rejected" {
+		application.Status = "rejected"
+	}
+	application.ScoringDecision = decision.Status
+	application.Reasons = decision.Reasons
+	application.OfferedAmount = decision.OfferedAmount
+	application.MonthlyIncome = decision.MonthlyIncome
+	application.DebtToIncome = decision.DebtToIncome
+	application.UpdatedAt = time.Now().Unix()
+
+	err = this.loanApplicationRepository.Update(ctx, application, []string{"submitted"})
+	if err != nil {
+		this.logger.Errorf("Failed to update loan application: %v", err)
+		return entities.LoanApplication{}, err
+	}
+
+	this.logger.Infof("Loan application %s %s", application.ID, application.Status)
+
+	return application, nil
+}
+
+func (this *loanApplicationService) GetByUserId(ctx context.Context, userId string) ([]entities.LoanApplication, error) {
+	applications, err := this.loanApplicationRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan applications: %v", err)
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+// Cancel withdraws an application that has not been decided on yet.
+func (this *loanApplicationService) Cancel(ctx context.Context, userId string, applicationId string) (entities.LoanApplication, error) {
+	application, err := this.loanApplicationRepository.GetById(ctx, applicationId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan application: %v", err)
+		return entities.LoanApplication{}, err
+	}
+
+	if application.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.LoanApplication{}, errors.New("Unauthorised")
+	}
+
+	application.Status = "cancelled"
+	application.UpdatedAt = time.Now().Unix()
+
+	err = this.loanApplicationRepository.Update(ctx, application, []string{"submitted", "under_review"})
+	if err != nil {
+		this.logger.Errorf("Failed to cancel loan application %s: %v", application.ID, err)
+		return entities.LoanApplication{}, errors.New("Loan application can no longer be cancelled")
+	}
+
+	return application, nil
+}
+
+func (this *loanApplicationService) GetAll(ctx context.Context, status string) ([]entities.LoanApplication, error) {
+	applications, err := this.loanApplicationRepository.GetAll(ctx, status)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan applications: %v", err)
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+// Approve approves an application and disburses the loan. If disbursement
+// fails, the application is returned to review.
+func (this *loanApplicationService) Approve(ctx context.Context, adminId string, applicationId string, data entities.LoanApplicationApproveDto) (entities.LoanApplication, error) {
+	application, err := this.loanApplicationRepository.GetById(ctx, applicationId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan application: %v", err)
+		return entities.LoanApplication{}, err
+	}
+
+	amount := data.Amount
+	if amount == 0 {
+		amount = application.Amount
+		if application.OfferedAmount > 0 {
+			amount = application.OfferedAmount
+		}
+	}
+
+	if amount > application.Amount {
+		this.logger.Errorf("Approved amount %d exceeds requested amount %d", amount, application.Amount)
+		return entities.LoanApplication{}, errors.New("Approved amount exceeds requested amount")
+	}
+
+	product, err := this.loanProductService.GetById(ctx, application.ProductId)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	err = this.checkProductTerms(product, amount, application.Term)
+	if err != nil {
+		return entities.LoanApplication{}, err
+	}
+
+	previousStatus := application.Status
+	application.Status = "approved"
+	application.ApprovedAmount = amount
+	application.ReviewedBy = adminId
+	application.UpdatedAt = time.Now().Unix()
+
+	err = this.loanApplicationRepository.Update(ctx, application, []string{"submitted", "under_review"})
+	if err != nil {
+		this.logger.Errorf("Failed to approve loan application %s: %v", application.ID, err)
+		return entities.LoanApplication{}, errors.New("Loan application is not awaiting review")
+	}
+
+	loan, err := this.loanService.Issue(ctx, application)
+	if err != nil {
+		this.logger.Errorf("Failed to disburse loan application %s: %v", application.ID, err)
+
+		application.Status = previousStatus
+		application.ApprovedAmount = 0
+		application.UpdatedAt = time.Now().Unix()
+
+		revertErr := this.loanApplicationRepository.Update(ctx, application, []string{"approved"})
+		if revertErr != nil {
+			this.logger.Errorf("Failed to return loan application %s to review: %v", application.ID, revertErr)
+		}
+
+		return entities.LoanApplication{}, errors.New("Failed to disburse loan")
+	}
+
+	application.Status = "disbursed"
+	application.LoanId = loan.ID
+	application.UpdatedAt = loan.StartDate
+
+	this.logger.Infof("Loan application %s disbursed as loan %s", application.ID, loan.ID)
+
+	return application, nil
+}
+
+func (this *loanApplicationService) Reject(ctx context.Context, adminId string, applicationId string, data entities.LoanApplicationRejectDto) (entities.LoanApplication, error) {
+	application, err := this.loanApplicationRepository.GetById(ctx, applicationId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan application: %v", err)
+		return entities.LoanApplication{}, err
+	}
+
+	application.Status = "rejected"
+	application.Reasons = append(application.Reasons, data.Reason)
+	application.ReviewedBy = adminId
+	application.UpdatedAt = time.Now().Unix()
+
+	err = this.loanApplicationRepository.Update(ctx, application, []string{"submitted", "under_review"})
+	if err != nil {
+		this.logger.Errorf("Failed to reject loan application %s: %v", application.ID, err)
+		return entities.LoanApplication{}, errors.New("Loan application is not awaiting review")
+	}
+
+	return application, nil
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanProductService interface {
+	Create(ctx context.Context, data entities.LoanProductDto) (entities.LoanProduct, error)
+	GetAll(ctx context.Context, onlyActive bool) ([]entities.LoanProduct, error)
+	GetById(ctx context.Context, productId string) (entities.LoanProduct, error)
+	Update(ctx context.Context, productId string, data entities.LoanProductDto) (entities.LoanProduct, error)
+	GetInterestRate(ctx context.Context, product entities.LoanProduct) (float64, error)
+}
+
+type loanProductService struct {
+	loanProductRepository repositories.LoanProductRepository
+	keyRateProvider       KeyRateProvider
+	logger                *logrus.Logger
+}
+
+func NewLoanProductService(
+	loanProductRepository repositories.LoanProductRepository,
+	keyRateProvider KeyRateProvider,
+	logger *logrus.Logger,
+) LoanProductService {
+	return &loanProductService{
+		loanProductRepository: loanProductRepository,
+		keyRateProvider:       keyRateProvider,
+		logger:                logger,
+	}
+}
+
+func (this *loanProductService) Create(ctx context.Context, data entities.LoanProductDto) (entities.LoanProduct, error) {
+	product := entities.LoanProduct{
+		ID:        uuid.New().String(),
+		Name:      data.Name,
+		RateType:  data.RateType,
+		Rate:      data.Rate,
+		Margin:    data.Margin,
+		MinAmount: data.MinAmount,
+		MaxAmount: data.MaxAmount,
+		Terms:     data.Terms,
+		Fee:       data.Fee,
+		IsActive:  data.IsActive,
+		CreatedAt: time.Now().Unix(),
+	}
+
+	_, err := this.loanProductRepository.Create(ctx, product)
+	if err != nil {
+		this.logger.Errorf("Failed to create loan product: %v", err)
+		return entities.LoanProduct{}, err
+	}
+
+	return product, nil
+}
+
+func (this *loanProductService) GetAll(ctx context.Context, onlyActive bool) ([]entities.LoanProduct, error) {
+	products, err := this.loanProductRepository.GetAll(ctx, onlyActive)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan products: %v", err)
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (this *loanProductService) GetById(ctx context.Context, productId string) (entities.LoanProduct, error) {
+	product, err := this.loanProductRepository.GetById(ctx, productId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan product: %v", err)
+		return entities.LoanProduct{}, err
+	}
+
+	return product, nil
+}
+
+func (this *loanProductService) Update(ctx context.Context, productId string, data entities.LoanProductDto) (entities.LoanProduct, error) {
+	product, err := this.loanProductRepository.GetById(ctx, productId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan product: %v", err)
+		return entities.LoanProduct{}, err
+	}
+
+	product.Name = data.Name
+	product.RateType = data.RateType
+	product.Rate = data.Rate
+	product.Margin = data.Margin
+	product.MinAmount = data.MinAmount
+	product.MaxAmount = data.MaxAmount
+	product.Terms = data.Terms
+	product.Fee = data.Fee
+	product.IsActive = data.IsActive
+
+	_, err = this.loanProductRepository.Update(ctx, product)
+	if err != nil {
+		this.logger.Errorf("Failed to update loan product: %v", err)
+		return entities.LoanProduct{}, err
+	}
+
+	return product, nil
+}
+
+// GetInterestRate adds the product margin to the product's fixed rate or,
+// for floating products, to the current key rate.
+func (this *loanProductService) GetInterestRate(ctx context.Context, product entities.LoanProduct) (float64, error) {
+	if product.RateType == "fixed" {
+		return product.Rate + product.Margin, nil
+	}
+
+	keyRate, err := this.keyRateProvider.GetKeyRate(ctx)
+	if err != nil {
+		this.logger.Errorf("Failed to get key rate: %v", err)
+		return 0, err
+	}
+
+	return keyRate + product.Margin, nil
+}
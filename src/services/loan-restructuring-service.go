@@ -0,0 +1,323 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type LoanRestructuringService interface {
+	Request(ctx context.Context, userId string, loanId string, data entities.LoanRestructuringDto) (entities.LoanRestructuring, error)
+	GetByLoanId(ctx context.Context, userId string, loanId string) ([]entities.LoanRestructuring, error)
+	GetScheduleHistory(ctx context.Context, userId string, loanId string) ([]entities.ArchivedPayment, error)
+	GetAll(ctx context.Context, status string) ([]entities.LoanRestructuring, error)
+	Approve(ctx context.Context, adminId string, restructuringId string) (entities.LoanResponseDto, error)
+	Reject(ctx context.Context, adminId string, restructuringId string, data entities.LoanRestructuringRejectDto) (entities.LoanRestructuring, error)
+}
+
+type loanRestructuringService struct {
+	loanRestructuringRepository repositories.LoanRestructuringRepository
+	loanRepository              repositories.LoanRepository
+	paymentRepository           repositories.PaymentRepository
+	logger                      *logrus.Logger
+}
+
+func NewLoanRestructuringService(
+	loanRestructuringRepository repositories.LoanRestructuringRepository,
+	loanRepository repositories.LoanRepository,
+	paymentRepository repositories.PaymentRepository,
+	logger *logrus.Logger,
+) LoanRestructuringService {
+	return &loanRestructuringService{
+		loanRestructuringRepository: loanRestructuringRepository,
+		loanRepository:              loanRepository,
+		paymentRepository:           paymentRepository,
+		logger:                      logger,
+	}
+}
+
+// buildRestructuredSchedule starts with graceMonths interest-only payments and
+// repays amount over the rest of term months with a schedule of the given type.
+func buildRestructuredSchedule(
+	scheduleType string,
+	rate float64,
+	startDate time.Time,
+	amount int64,
+	graceMonths int,
+	term int,
+	loanId string,
+) []entities.Payment {
+	schedule := make([]entities.Payment, 0, term)
+	monthlyRate := rate / 12.0 / 100.0
+
+	for i := 0; i < graceMonths; i++ {
+		interestPart := int64(math.Round(float64(amount) * monthlyRate))
+
+		schedule = append(schedule, entities.Payment{
+			ID:           uuid.New().String(),
+			LoanId:       loanId,
+			Amount:       interestPart,
+			DueDate:      startDate.AddDate(0, i+1, 0).Unix(),
+			InterestPart: interestPart,
+			Status:       "new",
+			IsPaid:       false,
+		})
+	}
+
+	return append(
+		schedule,
+		buildPaymentSchedule(
+			scheduleType,
+			rate,
+			startDate.AddDate(0, graceMonths, 0),
+			amount,
+			term-graceMonths,
+			loanId,
+		)...,
+	)
+}
+
+// capitalisedDebt returns the unpaid principal and the interest and penalty
+// already overdue, which become principal of the new schedule.
+func capitalisedDebt(unpaid []entities.Payment) repaymentSplit {
+	var debt repaymentSplit
+
+	for _, payment := range unpaid {
+		debt.principal += payment.PrincipalPart - payment.PrincipalPaid
+
+		if payment.Status == "overdue" {
+			debt.interest += payment.InterestPart - payment.InterestPaid
+			debt.penalty += payment.PenaltyPart - payment.PenaltyPaid
+		}
+	}
+
+	return debt
+}
+
+func (this *loanRestructuringService) getUserLoan(ctx context.Context, userId string, loanId string) (entities.Loan, error) {
+	loan, err := this.loanRepository.GetById(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan: %v", err)
+		return entities.Loan{}, err
+	}
+
+	if loan.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.Loan{}, errors.New("Unauthorised")
+	}
+
+	return loan, nil
+}
+
+func (this *loanRestructuringService) Request(ctx context.Context, userId string, loanId string, data entities.LoanRestructuringDto) (entities.LoanRestructuring, error) {
+	loan, err := this.getUserLoan(ctx, userId, loanId)
+	if err != nil {
+		return entities.LoanRestructuring{}, err
+	}
+
+	payments, err := this.paymentRepository.GetByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return entities.LoanRestructuring{}, err
+	}
+
+	unpaid := unpaidPayments(payments)
+	if len(unpaid) == 0 {
+		this.logger.Errorf("Loan %s is already repaid", loanId)
+		return entities.LoanRestructuring{}, errors.New("Loan is already repaid")
+	}
+
+	if data.GraceMonths >= len(unpaid)+data.ExtraTerm {
+		this.logger.Errorf("Grace period of %d months covers the whole term of loan %s", data.GraceMonths, loanId)
+		return entities.LoanRestructuring{}, errors.New("Grace period must be shorter than the new term")
+	}
+
+	restructurings, err := this.loanRestructuringRepository.GetByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan restructurings: %v", err)
+		return entities.LoanRestructuring{}, err
+	}
+
+	for _, restructuring := range restructurings {
+		if restructuring.Status == "pending" {
+			this.logger.Errorf("Loan %s already has pending restructuring %s", loanId, restructuring.ID)
+			return entities.LoanRestructuring{}, errors.New("Loan restructuring is already pending")
+		}
+	}
+
+	now := time.Now().Unix()
+	restructuring := entities.LoanRestructuring{
+		ID:          uuid.New().String(),
+		LoanId:      loan.ID,
+		UserId:      userId,
+		ExtraTerm:   data.ExtraTerm,
+		GraceMonths: data.GraceMonths,
+		NewRate:     data.NewRate,
+		Reason:      data.Reason,
+		Status:      "pending",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	_, err = this.loanRestructuringRepository.Create(ctx, restructuring)
+	if err != nil {
+		this.logger.Errorf("Failed to create loan restructuring: %v", err)
+		return entities.LoanRestructuring{}, err
+	}
+
+	return restructuring, nil
+}
+
+func (this *loanRestructuringService) GetByLoanId(ctx context.Context, userId string, loanId string) ([]entities.LoanRestructuring, error) {
+	_, err := this.getUserLoan(ctx, userId, loanId)
+	if err != nil {
+		return nil, err
+	}
+
+	restructurings, err := this.loanRestructuringRepository.GetByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan restructurings: %v", err)
+		return nil, err
+	}
+
+	return restructurings, nil
+}
+
+func (this *loanRestructuringService) GetScheduleHistory(ctx context.Context, userId string, loanId string) ([]entities.ArchivedPayment, error) {
+	_, err := this.getUserLoan(ctx, userId, loanId)
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := this.paymentRepository.GetHistoryByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get payment history: %v", err)
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (this *loanRestructuringService) GetAll(ctx context.Context, status string) ([]entities.LoanRestructuring, error) {
+	restructurings, err := this.loanRestructuringRepository.GetAll(ctx, status)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan restructurings: %v", err)
+		return nil, err
+	}
+
+	return restructurings, nil
+}
+
+// Approve replaces every unpaid installment of the loan with a schedule
+// starting today, built from the terms of the restructuring.
+func (this *loanRestructuringService) Approve(ctx context.Context, adminId string, restructuringId string) (entities.LoanResponseDto, error) {
+	restructuring, err := this.loanRestructuringRepository.GetById(ctx, restructuringId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan restructuring: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	if restructuring.Status != "pending" {
+		this.logger.Errorf("Loan restructuring %s is %s", restructuring.ID, restructuring.Status)
+		return entities.LoanResponseDto{}, repositories.ErrLoanRestructuringStatusChanged
+	}
+
+	loan, err := this.loanRepository.GetById(ctx, restructuring.LoanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	payments, err := this.paymentRepository.GetByLoanId(ctx, loan.ID)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	unpaid := unpaidPayments(payments)
+	term := len(unpaid) + restructuring.ExtraTerm
+	if len(unpaid) == 0 || restructuring.GraceMonths >= term {
+		this.logger.Errorf("Loan %s can no longer be restructured as requested", loan.ID)
+		return entities.LoanResponseDto{}, errors.New("Loan can no longer be restructured as requested")
+	}
+
+	if restructuring.NewRate != 0 {
+		loan.InterestRate = restructuring.NewRate
+	}
+	debt := capitalisedDebt(unpaid)
+	loan.Debt = debt.principal + debt.interest + debt.penalty
+
+	now := time.Now()
+	schedule := buildRestructuredSchedule(
+		loan.ScheduleType,
+		loan.InterestRate,
+		now,
+		loan.Debt,
+		restructuring.GraceMonths,
+		term,
+		loan.ID,
+	)
+	loan.Term = len(payments) - len(unpaid) + len(schedule)
+
+	restructuring.Status = "approved"
+	restructuring.ReviewedBy = adminId
+	restructuring.UpdatedAt = now.Unix()
+
+	// Capitalised interest and penalty are recognised as income and added to the loan
+	var entry *entities.JournalEntry
+	if debt.interest+debt.penalty > 0 {
+		entry = &entities.JournalEntry{
+			ID:          uuid.New().String(),
+			Currency:    entities.DefaultCurrency,
+			Description: fmt.Sprintf("Capitalisation on restructuring of loan %s", loan.ID),
+			CreatedAt:   now.Unix(),
+		}
+		entry.Debit(entities.LoansLedgerAccount, debt.interest+debt.penalty)
+		entry.Credit(entities.InterestIncomeLedgerAccount, debt.interest)
+		entry.Credit(entities.PenaltyIncomeLedgerAccount, debt.penalty)
+	}
+
+	err = this.loanRestructuringRepository.Approve(ctx, restructuring, loan, unpaid, schedule, entry)
+	if err != nil {
+		this.logger.Errorf("Failed to restructure loan %s: %v", loan.ID, err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	this.logger.Infof("Loan %s restructured by %s", loan.ID, restructuring.ID)
+
+	payments, err = this.paymentRepository.GetByLoanId(ctx, loan.ID)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	return toLoanResponse(loan, payments), nil
+}
+
+func (this *loanRestructuringService) Reject(ctx context.Context, adminId string, restructuringId string, data entities.LoanRestructuringRejectDto) (entities.LoanRestructuring, error) {
+	restructuring, err := this.loanRestructuringRepository.GetById(ctx, restructuringId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan restructuring: %v", err)
+		return entities.LoanRestructuring{}, err
+	}
+
+	restructuring.Status = "rejected"
+	restructuring.ReviewComment = data.Comment
+	restructuring.ReviewedBy = adminId
+	restructuring.UpdatedAt = time.Now().Unix()
+
+	err = this.loanRestructuringRepository.Reject(ctx, restructuring)
+	if err != nil {
+		this.logger.Errorf("Failed to reject loan restructuring %s: %v", restructuring.ID, err)
+		return entities.LoanRestructuring{}, err
+	}
+
+	return restructuring, nil
+}
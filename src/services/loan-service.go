@@ -1,61 +1,64 @@
 package services
 
 import (
+	"bank-system/config"
 	"bank-system/src/entities"
 	"bank-system/src/repositories"
 	"context"
 	"errors"
+	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+// maxRepayAttempts bounds how many times a repayment is allocated again when
+// concurrent repayments keep settling the same payments
+const maxRepayAttempts = 3
+
 type LoanService interface {
-	Apply(ctx context.Context, userId string, data entities.LoanApplyDto) (entities.LoanResponseDto, error)
+	Issue(ctx context.Context, application entities.LoanApplication) (entities.LoanResponseDto, error)
+	GetAll(ctx context.Context, userId string) ([]entities.LoanSummaryDto, error)
+	GetById(ctx context.Context, userId string, loanId string) (entities.LoanSummaryDto, error)
 	GetSchedule(ctx context.Context, userId string, loanId string) ([]entities.Payment, error)
+	Pay(ctx context.Context, userId string, loanId string, data entities.LoanPayDto) (string, error)
+	Prepay(ctx context.Context, userId string, loanId string, data entities.LoanPrepayDto) (entities.LoanResponseDto, error)
 }
 
 type loanService struct {
 	loanRepository     repositories.LoanRepository
 	paymentRepository  repositories.PaymentRepository
-	accountService     AccountService
-	transactionService TransactionService
+	loanProductService LoanProductService
+	loanConfig         config.LoanConfig
 	logger             *logrus.Logger
 }
 
 func NewLoanService(
 	loanRepository repositories.LoanRepository,
 	paymentRepository repositories.PaymentRepository,
-	accountService AccountService,
-	transactionService TransactionService,
+	loanProductService LoanProductService,
 	logger *logrus.Logger,
 ) LoanService {
 	return &loanService{
 		loanRepository:     loanRepository,
 		paymentRepository:  paymentRepository,
-		accountService:     accountService,
-		transactionService: transactionService,
+		loanProductService: loanProductService,
+		loanConfig:         config.LoadLoanConfig(),
 		logger:             logger,
 	}
 }
 
-func round2(val float64) float64 {
-	return math.Round(val*100) / 100
-}
-
-func toCents(val float64) int64 {
-	return int64(math.Round(val * 100))
-}
-
+// calcMonthlyPayment returns the annuity installment in minor currency units.
 func calcMonthlyPayment(amount int64, term int, interestRate float64) float64 {
 	amountFloat := float64(amount)
 	termFloat := float64(term)
 	monthlyRate := interestRate / 12.0 / 100.0
 
 	if monthlyRate == 0 {
-		return amountFloat / termFloat
+		return math.Round(amountFloat / termFloat)
 	}
 
 	r := monthlyRate
@@ -71,7 +74,7 @@ func calcMonthlyPayment(amount int64, term int, interestRate float64) float64 {
 
 	monthlyPayment := amountFloat * (numerator / denominator)
 
-	return math.Round(monthlyPayment*100) / 100
+	return math.Round(monthlyPayment)
 }
 
 func calcPaymentSchedule(
@@ -83,27 +86,26 @@ func calcPaymentSchedule(
 	loanId string,
 ) []entities.Payment {
 	schedule := make([]entities.Payment, 0, term)
-	remainingPrincipal := float64(amount)
+	remainingPrincipal := amount
 	monthlyRate := rate / 12.0 / 100.0
 
 	for i := 0; i < term; i++ {
 		dueDate := startDate.AddDate(0, i+1, 0)
 
-		interestPart := round2(remainingPrincipal * monthlyRate)
-		principalPart := round2(monthlyPayment - interestPart)
+		interestPart := int64(math.Round(float64(remainingPrincipal) * monthlyRate))
+		principalPart := int64(monthlyPayment) - interestPart
 
-		if i == term-1 || (remainingPrincipal-principalPart) <= 0.009 {
-			principalPart = round2(remainingPrincipal)
-			monthlyPayment = round2(principalPart + interestPart)
+		if i == term-1 || remainingPrincipal-principalPart <= 0 {
+			principalPart = remainingPrincipal
 		}
 
 		payment := entities.Payment{
 			ID:            uuid.New().String(),
 			LoanId:        loanId,
-			Amount:        toCents(monthlyPayment),
+			Amount:        principalPart + interestPart,
 			DueDate:       dueDate.Unix(),
-			PrincipalPart: toCents(principalPart),
-			InterestPart:  toCents(interestPart),
+			PrincipalPart: principalPart,
+			InterestPart:  interestPart,
 			Status:        "new",
 			IsPaid:        false,
 		}
@@ -118,85 +120,330 @@ func calcPaymentSchedule(
 	return schedule
 }
 
-func (this *loanService) Apply(ctx context.Context, userId string, data entities.LoanApplyDto) (entities.LoanResponseDto, error) {
-	account, err := this.accountService.GetById(ctx, data.AccountId)
-	if err != nil {
-		return entities.LoanResponseDto{}, err
+// calcDifferentiatedSchedule splits the principal into equal parts, so the
+// interest and therefore the installment decline every month. The last
+// payment takes the rounding remainder of the principal.
+func calcDifferentiatedSchedule(
+	rate float64,
+	startDate time.Time,
+	amount int64,
+	term int,
+	loanId string,
+) []entities.Payment {
+	schedule := make([]entities.Payment, 0, term)
+	remainingPrincipal := amount
+	monthlyRate := rate / 12.0 / 100.0
+	principalStep := amount / int64(term)
+
+	for i := 0; i < term; i++ {
+		dueDate := startDate.AddDate(0, i+1, 0)
+
+		interestPart := int64(math.Round(float64(remainingPrincipal) * monthlyRate))
+		principalPart := principalStep
+
+		if i == term-1 {
+			principalPart = remainingPrincipal
+		}
+
+		payment := entities.Payment{
+			ID:            uuid.New().String(),
+			LoanId:        loanId,
+			Amount:        principalPart + interestPart,
+			DueDate:       dueDate.Unix(),
+			PrincipalPart: principalPart,
+			InterestPart:  interestPart,
+			Status:        "new",
+			IsPaid:        false,
+		}
+		schedule = append(schedule, payment)
+
+		remainingPrincipal -= principalPart
 	}
 
-	if account.UserID != userId {
-		this.logger.Errorf("Unauthorised")
-		return entities.LoanResponseDto{}, errors.New("Unauthorised")
+	return schedule
+}
+
+// buildPaymentSchedule builds a schedule of the given type for amount repaid over term months.
+func buildPaymentSchedule(
+	scheduleType string,
+	rate float64,
+	startDate time.Time,
+	amount int64,
+	term int,
+	loanId string,
+) []entities.Payment {
+	if scheduleType == "differentiated" {
+		return calcDifferentiatedSchedule(rate, startDate, amount, term, loanId)
+	}
+
+	return calcPaymentSchedule(
+		rate,
+		calcMonthlyPayment(amount, term, rate),
+		startDate,
+		amount,
+		term,
+		loanId,
+	)
+}
+
+func toLoanResponse(loan entities.Loan, payments []entities.Payment) entities.LoanResponseDto {
+	return entities.LoanResponseDto{
+		ID:           loan.ID,
+		UserId:       loan.UserId,
+		AccountId:    loan.AccountId,
+		Amount:       loan.Amount,
+		InterestRate: loan.InterestRate,
+		Term:         loan.Term,
+		StartDate:    loan.StartDate,
+		Debt:         loan.Debt,
+		ScheduleType: loan.ScheduleType,
+		ProductId:    loan.ProductId,
+		Payments:     payments,
+	}
+}
+
+// unpaidPayments returns the payments still awaiting settlement, oldest first.
+func unpaidPayments(payments []entities.Payment) []entities.Payment {
+	unpaid := make([]entities.Payment, 0, len(payments))
+
+	for _, payment := range payments {
+		if payment.IsPaid {
+			continue
+		}
+		if payment.Status != "new" && payment.Status != "overdue" {
+			continue
+		}
+
+		unpaid = append(unpaid, payment)
+	}
+
+	sort.SliceStable(unpaid, func(i, j int) bool {
+		return unpaid[i].DueDate < unpaid[j].DueDate
+	})
+
+	return unpaid
+}
+
+func paymentOutstanding(payment entities.Payment) int64 {
+	return payment.InterestPart - payment.InterestPaid +
+		payment.PrincipalPart - payment.PrincipalPaid +
+		payment.PenaltyPart - payment.PenaltyPaid
+}
+
+// summarizeLoan computes the outstanding balance and the status of a loan
+// from its payments. A loan is defaulted once a payment has stayed overdue
+// for defaultAfterDays and closed when every payment is settled.
+func summarizeLoan(loan entities.Loan, payments []entities.Payment, now time.Time, defaultAfterDays int) entities.LoanSummaryDto {
+	summary := entities.LoanSummaryDto{
+		ID:           loan.ID,
+		AccountId:    loan.AccountId,
+		ProductId:    loan.ProductId,
+		Amount:       loan.Amount,
+		InterestRate: loan.InterestRate,
+		Term:         loan.Term,
+		StartDate:    loan.StartDate,
+		ScheduleType: loan.ScheduleType,
+		Status:       "active",
+	}
+
+	defaultedBefore := now.AddDate(0, 0, -defaultAfterDays).Unix()
+	defaulted := false
+
+	for _, payment := range payments {
+		summary.InterestPaid += payment.InterestPaid
+	}
+
+	unpaid := unpaidPayments(payments)
+	for _, payment := range unpaid {
+		summary.RemainingPrincipal += payment.PrincipalPart - payment.PrincipalPaid
+		summary.InterestRemaining += payment.InterestPart - payment.InterestPaid
+		summary.PenaltyOutstanding += payment.PenaltyPart - payment.PenaltyPaid
+
+		if payment.Status == "overdue" {
+			summary.OverdueCount++
+			if payment.DueDate < defaultedBefore {
+				defaulted = true
+			}
+		}
+	}
+
+	if len(unpaid) > 0 {
+		nextPayment := unpaid[0]
+		summary.NextPayment = &nextPayment
+	}
+
+	if len(unpaid) == 0 {
+		summary.Status = "closed"
+	} else if defaulted {
+		summary.Status = "defaulted"
 	}
 
-	keyRate, err := GetCentralBankRate()
+	return summary
+}
+
+// repaymentSplit is how a repayment divides between principal, interest and penalty
+type repaymentSplit struct {
+	principal int64
+	interest  int64
+	penalty   int64
+}
+
+// allocateRepayment spreads amount over payments in order, covering the
+// interest of each payment, then its principal and finally the accrued
+// penalty. It returns the parts repaid on each payment touched by the
+// allocation and the split of the repaid amount.
+func allocateRepayment(payments []entities.Payment, amount int64) ([]entities.PaymentRepayment, repaymentSplit) {
+	allocated := make([]entities.PaymentRepayment, 0, len(payments))
+	var split repaymentSplit
+
+	for _, payment := range payments {
+		if amount <= 0 {
+			break
+		}
+
+		repayment := entities.PaymentRepayment{PaymentId: payment.ID}
+
+		repayment.Interest = min(amount, payment.InterestPart-payment.InterestPaid)
+		amount -= repayment.Interest
+		split.interest += repayment.Interest
+
+		repayment.Principal = min(amount, payment.PrincipalPart-payment.PrincipalPaid)
+		amount -= repayment.Principal
+		split.principal += repayment.Principal
+
+		repayment.Penalty = min(amount, payment.PenaltyPart-payment.PenaltyPaid)
+		amount -= repayment.Penalty
+		split.penalty += repayment.Penalty
+
+		allocated = append(allocated, repayment)
+	}
+
+	return allocated, split
+}
+
+// repaymentEntry debits the loan account with a repayment and credits the
+// loans issued and the income accounts with its parts.
+func repaymentEntry(transaction entities.Transaction, accountId string, split repaymentSplit) entities.JournalEntry {
+	entry := newJournalEntry(transaction)
+	entry.Debit(accountId, split.principal+split.interest+split.penalty)
+	entry.Credit(entities.LoansLedgerAccount, split.principal)
+	entry.Credit(entities.InterestIncomeLedgerAccount, split.interest)
+	entry.Credit(entities.PenaltyIncomeLedgerAccount, split.penalty)
+
+	return entry
+}
+
+// Issue creates the loan for the approved amount of an application with its
+// payment schedule, disburses it to the application account and marks the
+// application as disbursed.
+func (this *loanService) Issue(ctx context.Context, application entities.LoanApplication) (entities.LoanResponseDto, error) {
+	product, err := this.loanProductService.GetById(ctx, application.ProductId)
 	if err != nil {
-		this.logger.Errorf("Failed to get key rate: %v", err)
 		return entities.LoanResponseDto{}, err
 	}
 
-	interestRate := keyRate * 1.1
-	monthlyPayment := calcMonthlyPayment(data.Amount, data.Term, interestRate)
+	// The rate is fixed at disbursement, floating products follow the key rate of the day
+	interestRate, err := this.loanProductService.GetInterestRate(ctx, product)
+	if err != nil {
+		return entities.LoanResponseDto{}, err
+	}
 
 	startDate := time.Now()
 	loanId := uuid.New().String()
 
-	payments := calcPaymentSchedule(
+	payments := buildPaymentSchedule(
+		application.ScheduleType,
 		interestRate,
-		monthlyPayment,
 		startDate,
-		data.Amount,
-		data.Term,
+		application.ApprovedAmount,
+		application.Term,
 		loanId,
 	)
 
-	_, err = this.paymentRepository.CreateMany(ctx, payments)
-
 	loan := entities.Loan{
 		ID:           loanId,
-		UserId:       userId,
-		AccountId:    data.AccountId,
-		Amount:       data.Amount,
+		UserId:       application.UserId,
+		AccountId:    application.AccountId,
+		Amount:       application.ApprovedAmount,
 		InterestRate: interestRate,
-		Term:         data.Term,
+		Term:         application.Term,
 		StartDate:    startDate.Unix(),
-		Debt:         data.Amount,
+		Debt:         application.ApprovedAmount,
+		ScheduleType: application.ScheduleType,
+		ProductId:    product.ID,
+	}
+
+	// The issuance fee is withheld from the disbursed amount
+	transaction := entities.Transaction{
+		ID:          uuid.New().String(),
+		Amount:      application.ApprovedAmount - product.Fee,
+		Currency:    entities.DefaultCurrency,
+		ToAccountId: application.AccountId,
+		Type:        "loan",
+		Description: fmt.Sprintf("Disbursement of loan %s", loan.ID),
+		CreatedAt:   startDate.Unix(),
 	}
+	entry := newJournalEntry(transaction)
+	entry.Debit(entities.LoansLedgerAccount, application.ApprovedAmount)
+	entry.Credit(application.AccountId, application.ApprovedAmount-product.Fee)
+	entry.Credit(entities.FeeIncomeLedgerAccount, product.Fee)
 
-	_, err = this.loanRepository.Create(ctx, loan)
+	err = this.loanRepository.Disburse(ctx, application.ID, loan, payments, transaction, entry)
 	if err != nil {
-		this.logger.Errorf("Failed to create loan: %v", err)
+		this.logger.Errorf("Failed to disburse loan: %v", err)
 		return entities.LoanResponseDto{}, err
 	}
-	_, err = this.paymentRepository.CreateMany(ctx, payments)
+
+	this.logger.Info("Loan issued: ", loan.ID)
+
+	return toLoanResponse(loan, payments), nil
+}
+
+func (this *loanService) GetAll(ctx context.Context, userId string) ([]entities.LoanSummaryDto, error) {
+	loans, err := this.loanRepository.GetByUserId(ctx, userId)
 	if err != nil {
-		this.logger.Errorf("Failed to create payments: %v", err)
-		return entities.LoanResponseDto{}, err
+		this.logger.Errorf("Failed to get loans: %v", err)
+		return nil, err
 	}
 
-	this.accountService.UpdateBalance(
-		ctx,
-		data.AccountId,
-		userId,
-		entities.UpdateAccountBalanceDto{
-			Amount: data.Amount,
-			Type:   "loan",
-		},
-	)
+	now := time.Now()
+	summaries := make([]entities.LoanSummaryDto, 0, len(loans))
 
-	this.logger.Info()
+	for _, loan := range loans {
+		payments, err := this.paymentRepository.GetByLoanId(ctx, loan.ID)
+		if err != nil {
+			this.logger.Errorf("Failed to get payments: %v", err)
+			return nil, err
+		}
 
-	return entities.LoanResponseDto{
-		ID:           loan.ID,
-		UserId:       loan.UserId,
-		AccountId:    loan.AccountId,
-		Amount:       loan.Amount,
-		InterestRate: loan.InterestRate,
-		Term:         loan.Term,
-		StartDate:    loan.StartDate,
-		Debt:         loan.Debt,
-		Payments:     payments,
-	}, nil
+		summaries = append(summaries, summarizeLoan(loan, payments, now, this.loanConfig.DefaultAfterDays))
+	}
+
+	return summaries, nil
+}
+
+func (this *loanService) GetById(ctx context.Context, userId string, loanId string) (entities.LoanSummaryDto, error) {
+	loan, err := this.loanRepository.GetById(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan: %v", err)
+		return entities.LoanSummaryDto{}, err
+	}
+
+	if loan.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.LoanSummaryDto{}, errors.New("Unauthorised")
+	}
+
+	payments, err := this.paymentRepository.GetByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return entities.LoanSummaryDto{}, err
+	}
+
+	summary := summarizeLoan(loan, payments, time.Now(), this.loanConfig.DefaultAfterDays)
+	summary.Payments = payments
+
+	return summary, nil
 }
 
 func (this *loanService) GetSchedule(ctx context.Context, userId string, loanId string) ([]entities.Payment, error) {
@@ -219,3 +466,217 @@ func (this *loanService) GetSchedule(ctx context.Context, userId string, loanId
 
 	return payments, nil
 }
+
+func (this *loanService) Pay(ctx context.Context, userId string, loanId string, data entities.LoanPayDto) (string, error) {
+	loan, err := this.loanRepository.GetById(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan: %v", err)
+		return "", err
+	}
+
+	if loan.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return "", errors.New("Unauthorised")
+	}
+
+	// A concurrent repayment, e.g. the automatic debit, may settle the
+	// payments first, then the amount is allocated over what is left
+	for attempt := 1; ; attempt++ {
+		transactionId, err := this.repay(ctx, loan, data.Amount)
+		if errors.Is(err, repositories.ErrPaymentChanged) && attempt < maxRepayAttempts {
+			this.logger.Infof("Payments of loan %s changed, allocating repayment again", loan.ID)
+			continue
+		}
+
+		return transactionId, err
+	}
+}
+
+// repay allocates amount over the unpaid payments of the loan as they are
+// stored now and records the repayment.
+func (this *loanService) repay(ctx context.Context, loan entities.Loan, amount int64) (string, error) {
+	payments, err := this.paymentRepository.GetByLoanId(ctx, loan.ID)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return "", err
+	}
+
+	unpaid := unpaidPayments(payments)
+	if len(unpaid) == 0 {
+		this.logger.Errorf("Loan %s has no outstanding payments", loan.ID)
+		return "", errors.New("Loan has no outstanding payments")
+	}
+
+	var outstanding int64
+	for _, payment := range unpaid {
+		outstanding += paymentOutstanding(payment)
+	}
+
+	if amount > outstanding {
+		this.logger.Errorf("Repayment %d exceeds outstanding amount %d", amount, outstanding)
+		return "", errors.New("Amount exceeds outstanding payments")
+	}
+
+	now := time.Now().Unix()
+	repayments, split := allocateRepayment(unpaid, amount)
+
+	transaction := entities.Transaction{
+		ID:            requestId(ctx, loan.UserId),
+		Amount:        amount,
+		Currency:      entities.DefaultCurrency,
+		FromAccountId: loan.AccountId,
+		ToAccountId:   loan.ID,
+		Type:          "loan_repayment",
+		Description:   fmt.Sprintf("Repayment of loan %s", loan.ID),
+		CreatedAt:     now,
+	}
+
+	err = this.loanRepository.Repay(ctx, loan.ID, repayments, now, transaction, repaymentEntry(transaction, loan.AccountId, split))
+	if err != nil {
+		this.logger.Errorf("Failed to repay loan: %v", err)
+		return "", requestError(err)
+	}
+
+	this.logger.Info("Loan repaid: ", loan.ID)
+
+	return transaction.ID, nil
+}
+
+func (this *loanService) Prepay(ctx context.Context, userId string, loanId string, data entities.LoanPrepayDto) (entities.LoanResponseDto, error) {
+	loan, err := this.loanRepository.GetById(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	if loan.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.LoanResponseDto{}, errors.New("Unauthorised")
+	}
+
+	payments, err := this.paymentRepository.GetByLoanId(ctx, loanId)
+	if err != nil {
+		this.logger.Errorf("Failed to get payments: %v", err)
+		return entities.LoanResponseDto{}, err
+	}
+
+	now := time.Now()
+	unpaid := unpaidPayments(payments)
+
+	if len(unpaid) == 0 || loan.Debt == 0 {
+		this.logger.Errorf("Loan %s is already repaid", loanId)
+		return entities.LoanResponseDto{}, errors.New("Loan is already repaid")
+	}
+
+	// Prepayment only reduces principal of future installments, so due and
+	// partially paid installments have to be settled through Pay first
+	replacedIds := make([]string, 0, len(unpaid))
+	for _, payment := range unpaid {
+		if payment.Status == "overdue" || payment.DueDate <= now.Unix() || payment.InterestPaid > 0 || payment.PrincipalPaid > 0 {
+			this.logger.Errorf("Loan %s has unsettled payment %s", loanId, payment.ID)
+			return entities.LoanResponseDto{}, errors.New("Settle current payments before prepayment")
+		}
+
+		replacedIds = append(replacedIds, payment.ID)
+	}
+
+	if data.Amount > loan.Debt {
+		this.logger.Errorf("Prepayment %d exceeds debt %d", data.Amount, loan.Debt)
+		return entities.LoanResponseDto{}, errors.New("Amount exceeds loan debt")
+	}
+
+	paidCount := len(payments) - len(unpaid)
+	loan.Debt -= data.Amount
+
+	var schedule []entities.Payment
+	if loan.Debt > 0 {
+		startDate := time.Unix(loan.StartDate, 0).AddDate(0, paidCount, 0)
+
+		switch {
+		case data.Mode == "payment":
+			schedule = buildPaymentSchedule(
+				loan.ScheduleType,
+				loan.InterestRate,
+				startDate,
+				loan.Debt,
+				len(unpaid),
+				loan.ID,
+			)
+		case loan.ScheduleType == "differentiated":
+			// Keep the monthly principal part and repay the rest sooner
+			term := len(unpaid)
+			if principalStep := unpaid[0].PrincipalPart; principalStep > 0 {
+				term = min(term, int((loan.Debt+principalStep-1)/principalStep))
+			}
+
+			schedule = calcDifferentiatedSchedule(
+				loan.InterestRate,
+				startDate,
+				loan.Debt,
+				term,
+				loan.ID,
+			)
+		default:
+			schedule = calcPaymentSchedule(
+				loan.InterestRate,
+				float64(unpaid[0].Amount),
+				startDate,
+				loan.Debt,
+				len(unpaid),
+				loan.ID,
+			)
+		}
+	}
+
+	loan.Term = paidCount + len(schedule)
+
+	transaction := entities.Transaction{
+		ID:            requestId(ctx, userId),
+		Amount:        data.Amount,
+		Currency:      entities.DefaultCurrency,
+		FromAccountId: loan.AccountId,
+		ToAccountId:   loan.ID,
+		Type:          "loan_prepayment",
+		Description:   fmt.Sprintf("Prepayment of loan %s", loan.ID),
+		CreatedAt:     now.Unix(),
+	}
+
+	err = this.loanRepository.Reschedule(
+		ctx,
+		loan.ID,
+		loan.Term,
+		data.Amount,
+		replacedIds,
+		schedule,
+		transaction,
+		repaymentEntry(transaction, loan.AccountId, repaymentSplit{principal: data.Amount}),
+	)
+	if err != nil {
+		this.logger.Errorf("Failed to prepay loan: %v", err)
+		return entities.LoanResponseDto{}, requestError(err)
+	}
+
+	this.logger.Info("Loan prepaid: ", loan.ID)
+
+	// The prepayment is committed, so the response is built from the
+	// schedule stored above instead of reading it again, which could fail
+	// and make the client retry a prepayment that went through
+	replaced := make(map[string]bool, len(replacedIds))
+	for _, id := range replacedIds {
+		replaced[id] = true
+	}
+
+	rescheduled := make([]entities.Payment, 0, len(payments)-len(replacedIds)+len(schedule))
+	for _, payment := range payments {
+		if !replaced[payment.ID] {
+			rescheduled = append(rescheduled, payment)
+		}
+	}
+	rescheduled = append(rescheduled, schedule...)
+
+	sort.SliceStable(rescheduled, func(i, j int) bool {
+		return rescheduled[i].DueDate < rescheduled[j].DueDate
+	})
+
+	return toLoanResponse(loan, rescheduled), nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildPaymentScheduleRepaysAmount(t *testing.T) {
+	startDate := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		scheduleType string
+		rate         float64
+		amount       int64
+		term         int
+	}{
+		{"annuity", "annuity", 12, 100000000, 12},
+		{"annuity odd amount", "annuity", 17.5, 123456789, 7},
+		{"annuity odd term", "annuity", 9.9, 1000001, 13},
+		{"annuity zero rate", "annuity", 0, 1000001, 7},
+		{"annuity high rate", "annuity", 99.9, 555555, 36},
+		{"annuity one month", "annuity", 25, 99999, 1},
+		{"annuity long term", "annuity", 21, 3000000001, 360},
+		{"differentiated", "differentiated", 12, 100000000, 12},
+		{"differentiated odd amount", "differentiated", 17.5, 123456789, 7},
+		{"differentiated odd term", "differentiated", 9.9, 1000001, 13},
+		{"differentiated zero rate", "differentiated", 0, 1000001, 7},
+		{"differentiated high rate", "differentiated", 99.9, 555555, 36},
+		{"differentiated one month", "differentiated", 25, 99999, 1},
+		{"differentiated amount below term", "differentiated", 15, 5, 12},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule := buildPaymentSchedule(test.scheduleType, test.rate, startDate, test.amount, test.term, "loan")
+
+			if len(schedule) == 0 || len(schedule) > test.term {
+				t.Fatalf("got %d payments for a term of %d months", len(schedule), test.term)
+			}
+
+			var principal int64
+			for i, payment := range schedule {
+				if payment.PrincipalPart < 0 || payment.InterestPart < 0 {
+					t.Errorf("payment %d has principal %d and interest %d", i, payment.PrincipalPart, payment.InterestPart)
+				}
+				if payment.Amount != payment.PrincipalPart+payment.InterestPart {
+					t.Errorf("payment %d amount %d is not principal %d plus interest %d", i, payment.Amount, payment.PrincipalPart, payment.InterestPart)
+				}
+				if test.rate == 0 && payment.InterestPart != 0 {
+					t.Errorf("payment %d has interest %d at a zero rate", i, payment.InterestPart)
+				}
+
+				principal += payment.PrincipalPart
+			}
+
+			if principal != test.amount {
+				t.Errorf("principal parts sum to %d, want %d", principal, test.amount)
+			}
+		})
+	}
+}
+
+func TestCalcDifferentiatedScheduleSplitsPrincipalEvenly(t *testing.T) {
+	startDate := time.Date(2025, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	schedule := calcDifferentiatedSchedule(12, startDate, 1000003, 10, "loan")
+
+	for i, payment := range schedule[:len(schedule)-1] {
+		if payment.PrincipalPart != 100000 {
+			t.Errorf("payment %d has principal %d, want 100000", i, payment.PrincipalPart)
+		}
+		if i > 0 && payment.Amount > schedule[i-1].Amount {
+			t.Errorf("payment %d of %d is larger than the previous one of %d", i, payment.Amount, schedule[i-1].Amount)
+		}
+	}
+
+	if last := schedule[len(schedule)-1]; last.PrincipalPart != 100003 {
+		t.Errorf("last payment has principal %d, want 100003", last.PrincipalPart)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rateRetryDelay keeps a failing rate source from being queried on every call
+const rateRetryDelay = time.Minute
+
+// rateCache keeps the value of a rate source, like the key rate or the
+// exchange rates of the Central Bank, for ttl and persists every fetched
+// value. When the source fails, the last known good value is used, from
+// memory or from the database, as long as it is not older than maxAge.
+// A zero maxAge allows any age.
+//
+// The source is queried without holding the mutex, so a slow source does
+// not block callers that can be served from the cache.
+type rateCache[T any] struct {
+	name   string
+	ttl    time.Duration
+	maxAge time.Duration
+	logger *logrus.Logger
+
+	// fetch queries the source
+	fetch func(ctx context.Context) (T, error)
+	// save persists a fetched value
+	save func(ctx context.Context, value T, fetchedAt time.Time) error
+	// getLatest returns the last persisted value and when it was fetched
+	getLatest func(ctx context.Context) (T, time.Time, error)
+
+	mutex     sync.Mutex
+	value     T
+	hasValue  bool
+	fetchedAt time.Time
+	failedAt  time.Time
+	fetching  bool
+}
+
+// usable reports whether a value fetched at fetchedAt may still be returned
+// when the source fails.
+func (this *rateCache[T]) usable(fetchedAt time.Time) bool {
+	return this.maxAge == 0 || time.Since(fetchedAt) <= this.maxAge
+}
+
+func (this *rateCache[T]) get(ctx context.Context) (T, error) {
+	this.mutex.Lock()
+	value, hasValue, fetchedAt := this.value, this.hasValue, this.fetchedAt
+	fresh := hasValue && time.Since(fetchedAt) < this.ttl
+	// while the value is being fetched or the source has just failed, the
+	// cached value is returned instead of querying it again
+	waiting := hasValue && this.usable(fetchedAt) && (this.fetching || time.Since(this.failedAt) < rateRetryDelay)
+	if fresh || waiting {
+		this.mutex.Unlock()
+		return value, nil
+	}
+	this.fetching = true
+	this.mutex.Unlock()
+
+	fetched, err := this.fetch(ctx)
+	now := time.Now()
+
+	this.mutex.Lock()
+	this.fetching = false
+	if err == nil {
+		this.value = fetched
+		this.hasValue = true
+		this.fetchedAt = now
+		this.failedAt = time.Time{}
+	} else {
+		this.failedAt = now
+	}
+	value, hasValue, fetchedAt = this.value, this.hasValue, this.fetchedAt
+	this.mutex.Unlock()
+
+	if err == nil {
+		saveErr := this.save(ctx, fetched, now)
+		if saveErr != nil {
+			this.logger.Errorf("Failed to save %s: %v", this.name, saveErr)
+		}
+
+		return fetched, nil
+	}
+
+	this.logger.Errorf("Failed to get %s, falling back to last known value: %v", this.name, err)
+
+	if hasValue && this.usable(fetchedAt) {
+		return value, nil
+	}
+
+	var none T
+
+	latest, latestFetchedAt, dbErr := this.getLatest(ctx)
+	if dbErr != nil {
+		this.logger.Errorf("Failed to get last known %s: %v", this.name, dbErr)
+		return none, err
+	}
+	if !this.usable(latestFetchedAt) {
+		this.logger.Errorf("Last known %s fetched at %s is older than %s", this.name, latestFetchedAt.Format(time.RFC3339), this.maxAge)
+		return none, err
+	}
+
+	this.mutex.Lock()
+	if !this.hasValue || this.fetchedAt.Before(latestFetchedAt) {
+		this.value = latest
+		this.hasValue = true
+		this.fetchedAt = latestFetchedAt
+	}
+	this.mutex.Unlock()
+
+	return latest, nil
+}
@@ -1,27 +1,85 @@
 package services
 
 import (
+	"bank-system/config"
+	"bank-system/src/entities"
 	"bank-system/src/repositories"
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// maxAutoDebitAttempts is how many times an installment is debited
+	// automatically before it is left to the overdue checker for good.
+	maxAutoDebitAttempts = 3
+	autoDebitRetryDelay  = 24 * time.Hour
+	penaltyAccrualPeriod = 24 * time.Hour
+	// overdraftAccrualPeriod is how often interest is charged on negative balances
+	overdraftAccrualPeriod = 24 * time.Hour
+	// maxStandingOrderAttempts is how many times a transfer of a standing
+	// order is attempted before it is skipped until the next one is due.
+	maxStandingOrderAttempts = 3
+	standingOrderRetryDelay  = 6 * time.Hour
+)
+
 type SchedulerService interface {
 	StartPaymentOverdueChecker(ctx context.Context)
+	StartLoanAutoDebit(ctx context.Context)
+	StartPenaltyAccrual(ctx context.Context)
+	StartStandingOrders(ctx context.Context)
+	StartOverdraftInterestAccrual(ctx context.Context)
+	StartHoldExpiry(ctx context.Context)
+	StartCardKeyRotation(ctx context.Context)
 	checkOverduePayments(ctx context.Context) error
+	debitDuePayments(ctx context.Context) error
+	accruePenalties(ctx context.Context) error
+	runStandingOrders(ctx context.Context) error
+	accrueOverdraftInterest(ctx context.Context) error
+	expireHolds(ctx context.Context) error
+	rotateCardKeys(ctx context.Context) error
 }
 
 type schedulerService struct {
-	paymentRepository repositories.PaymentRepository
-	logger            *logrus.Logger
+	accountRepository       repositories.AccountRepository
+	loanRepository          repositories.LoanRepository
+	paymentRepository       repositories.PaymentRepository
+	standingOrderRepository repositories.StandingOrderRepository
+	holdRepository          repositories.HoldRepository
+	accountService          AccountService
+	cardService             CardService
+	userService             UserService
+	loanConfig              config.LoanConfig
+	logger                  *logrus.Logger
 }
 
-func NewSchedulerService(paymentRepository repositories.PaymentRepository, logger *logrus.Logger) SchedulerService {
+func NewSchedulerService(
+	accountRepository repositories.AccountRepository,
+	loanRepository repositories.LoanRepository,
+	paymentRepository repositories.PaymentRepository,
+	standingOrderRepository repositories.StandingOrderRepository,
+	holdRepository repositories.HoldRepository,
+	accountService AccountService,
+	cardService CardService,
+	userService UserService,
+	logger *logrus.Logger,
+) SchedulerService {
 	return &schedulerService{
-		paymentRepository: paymentRepository,
-		logger:            logger,
+		accountRepository:       accountRepository,
+		loanRepository:          loanRepository,
+		paymentRepository:       paymentRepository,
+		standingOrderRepository: standingOrderRepository,
+		holdRepository:          holdRepository,
+		accountService:          accountService,
+		cardService:             cardService,
+		userService:             userService,
+		loanConfig:              config.LoadLoanConfig(),
+		logger:                  logger,
 	}
 }
 
@@ -38,9 +96,7 @@ func (this *schedulerService) checkOverduePayments(ctx context.Context) error {
 
 	// Mark each payment as overdue
 	for _, payment := range payments {
-		payment.Status = "OVERDUE"
-
-		_, err = this.paymentRepository.Update(ctx, payment)
+		err = this.paymentRepository.MarkOverdue(ctx, payment.ID)
 
 		if err != nil {
 			this.logger.Errorf("Failed to mark payment %s as overdue: %v", payment.ID, err)
@@ -76,3 +132,558 @@ func (this *schedulerService) StartPaymentOverdueChecker(ctx context.Context) {
 		}
 	}()
 }
+
+// debitPayment debits what is outstanding on the payment as it was read. The
+// repayment is rejected with ErrPaymentChanged instead of settling the payment
+// twice when a manual repayment has paid it meanwhile.
+func (this *schedulerService) debitPayment(ctx context.Context, payment entities.Payment, now time.Time) error {
+	loan, err := this.loanRepository.GetById(ctx, payment.LoanId)
+	if err != nil {
+		return err
+	}
+
+	account, err := this.accountRepository.GetById(ctx, loan.AccountId)
+	if err != nil {
+		return err
+	}
+
+	outstanding := paymentOutstanding(payment)
+	// The ledger checks the balance again under the account lock
+	if account.AvailableBalance+account.OverdraftLimit < outstanding {
+		return repositories.ErrInsufficientFunds
+	}
+
+	repayments, split := allocateRepayment([]entities.Payment{payment}, outstanding)
+
+	transaction := entities.Transaction{
+		ID:            uuid.New().String(),
+		Amount:        outstanding,
+		Currency:      entities.DefaultCurrency,
+		FromAccountId: loan.AccountId,
+		ToAccountId:   loan.ID,
+		Type:          "loan_repayment",
+		Description:   fmt.Sprintf("Automatic repayment of loan %s", loan.ID),
+		CreatedAt:     now.Unix(),
+	}
+
+	return this.loanRepository.Repay(ctx, loan.ID, repayments, now.Unix(), transaction, repaymentEntry(transaction, loan.AccountId, split))
+}
+
+func (this *schedulerService) debitDuePayments(ctx context.Context) error {
+	this.logger.Info("Debiting due loan payments")
+
+	now := time.Now()
+
+	payments, err := this.paymentRepository.GetDueForDebit(ctx, now.Unix(), maxAutoDebitAttempts)
+	if err != nil {
+		return err
+	}
+
+	this.logger.Infof("Found %d due payments", len(payments))
+
+	for _, payment := range payments {
+		err = this.debitPayment(ctx, payment, now)
+
+		if err == nil {
+			this.logger.Infof("Debited payment %s", payment.ID)
+			continue
+		}
+
+		// Repaid by the user since it was read, what is left is debited on the next run
+		if errors.Is(err, repositories.ErrPaymentChanged) {
+			this.logger.Infof("Payment %s changed during the debit, skipped", payment.ID)
+			continue
+		}
+
+		if errors.Is(err, repositories.ErrInsufficientFunds) {
+			this.logger.Infof(
+				"Insufficient funds for payment %s, attempt %d of %d",
+				payment.ID,
+				payment.DebitAttempts+1,
+				maxAutoDebitAttempts,
+			)
+		} else {
+			this.logger.Errorf(
+				"Failed to debit payment %s, attempt %d of %d: %v",
+				payment.ID,
+				payment.DebitAttempts+1,
+				maxAutoDebitAttempts,
+				err,
+			)
+		}
+
+		// Any failure, e.g. a frozen account, counts as an attempt, so the
+		// payment is left for the overdue checker and retried later instead
+		// of on every run
+		err = this.paymentRepository.RecordDebitAttempt(ctx, payment.ID, now.Add(autoDebitRetryDelay).Unix())
+		if err != nil {
+			this.logger.Errorf("Failed to record debit attempt for payment %s: %v", payment.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartLoanAutoDebit(ctx context.Context) {
+	this.logger.Info("Starting loan auto-debit scheduler")
+
+	if err := this.debitDuePayments(ctx); err != nil {
+		this.logger.Errorf("Error debiting due payments: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.debitDuePayments(ctx); err != nil {
+					this.logger.Errorf("Error debiting due payments: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Loan auto-debit stopped")
+				return
+			}
+		}
+	}()
+}
+
+// calcPenalty returns the penalty accrued for every full day passed since the
+// last accrual (or since the due date) and the moment it is accrued up to.
+func calcPenalty(payment entities.Payment, dailyRate float64, now time.Time) (int64, int64) {
+	accruedAt := payment.PenaltyAccruedAt
+	if accruedAt == 0 {
+		accruedAt = payment.DueDate
+	}
+
+	days := (now.Unix() - accruedAt) / int64(penaltyAccrualPeriod.Seconds())
+	if days <= 0 {
+		return 0, accruedAt
+	}
+
+	// Penalty accrues on the overdue installment only, not on the penalty itself
+	overdue := payment.InterestPart - payment.InterestPaid + payment.PrincipalPart - payment.PrincipalPaid
+	penalty := math.Round(float64(overdue) * dailyRate / 100 * float64(days))
+
+	return int64(penalty), accruedAt + days*int64(penaltyAccrualPeriod.Seconds())
+}
+
+func (this *schedulerService) accruePenalties(ctx context.Context) error {
+	this.logger.Info("Accruing penalties on overdue payments")
+
+	payments, err := this.paymentRepository.GetUnpaidOverdue(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, payment := range payments {
+		penalty, accruedAt := calcPenalty(payment, this.loanConfig.PenaltyDailyRate, now)
+		if penalty == 0 {
+			continue
+		}
+
+		fromTime := payment.PenaltyAccruedAt
+		if fromTime == 0 {
+			fromTime = payment.DueDate
+		}
+
+		err = this.paymentRepository.AccruePenalty(ctx, payment.ID, penalty, fromTime, accruedAt)
+		if err != nil {
+			this.logger.Errorf("Failed to accrue penalty for payment %s: %v", payment.ID, err)
+			continue
+		}
+
+		this.logger.Infof("Accrued penalty %d for payment %s", penalty, payment.ID)
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartPenaltyAccrual(ctx context.Context) {
+	this.logger.Info("Starting penalty accrual scheduler")
+
+	if err := this.accruePenalties(ctx); err != nil {
+		this.logger.Errorf("Error accruing penalties: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.accruePenalties(ctx); err != nil {
+					this.logger.Errorf("Error accruing penalties: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Penalty accrual stopped")
+				return
+			}
+		}
+	}()
+}
+
+// standingOrderTransactionId is the id of the transfer of an order due at
+// its next run, the same for every attempt of that run.
+func standingOrderTransactionId(order entities.StandingOrder) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("standing-order:%s:%d", order.ID, order.NextRunAt))).String()
+}
+
+// runStandingOrder makes the due transfer of an order. The order is claimed
+// first, so it is not run twice by concurrent schedulers, and every attempt
+// is recorded. The transfer is keyed on the order and its scheduled time, so
+// a run whose transfer went through but was not recorded, e.g. because the
+// server stopped, is recorded as succeeded when retried instead of paying
+// again. A failed transfer is retried later and skipped after
+// maxStandingOrderAttempts; the user is notified of every failure.
+func (this *schedulerService) runStandingOrder(ctx context.Context, order entities.StandingOrder, now time.Time) error {
+	retryAt := now.Add(standingOrderRetryDelay).Unix()
+
+	claimed, err := this.standingOrderRepository.Claim(ctx, order.ID, order.NextRunAt, now.Unix(), retryAt)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		this.logger.Infof("Standing order %s has changed, skipping", order.ID)
+		return nil
+	}
+
+	transactionId, transferErr := this.accountService.TransferOnce(
+		ctx,
+		order.UserId,
+		standingOrderTransactionId(order),
+		entities.TransferDto{
+			FromAccountId: order.FromAccountId,
+			ToAccountId:   order.ToAccountId,
+			Amount:        order.Amount,
+			Description:   order.Description,
+			Convert:       order.Convert,
+		},
+	)
+	if errors.Is(transferErr, repositories.ErrTransactionExists) {
+		this.logger.Infof("Standing order %s has already been paid for %d", order.ID, order.NextRunAt)
+		transactionId = standingOrderTransactionId(order)
+		transferErr = nil
+	}
+
+	run := entities.StandingOrderRun{
+		ID:            uuid.New().String(),
+		OrderId:       order.ID,
+		TransactionId: transactionId,
+		Status:        "succeeded",
+		ScheduledAt:   order.NextRunAt,
+		RunAt:         now.Unix(),
+	}
+
+	order.LastRunAt = now.Unix()
+	order.UpdatedAt = now.Unix()
+	retrying := false
+
+	if transferErr == nil {
+		order.FailedAttempts = 0
+		order.LastError = ""
+		order.NextRunAt = nextStandingOrderRun(order, now.Unix())
+	} else {
+		run.Status = "failed"
+		run.Error = transferErr.Error()
+		order.LastError = transferErr.Error()
+		order.FailedAttempts++
+
+		if order.FailedAttempts < maxStandingOrderAttempts {
+			retrying = true
+			order.NextRunAt = retryAt
+		} else {
+			order.FailedAttempts = 0
+			order.NextRunAt = nextStandingOrderRun(order, now.Unix())
+		}
+	}
+
+	if isStandingOrderFinished(order) {
+		order.Status = "completed"
+	}
+
+	err = this.standingOrderRepository.RecordRun(ctx, order, run)
+	if err != nil {
+		return err
+	}
+
+	if transferErr != nil {
+		this.notifyStandingOrderFailure(ctx, order, transferErr, retrying)
+		return transferErr
+	}
+
+	return nil
+}
+
+func (this *schedulerService) notifyStandingOrderFailure(ctx context.Context, order entities.StandingOrder, transferErr error, retrying bool) {
+	user, err := this.userService.GetById(ctx, order.UserId)
+	if err != nil {
+		this.logger.Errorf("Failed to notify user of standing order %s: %v", order.ID, err)
+		return
+	}
+
+	amount := fmt.Sprintf("%d", order.Amount)
+	account, err := this.accountService.GetById(ctx, order.FromAccountId)
+	if currency, ok := entities.GetCurrency(account.Currency); err == nil && ok {
+		amount = currency.Format(order.Amount) + " " + currency.Code
+	}
+
+	next := fmt.Sprintf("The transfer will be retried at %s.", time.Unix(order.NextRunAt, 0).Format(time.DateTime))
+	if !retrying {
+		next = "This transfer is skipped."
+		if order.Status != "completed" {
+			next += fmt.Sprintf(" The next one is due at %s.", time.Unix(order.NextRunAt, 0).Format(time.DateTime))
+		}
+	}
+
+	go func() {
+		err := SendEmailNotification(
+			user.Email,
+			"Standing order transfer failed",
+			fmt.Sprintf(
+				"The transfer of %s from account %s to account %s by standing order %s failed: %v. %s",
+				amount,
+				order.FromAccountId,
+				order.ToAccountId,
+				order.ID,
+				transferErr,
+				next,
+			),
+		)
+		if err != nil {
+			this.logger.Errorf("Failed to send email notification: %v", err)
+		}
+	}()
+}
+
+func (this *schedulerService) runStandingOrders(ctx context.Context) error {
+	this.logger.Info("Running due standing orders")
+
+	now := time.Now()
+
+	orders, err := this.standingOrderRepository.GetDue(ctx, now.Unix())
+	if err != nil {
+		return err
+	}
+
+	this.logger.Infof("Found %d due standing orders", len(orders))
+
+	for _, order := range orders {
+		err = this.runStandingOrder(ctx, order, now)
+		if err != nil {
+			this.logger.Errorf("Failed to run standing order %s: %v", order.ID, err)
+			continue
+		}
+
+		this.logger.Infof("Ran standing order %s", order.ID)
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartStandingOrders(ctx context.Context) {
+	this.logger.Info("Starting standing order scheduler")
+
+	if err := this.runStandingOrders(ctx); err != nil {
+		this.logger.Errorf("Error running standing orders: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.runStandingOrders(ctx); err != nil {
+					this.logger.Errorf("Error running standing orders: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Standing order scheduler stopped")
+				return
+			}
+		}
+	}()
+}
+
+// calcOverdraftInterest returns the interest on the overdrawn amount of the
+// account at its annual rate for the whole days since interest was last
+// charged, or since the account became overdrawn, and the time the interest
+// is charged up to.
+func calcOverdraftInterest(account entities.Account, now time.Time) (int64, int64) {
+	accruedAt := account.OverdraftAccruedAt
+	if account.Balance >= 0 || accruedAt == 0 {
+		return 0, accruedAt
+	}
+
+	days := (now.Unix() - accruedAt) / int64(overdraftAccrualPeriod.Seconds())
+	if days <= 0 {
+		return 0, accruedAt
+	}
+
+	interest := math.Round(float64(-account.Balance) * account.OverdraftRate / 100 / 365 * float64(days))
+
+	return int64(interest), accruedAt + days*int64(overdraftAccrualPeriod.Seconds())
+}
+
+// accrueOverdraftInterest charges interest on the negative balance of every
+// account for each whole day it has been overdrawn since interest was last
+// charged, so days missed while the scheduler was not running are caught up.
+func (this *schedulerService) accrueOverdraftInterest(ctx context.Context) error {
+	this.logger.Info("Accruing overdraft interest")
+
+	accounts, err := this.accountRepository.GetOverdrawn(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, account := range accounts {
+		interest, accruedAt := calcOverdraftInterest(account, now)
+		if interest == 0 {
+			continue
+		}
+
+		transaction := entities.Transaction{
+			ID:            uuid.New().String(),
+			Amount:        interest,
+			Currency:      account.Currency,
+			FromAccountId: account.ID,
+			Type:          "overdraft_interest",
+			Description:   "Overdraft interest",
+			CreatedAt:     now.Unix(),
+		}
+		entry := newJournalEntry(transaction)
+		entry.Forced = true
+		entry.Debit(account.ID, interest)
+		entry.Credit(entities.InterestIncomeLedgerAccount, interest)
+
+		err = this.accountRepository.AccrueOverdraftInterest(ctx, transaction, entry, account.OverdraftAccruedAt, accruedAt)
+		if err != nil {
+			this.logger.Errorf("Failed to accrue overdraft interest for account %s: %v", account.ID, err)
+			continue
+		}
+
+		this.logger.Infof("Accrued overdraft interest %d for account %s", interest, account.ID)
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartOverdraftInterestAccrual(ctx context.Context) {
+	this.logger.Info("Starting overdraft interest accrual scheduler")
+
+	if err := this.accrueOverdraftInterest(ctx); err != nil {
+		this.logger.Errorf("Error accruing overdraft interest: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.accrueOverdraftInterest(ctx); err != nil {
+					this.logger.Errorf("Error accruing overdraft interest: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Overdraft interest accrual stopped")
+				return
+			}
+		}
+	}()
+}
+
+// expireHolds releases card holds that were neither captured nor voided in time.
+func (this *schedulerService) expireHolds(ctx context.Context) error {
+	this.logger.Info("Expiring card holds")
+
+	now := time.Now().Unix()
+
+	holds, err := this.holdRepository.GetExpired(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, hold := range holds {
+		hold.Status = "expired"
+		hold.UpdatedAt = now
+
+		err = this.holdRepository.Release(ctx, hold)
+		if err != nil {
+			this.logger.Errorf("Failed to expire hold %s: %v", hold.ID, err)
+			continue
+		}
+
+		this.logger.Infof("Expired hold %s", hold.ID)
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartHoldExpiry(ctx context.Context) {
+	this.logger.Info("Starting hold expiry scheduler")
+
+	if err := this.expireHolds(ctx); err != nil {
+		this.logger.Errorf("Error expiring holds: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.expireHolds(ctx); err != nil {
+					this.logger.Errorf("Error expiring holds: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Hold expiry stopped")
+				return
+			}
+		}
+	}()
+}
+
+// rotateCardKeys moves card data keys wrapped with previous master keys to
+// the current master key, after which the previous keys can be retired.
+func (this *schedulerService) rotateCardKeys(ctx context.Context) error {
+	this.logger.Info("Rotating card keys")
+
+	rotated, err := this.cardService.RotateKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rotated > 0 {
+		this.logger.Infof("Rewrapped data keys of %d cards", rotated)
+	}
+
+	return nil
+}
+
+func (this *schedulerService) StartCardKeyRotation(ctx context.Context) {
+	this.logger.Info("Starting card key rotation scheduler")
+
+	if err := this.rotateCardKeys(ctx); err != nil {
+		this.logger.Errorf("Error rotating card keys: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := this.rotateCardKeys(ctx); err != nil {
+					this.logger.Errorf("Error rotating card keys: %v", err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				this.logger.Info("Card key rotation stopped")
+				return
+			}
+		}
+	}()
+}
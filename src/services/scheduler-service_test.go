@@ -0,0 +1,67 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"testing"
+	"time"
+)
+
+func TestCalcOverdraftInterest(t *testing.T) {
+	now := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)
+	day := int64(overdraftAccrualPeriod.Seconds())
+
+	tests := []struct {
+		name          string
+		balance       int64
+		accruedAt     int64
+		wantInterest  int64
+		wantAccruedAt int64
+	}{
+		{"overdrawn a minute ago", -3650000, now.Unix() - 60, 0, now.Unix() - 60},
+		{"one day", -3650000, now.Unix() - day, 2500, now.Unix()},
+		{"day and a half", -3650000, now.Unix() - day*3/2, 2500, now.Unix() - day/2},
+		{"three days of downtime", -3650000, now.Unix() - 3*day - 60, 7500, now.Unix() - 60},
+		{"not overdrawn", 100, now.Unix() - 3*day, 0, now.Unix() - 3*day},
+		{"start unknown", -3650000, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			account := entities.Account{Balance: test.balance, OverdraftRate: 25, OverdraftAccruedAt: test.accruedAt}
+
+			interest, accruedAt := calcOverdraftInterest(account, now)
+			if interest != test.wantInterest || accruedAt != test.wantAccruedAt {
+				t.Errorf("got %d accrued up to %d, want %d up to %d", interest, accruedAt, test.wantInterest, test.wantAccruedAt)
+			}
+		})
+	}
+}
+
+func TestIsStandingOrderFinished(t *testing.T) {
+	endDate := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name           string
+		nextRunAt      int64
+		failedAttempts int
+		want           bool
+	}{
+		{"next run before the end", endDate - 60, 0, false},
+		{"next run after the end", endDate + 60, 0, true},
+		{"retry after the end", endDate + 60, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := entities.StandingOrder{EndDate: endDate, NextRunAt: test.nextRunAt, FailedAttempts: test.failedAttempts}
+
+			if got := isStandingOrderFinished(order); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	if isStandingOrderFinished(entities.StandingOrder{NextRunAt: endDate}) {
+		t.Error("order without an end date is finished")
+	}
+}
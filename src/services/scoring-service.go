@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bank-system/config"
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scoringIncomeMonths is the period of transaction history the income is estimated from
+const scoringIncomeMonths = 3
+
+type ScoringService interface {
+	Evaluate(ctx context.Context, userId string, application entities.LoanApplication, product entities.LoanProduct, interestRate float64) (entities.LoanDecision, error)
+}
+
+type scoringService struct {
+	accountRepository     repositories.AccountRepository
+	transactionRepository repositories.TransactionRepository
+	loanRepository        repositories.LoanRepository
+	paymentRepository     repositories.PaymentRepository
+	loanConfig            config.LoanConfig
+	logger                *logrus.Logger
+}
+
+func NewScoringService(
+	accountRepository repositories.AccountRepository,
+	transactionRepository repositories.TransactionRepository,
+	loanRepository repositories.LoanRepository,
+	paymentRepository repositories.PaymentRepository,
+	logger *logrus.Logger,
+) ScoringService {
+	return &scoringService{
+		accountRepository:     accountRepository,
+		transactionRepository: transactionRepository,
+		loanRepository:        loanRepository,
+		paymentRepository:     paymentRepository,
+		loanConfig:            config.LoadLoanConfig(),
+		logger:                logger,
+	}
+}
+
+// estimateMonthlyIncome averages money received from outside the user's own
+// accounts over the last scoringIncomeMonths months. Loan disbursements are
+// not income, and neither is money moved between the user's own accounts,
+// including the credit leg of a converted transfer, which has no source
+// account of its own and is linked to the debit leg instead.
+func (this *scoringService) estimateMonthlyIncome(ctx context.Context, userId string) (int64, error) {
+	accounts, err := this.accountRepository.GetAll(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	ownAccounts := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		ownAccounts[account.ID] = true
+	}
+
+	since := time.Now().AddDate(0, -scoringIncomeMonths, 0).Unix()
+
+	var received []entities.Transaction
+	// ownDebits are the transactions taking money from the user's accounts
+	ownDebits := make(map[string]bool)
+
+	for _, account := range accounts {
+		transactions, err := this.transactionRepository.GetByAccountId(ctx, account.ID)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, transaction := range transactions {
+			if ownAccounts[transaction.FromAccountId] {
+				ownDebits[transaction.ID] = true
+			}
+			if transaction.ToAccountId == account.ID {
+				received = append(received, transaction)
+			}
+		}
+	}
+
+	var income int64
+	for _, transaction := range received {
+		if transaction.CreatedAt < since {
+			continue
+		}
+		if transaction.Type != "deposit" && transaction.Type != "transfer" {
+			continue
+		}
+		// Income is compared with ruble installments
+		if transaction.Currency != entities.DefaultCurrency {
+			continue
+		}
+		if ownAccounts[transaction.FromAccountId] || ownDebits[transaction.LinkedTransactionId] {
+			continue
+		}
+
+		income += transaction.Amount
+	}
+
+	return income / scoringIncomeMonths, nil
+}
+
+// getLoanObligations returns the monthly installments of the user's active
+// loans and the number of their overdue payments.
+func (this *scoringService) getLoanObligations(ctx context.Context, userId string) (int64, int, error) {
+	loans, err := this.loanRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var installments int64
+	var overdue int
+
+	for _, loan := range loans {
+		if loan.Debt == 0 {
+			continue
+		}
+
+		payments, err := this.paymentRepository.GetByLoanId(ctx, loan.ID)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		unpaid := unpaidPayments(payments)
+		for _, payment := range unpaid {
+			if payment.Status == "overdue" {
+				overdue++
+			}
+		}
+
+		// The next regular installment stands for the monthly obligation
+		for _, payment := range unpaid {
+			if payment.Status != "overdue" {
+				installments += payment.Amount
+				break
+			}
+		}
+	}
+
+	return installments, overdue, nil
+}
+
+// calcAffordableAmount returns the largest principal whose highest
+// installment does not exceed installment.
+func calcAffordableAmount(scheduleType string, installment int64, term int, interestRate float64) int64 {
+	monthlyRate := interestRate / 12.0 / 100.0
+	n := float64(term)
+
+	if scheduleType == "differentiated" {
+		return int64(math.Floor(float64(installment) / (1/n + monthlyRate)))
+	}
+	if monthlyRate == 0 {
+		return installment * int64(term)
+	}
+
+	return int64(math.Floor(float64(installment) * (1 - math.Pow(1+monthlyRate, -n)) / monthlyRate))
+}
+
+func (this *scoringService) Evaluate(ctx context.Context, userId string, application entities.LoanApplication, product entities.LoanProduct, interestRate float64) (entities.LoanDecision, error) {
+	decision := entities.LoanDecision{Reasons: []string{}}
+
+	income, err := this.estimateMonthlyIncome(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to estimate income: %v", err)
+		return entities.LoanDecision{}, err
+	}
+	decision.MonthlyIncome = income
+
+	obligations, overdue, err := this.getLoanObligations(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get loan obligations: %v", err)
+		return entities.LoanDecision{}, err
+	}
+
+	schedule := buildPaymentSchedule(
+		application.ScheduleType,
+		interestRate,
+		time.Now(),
+		application.Amount,
+		application.Term,
+		application.ID,
+	)
+	// The first installment is the highest one for both schedule types
+	installment := schedule[0].Amount
+
+	if overdue > 0 {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("%d overdue payments on existing loans", overdue))
+	}
+	if income == 0 {
+		decision.Reasons = append(decision.Reasons, "No regular income found in the last 3 months")
+	}
+	if len(decision.Reasons) > 0 {
+		decision.Status = "rejected"
+		return decision, nil
+	}
+
+	decision.DebtToIncome = float64(obligations+installment) / float64(income)
+	if decision.DebtToIncome <= this.loanConfig.MaxDebtToIncome {
+		decision.Status = "approved"
+		return decision, nil
+	}
+
+	decision.Reasons = append(
+		decision.Reasons,
+		fmt.Sprintf("Debt-to-income ratio %.2f exceeds %.2f", decision.DebtToIncome, this.loanConfig.MaxDebtToIncome),
+	)
+
+	affordableInstallment := int64(float64(income)*this.loanConfig.MaxDebtToIncome) - obligations
+	if affordableInstallment > 0 {
+		offered := calcAffordableAmount(application.ScheduleType, affordableInstallment, application.Term, interestRate)
+		if offered >= product.MinAmount && offered < application.Amount {
+			decision.Status = "counter_offer"
+			decision.OfferedAmount = offered
+			decision.Reasons = append(decision.Reasons, fmt.Sprintf("Up to %d can be offered for the same term", offered))
+			return decision, nil
+		}
+	}
+
+	decision.Status = "rejected"
+	return decision, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeScoringAccountRepository serves the accounts of the scored user, the
+// methods scoring does not use are left unimplemented.
+type fakeScoringAccountRepository struct {
+	repositories.AccountRepository
+	accounts []entities.Account
+}
+
+func (this *fakeScoringAccountRepository) GetAll(ctx context.Context, userId string) ([]entities.Account, error) {
+	return this.accounts, nil
+}
+
+type fakeScoringTransactionRepository struct {
+	repositories.TransactionRepository
+	transactions []entities.Transaction
+}
+
+func (this *fakeScoringTransactionRepository) GetByAccountId(ctx context.Context, id string) ([]entities.Transaction, error) {
+	var transactions []entities.Transaction
+	for _, transaction := range this.transactions {
+		if transaction.FromAccountId == id || transaction.ToAccountId == id {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions, nil
+}
+
+func TestEstimateMonthlyIncomeExcludesOwnTransfers(t *testing.T) {
+	now := time.Now().Unix()
+
+	transactions := []entities.Transaction{
+		// salary from another customer
+		{ID: "salary", Amount: 300000, Currency: "RUB", FromAccountId: "employer", ToAccountId: "rub", Type: "transfer", CreatedAt: now},
+		// cash deposit
+		{ID: "cash", Amount: 60000, Currency: "RUB", ToAccountId: "rub", Type: "deposit", CreatedAt: now},
+		// transfer between own ruble accounts
+		{ID: "own", Amount: 500000, Currency: "RUB", FromAccountId: "rub", ToAccountId: "savings", Type: "transfer", CreatedAt: now},
+		// converted transfer from the own dollar account
+		{ID: "debit", Amount: 10000, Currency: "USD", FromAccountId: "usd", Type: "transfer", LinkedTransactionId: "credit", CreatedAt: now},
+		{ID: "credit", Amount: 900000, Currency: "RUB", ToAccountId: "rub", Type: "transfer", LinkedTransactionId: "debit", CreatedAt: now},
+		// converted transfer from someone else's dollar account
+		{ID: "foreign-debit", Amount: 1000, Currency: "USD", FromAccountId: "relative", Type: "transfer", LinkedTransactionId: "foreign-credit", CreatedAt: now},
+		{ID: "foreign-credit", Amount: 90000, Currency: "RUB", ToAccountId: "rub", Type: "transfer", LinkedTransactionId: "foreign-debit", CreatedAt: now},
+	}
+
+	service := &scoringService{
+		accountRepository: &fakeScoringAccountRepository{accounts: []entities.Account{
+			{ID: "rub", Currency: "RUB"},
+			{ID: "savings", Currency: "RUB"},
+			{ID: "usd", Currency: "USD"},
+		}},
+		transactionRepository: &fakeScoringTransactionRepository{transactions: transactions},
+		logger:                discardLogger(),
+	}
+
+	income, err := service.estimateMonthlyIncome(context.Background(), "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := int64(300000+60000+90000) / scoringIncomeMonths; income != want {
+		t.Errorf("got monthly income %d, want %d", income, want)
+	}
+}
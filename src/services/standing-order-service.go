@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type StandingOrderService interface {
+	Create(ctx context.Context, userId string, data entities.CreateStandingOrderDto) (entities.StandingOrder, error)
+	GetAll(ctx context.Context, userId string) ([]entities.StandingOrder, error)
+	GetById(ctx context.Context, userId string, id string) (entities.StandingOrder, error)
+	Update(ctx context.Context, userId string, id string, data entities.UpdateStandingOrderDto) (entities.StandingOrder, error)
+	Cancel(ctx context.Context, userId string, id string) (entities.StandingOrder, error)
+	GetRuns(ctx context.Context, userId string, id string) ([]entities.StandingOrderRun, error)
+}
+
+type standingOrderService struct {
+	standingOrderRepository repositories.StandingOrderRepository
+	accountService          AccountService
+	logger                  *logrus.Logger
+}
+
+func NewStandingOrderService(
+	standingOrderRepository repositories.StandingOrderRepository,
+	accountService AccountService,
+	logger *logrus.Logger,
+) StandingOrderService {
+	return &standingOrderService{
+		standingOrderRepository: standingOrderRepository,
+		accountService:          accountService,
+		logger:                  logger,
+	}
+}
+
+// addMonthsClamped moves date by months keeping the day of month, or using
+// the last day of shorter months, so a transfer on the 31st runs on the 30th
+// of April rather than on the 1st of May.
+func addMonthsClamped(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month()+time.Month(months), 1, date.Hour(), date.Minute(), date.Second(), 0, date.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	return first.AddDate(0, 0, min(date.Day(), lastDay)-1)
+}
+
+// standingOrderOccurrence returns the time of the n-th transfer of the order, starting from 0.
+func standingOrderOccurrence(order entities.StandingOrder, n int) time.Time {
+	start := time.Unix(order.StartDate, 0)
+
+	switch order.Frequency {
+	case "daily":
+		return start.AddDate(0, 0, n*order.Interval)
+	case "weekly":
+		return start.AddDate(0, 0, 7*n*order.Interval)
+	default:
+		return addMonthsClamped(start, n*order.Interval)
+	}
+}
+
+// nextStandingOrderRun returns the first transfer of the order after the given moment.
+// Transfers missed in between are skipped rather than made up for.
+func nextStandingOrderRun(order entities.StandingOrder, after int64) int64 {
+	for n := 0; ; n++ {
+		occurrence := standingOrderOccurrence(order, n).Unix()
+		if occurrence > after {
+			return occurrence
+		}
+	}
+}
+
+// isStandingOrderFinished reports whether the next run of the order is past its end date.
+// A retry of a failed transfer never is: it retries a transfer that was due
+// by the end date, even when the retry itself is scheduled after it.
+func isStandingOrderFinished(order entities.StandingOrder) bool {
+	return order.EndDate != 0 && order.FailedAttempts == 0 && order.NextRunAt > order.EndDate
+}
+
+func (this *standingOrderService) Create(ctx context.Context, userId string, data entities.CreateStandingOrderDto) (entities.StandingOrder, error) {
+	from, err := this.accountService.GetById(ctx, data.FromAccountId)
+	if err != nil {
+		return entities.StandingOrder{}, err
+	}
+
+	if from.UserID != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.StandingOrder{}, errors.New("Unauthorised")
+	}
+
+	to, err := this.accountService.GetById(ctx, data.ToAccountId)
+	if err != nil {
+		return entities.StandingOrder{}, err
+	}
+
+	if from.Status == "closed" || to.Status == "closed" {
+		this.logger.Errorf("Standing order between %s and %s accounts", from.Status, to.Status)
+		return entities.StandingOrder{}, repositories.ErrAccountClosed
+	}
+
+	if from.Currency != to.Currency && !data.Convert {
+		this.logger.Errorf("Standing order from %s to %s account without conversion", from.Currency, to.Currency)
+		return entities.StandingOrder{}, errors.New("Account currencies differ, conversion is required")
+	}
+
+	interval := data.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	now := time.Now().Unix()
+	order := entities.StandingOrder{
+		ID:            uuid.New().String(),
+		UserId:        userId,
+		FromAccountId: data.FromAccountId,
+		ToAccountId:   data.ToAccountId,
+		Amount:        data.Amount,
+		Description:   data.Description,
+		Convert:       data.Convert,
+		Frequency:     data.Frequency,
+		Interval:      interval,
+		StartDate:     data.StartDate,
+		EndDate:       data.EndDate,
+		Status:        "active",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	order.NextRunAt = nextStandingOrderRun(order, now-1)
+
+	if isStandingOrderFinished(order) {
+		this.logger.Errorf("Standing order ends before its next transfer")
+		return entities.StandingOrder{}, errors.New("No transfers left before the end date")
+	}
+
+	_, err = this.standingOrderRepository.Create(ctx, order)
+	if err != nil {
+		this.logger.Errorf("Failed to create standing order: %v", err)
+		return entities.StandingOrder{}, err
+	}
+
+	return order, nil
+}
+
+func (this *standingOrderService) GetAll(ctx context.Context, userId string) ([]entities.StandingOrder, error) {
+	orders, err := this.standingOrderRepository.GetByUserId(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get standing orders: %v", err)
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (this *standingOrderService) GetById(ctx context.Context, userId string, id string) (entities.StandingOrder, error) {
+	order, err := this.standingOrderRepository.GetById(ctx, id)
+	if err != nil {
+		this.logger.Errorf("Failed to get standing order: %v", err)
+		return entities.StandingOrder{}, err
+	}
+
+	if order.UserId != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.StandingOrder{}, errors.New("Unauthorised")
+	}
+
+	return order, nil
+}
+
+// Update changes the terms of an order and pauses or resumes it. A resumed
+// order continues with its next transfer after now.
+func (this *standingOrderService) Update(ctx context.Context, userId string, id string, data entities.UpdateStandingOrderDto) (entities.StandingOrder, error) {
+	order, err := this.GetById(ctx, userId, id)
+	if err != nil {
+		return entities.StandingOrder{}, err
+	}
+
+	if order.Status != "active" && order.Status != "paused" {
+		this.logger.Errorf("Standing order %s is %s", order.ID, order.Status)
+		return entities.StandingOrder{}, repositories.ErrStandingOrderClosed
+	}
+
+	now := time.Now().Unix()
+
+	if order.Status == "paused" && data.Status == "active" {
+		order.NextRunAt = nextStandingOrderRun(order, now-1)
+		order.FailedAttempts = 0
+	}
+
+	order.Amount = data.Amount
+	order.Description = data.Description
+	order.Convert = data.Convert
+	order.EndDate = data.EndDate
+	order.Status = data.Status
+	order.UpdatedAt = now
+
+	if isStandingOrderFinished(order) {
+		order.Status = "completed"
+	}
+
+	err = this.standingOrderRepository.Update(ctx, order)
+	if err != nil {
+		this.logger.Errorf("Failed to update standing order: %v", err)
+		return entities.StandingOrder{}, err
+	}
+
+	return order, nil
+}
+
+func (this *standingOrderService) Cancel(ctx context.Context, userId string, id string) (entities.StandingOrder, error) {
+	order, err := this.GetById(ctx, userId, id)
+	if err != nil {
+		return entities.StandingOrder{}, err
+	}
+
+	order.Status = "cancelled"
+	order.UpdatedAt = time.Now().Unix()
+
+	err = this.standingOrderRepository.Update(ctx, order)
+	if err != nil {
+		this.logger.Errorf("Failed to cancel standing order: %v", err)
+		return entities.StandingOrder{}, err
+	}
+
+	return order, nil
+}
+
+func (this *standingOrderService) GetRuns(ctx context.Context, userId string, id string) ([]entities.StandingOrderRun, error) {
+	_, err := this.GetById(ctx, userId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	runs, err := this.standingOrderRepository.GetRuns(ctx, id)
+	if err != nil {
+		this.logger.Errorf("Failed to get standing order runs: %v", err)
+		return nil, err
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/google/uuid"
+)
+
+const (
+	statementDateLayout     = "2006-01-02"
+	statementDateTimeLayout = "2006-01-02T15:04:05"
+	// camt053Namespace is the version of the ISO 20022 bank to customer statement
+	camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+)
+
+func formatStatementTime(timestamp int64, layout string) string {
+	return time.Unix(timestamp, 0).Format(layout)
+}
+
+// renderStatementCSV writes one row per transaction between the opening
+// and closing balance rows.
+func renderStatementCSV(statement entities.Statement, currency entities.Currency) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	rows := [][]string{
+		{"date", "transaction_id", "type", "description", "counterparty", "amount", "balance", "currency"},
+		{
+			formatStatementTime(statement.From, statementDateTimeLayout),
+			"",
+			"opening_balance",
+			"Opening balance",
+			"",
+			"",
+			currency.Format(statement.OpeningBalance),
+			statement.Currency,
+		},
+	}
+
+	for _, line := range statement.Lines {
+		rows = append(rows, []string{
+			formatStatementTime(line.CreatedAt, statementDateTimeLayout),
+			line.TransactionId,
+			line.Type,
+			line.Description,
+			line.CounterpartyId,
+			currency.Format(line.Amount),
+			currency.Format(line.Balance),
+			statement.Currency,
+		})
+	}
+
+	rows = append(rows, []string{
+		formatStatementTime(statement.To-1, statementDateTimeLayout),
+		"",
+		"closing_balance",
+		"Closing balance",
+		"",
+		"",
+		currency.Format(statement.ClosingBalance),
+		statement.Currency,
+	})
+
+	err := writer.WriteAll(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// camt053Balance appends a balance of the given ISO 20022 type, e.g. OPBD or CLBD.
+func camt053Balance(parent *etree.Element, code string, amount int64, date int64, currency entities.Currency) {
+	balance := parent.CreateElement("Bal")
+	balance.CreateElement("Tp").CreateElement("CdOrPrtry").CreateElement("Cd").SetText(code)
+	camt053Amount(balance, amount, currency)
+	balance.CreateElement("Dt").CreateElement("Dt").SetText(formatStatementTime(date, statementDateLayout))
+}
+
+// camt053Amount appends the absolute amount and whether it is a credit or a debit.
+func camt053Amount(parent *etree.Element, amount int64, currency entities.Currency) {
+	indicator := "CRDT"
+	if amount < 0 {
+		indicator = "DBIT"
+		amount = -amount
+	}
+
+	amountElement := parent.CreateElement("Amt")
+	amountElement.CreateAttr("Ccy", currency.Code)
+	amountElement.SetText(currency.Format(amount))
+	parent.CreateElement("CdtDbtInd").SetText(indicator)
+}
+
+func camt053EntriesSummary(parent *etree.Element, tag string, count int, sum int64, currency entities.Currency) {
+	summary := parent.CreateElement(tag)
+	summary.CreateElement("NbOfNtries").SetText(strconv.Itoa(count))
+	summary.CreateElement("Sum").SetText(currency.Format(sum))
+}
+
+// renderStatementCamt053 renders the statement as an ISO 20022 camt.053 message.
+func renderStatementCamt053(statement entities.Statement, currency entities.Currency) ([]byte, error) {
+	createdAt := formatStatementTime(statement.CreatedAt, statementDateTimeLayout)
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+
+	document := doc.CreateElement("Document")
+	document.CreateAttr("xmlns", camt053Namespace)
+	message := document.CreateElement("BkToCstmrStmt")
+
+	header := message.CreateElement("GrpHdr")
+	header.CreateElement("MsgId").SetText(uuid.New().String())
+	header.CreateElement("CreDtTm").SetText(createdAt)
+
+	stmt := message.CreateElement("Stmt")
+	stmt.CreateElement("Id").SetText(fmt.Sprintf("%s-%s", statement.AccountId, formatStatementTime(statement.From, "20060102")))
+	stmt.CreateElement("CreDtTm").SetText(createdAt)
+
+	// The end of the period is exclusive, so the last second before it is shown
+	period := stmt.CreateElement("FrToDt")
+	period.CreateElement("FrDtTm").SetText(formatStatementTime(statement.From, statementDateTimeLayout))
+	period.CreateElement("ToDtTm").SetText(formatStatementTime(statement.To-1, statementDateTimeLayout))
+
+	account := stmt.CreateElement("Acct")
+	account.CreateElement("Id").CreateElement("Othr").CreateElement("Id").SetText(statement.AccountId)
+	account.CreateElement("Ccy").SetText(statement.Currency)
+
+	camt053Balance(stmt, "OPBD", statement.OpeningBalance, statement.From, currency)
+	camt053Balance(stmt, "CLBD", statement.ClosingBalance, statement.To-1, currency)
+
+	var creditCount, debitCount int
+	for _, line := range statement.Lines {
+		if line.Amount > 0 {
+			creditCount++
+		} else {
+			debitCount++
+		}
+	}
+
+	summary := stmt.CreateElement("TxsSummry")
+	total := summary.CreateElement("TtlNtries")
+	total.CreateElement("NbOfNtries").SetText(strconv.Itoa(len(statement.Lines)))
+	camt053EntriesSummary(summary, "TtlCdtNtries", creditCount, statement.TotalCredit, currency)
+	camt053EntriesSummary(summary, "TtlDbtNtries", debitCount, statement.TotalDebit, currency)
+
+	for _, line := range statement.Lines {
+		bookedAt := formatStatementTime(line.CreatedAt, statementDateTimeLayout)
+
+		entry := stmt.CreateElement("Ntry")
+		entry.CreateElement("NtryRef").SetText(line.TransactionId)
+		camt053Amount(entry, line.Amount, currency)
+		entry.CreateElement("Sts").SetText("BOOK")
+		entry.CreateElement("BookgDt").CreateElement("DtTm").SetText(bookedAt)
+		entry.CreateElement("ValDt").CreateElement("DtTm").SetText(bookedAt)
+
+		code := entry.CreateElement("BkTxCd").CreateElement("Prtry")
+		code.CreateElement("Cd").SetText(line.Type)
+		code.CreateElement("Issr").SetText("bank-system")
+
+		details := entry.CreateElement("NtryDtls").CreateElement("TxDtls")
+		details.CreateElement("Refs").CreateElement("EndToEndId").SetText(line.TransactionId)
+		if line.CounterpartyId != "" {
+			// The counterparty pays credits to the account and receives its debits
+			party := "DbtrAcct"
+			if line.Amount < 0 {
+				party = "CdtrAcct"
+			}
+			details.CreateElement("RltdPties").CreateElement(party).CreateElement("Id").CreateElement("Othr").CreateElement("Id").SetText(line.CounterpartyId)
+		}
+		if line.Description != "" {
+			details.CreateElement("RmtInf").CreateElement("Ustrd").SetText(line.Description)
+		}
+	}
+
+	doc.Indent(2)
+
+	return doc.WriteToBytes()
+}
+
+const (
+	pdfLinesPerPage = 60
+	pdfFontSize     = 8
+	pdfLineHeight   = 12
+	// pdfDescriptionWidth keeps a line within the A4 page in a monospaced font
+	pdfDescriptionWidth = 34
+)
+
+// pdfEscape makes text safe for a PDF string literal. The standard fonts
+// only cover Latin characters, so anything else is replaced with "?".
+func pdfEscape(text string) string {
+	var builder strings.Builder
+
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r < 32 || r > 126:
+			builder.WriteRune('?')
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+func statementTextLines(statement entities.Statement, currency entities.Currency) []string {
+	row := func(date string, kind string, amount string, balance string, description string) string {
+		if len(description) > pdfDescriptionWidth {
+			description = description[:pdfDescriptionWidth-3] + "..."
+		}
+
+		return fmt.Sprintf("%-19s %-16s %14s %14s  %s", date, kind, amount, balance, description)
+	}
+
+	lines := []string{
+		fmt.Sprintf("Account statement %s", statement.AccountId),
+		fmt.Sprintf(
+			"Period: %s - %s, currency %s",
+			formatStatementTime(statement.From, statementDateTimeLayout),
+			formatStatementTime(statement.To-1, statementDateTimeLayout),
+			statement.Currency,
+		),
+		"",
+		row("Date", "Type", "Amount", "Balance", "Description"),
+		row("", "Opening balance", "", currency.Format(statement.OpeningBalance), ""),
+	}
+
+	for _, line := range statement.Lines {
+		lines = append(lines, row(
+			formatStatementTime(line.CreatedAt, statementDateTimeLayout),
+			line.Type,
+			currency.Format(line.Amount),
+			currency.Format(line.Balance),
+			line.Description,
+		))
+	}
+
+	lines = append(
+		lines,
+		row("", "Closing balance", "", currency.Format(statement.ClosingBalance), ""),
+		"",
+		fmt.Sprintf("Total credit: %s", currency.Format(statement.TotalCredit)),
+		fmt.Sprintf("Total debit: %s", currency.Format(statement.TotalDebit)),
+	)
+
+	return lines
+}
+
+// renderStatementPDF lays the statement out as plain text on A4 pages of a
+// minimal PDF document using the built-in Courier font.
+func renderStatementPDF(statement entities.Statement, currency entities.Currency) []byte {
+	lines := statementTextLines(statement, currency)
+
+	var pages [][]string
+	for start := 0; start < len(lines); start += pdfLinesPerPage {
+		pages = append(pages, lines[start:min(start+pdfLinesPerPage, len(lines))])
+	}
+
+	// Objects 1-3 are the catalog, the page tree and the font, followed by
+	// a page and its content stream for every page
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	}
+
+	kids := make([]string, len(pages))
+	for i, page := range pages {
+		pageId := len(objects) + 1
+		kids[i] = fmt.Sprintf("%d 0 R", pageId)
+
+		var stream strings.Builder
+		fmt.Fprintf(&stream, "BT /F1 %d Tf %d TL 36 800 Td", pdfFontSize, pdfLineHeight)
+		for _, line := range page {
+			fmt.Fprintf(&stream, " (%s) Tj T*", pdfEscape(line))
+		}
+		stream.WriteString(" ET")
+
+		objects = append(
+			objects,
+			fmt.Sprintf(
+				"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pageId+1,
+			),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buffer bytes.Buffer
+	buffer.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buffer.Len()
+		fmt.Fprintf(&buffer, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := buffer.Len()
+	fmt.Fprintf(&buffer, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buffer, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buffer, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+
+	return buffer.Bytes()
+}
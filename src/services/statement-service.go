@@ -0,0 +1,132 @@
+package services
+
+import (
+	"bank-system/src/entities"
+	"bank-system/src/repositories"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Statement formats accepted by Render
+const (
+	StatementFormatCSV     = "csv"
+	StatementFormatPDF     = "pdf"
+	StatementFormatCamt053 = "camt053"
+)
+
+type StatementService interface {
+	Get(ctx context.Context, userId string, accountId string, from int64, to int64) (entities.Statement, error)
+	// Render returns the statement in format together with its content type
+	Render(statement entities.Statement, format string) ([]byte, string, error)
+}
+
+type statementService struct {
+	accountRepository repositories.AccountRepository
+	ledgerRepository  repositories.LedgerRepository
+	logger            *logrus.Logger
+}
+
+func NewStatementService(
+	accountRepository repositories.AccountRepository,
+	ledgerRepository repositories.LedgerRepository,
+	logger *logrus.Logger,
+) StatementService {
+	return &statementService{
+		accountRepository: accountRepository,
+		ledgerRepository:  ledgerRepository,
+		logger:            logger,
+	}
+}
+
+// Get builds the statement of an account for [from, to) from its postings.
+func (this *statementService) Get(ctx context.Context, userId string, accountId string, from int64, to int64) (entities.Statement, error) {
+	account, err := this.accountRepository.GetById(ctx, accountId)
+	if err != nil {
+		this.logger.Errorf("Failed to get account: %v", err)
+		return entities.Statement{}, err
+	}
+
+	if account.UserID != userId {
+		this.logger.Errorf("Unauthorised")
+		return entities.Statement{}, errors.New("Unauthorised")
+	}
+
+	if from >= to {
+		this.logger.Errorf("Invalid statement period %d - %d", from, to)
+		return entities.Statement{}, errors.New("Statement period is empty")
+	}
+
+	openingBalance, err := this.ledgerRepository.GetAccountBalance(ctx, accountId, from)
+	if err != nil {
+		this.logger.Errorf("Failed to get opening balance of account %s: %v", accountId, err)
+		return entities.Statement{}, err
+	}
+
+	lines, err := this.ledgerRepository.GetAccountMovements(ctx, accountId, from, to)
+	if err != nil {
+		this.logger.Errorf("Failed to get movements of account %s: %v", accountId, err)
+		return entities.Statement{}, err
+	}
+
+	statement := entities.Statement{
+		AccountId:      accountId,
+		Currency:       account.Currency,
+		From:           from,
+		To:             to,
+		OpeningBalance: openingBalance,
+		Lines:          lines,
+		CreatedAt:      time.Now().Unix(),
+	}
+
+	balance := openingBalance
+	for i := range statement.Lines {
+		balance += statement.Lines[i].Amount
+		statement.Lines[i].Balance = balance
+
+		if statement.Lines[i].Amount > 0 {
+			statement.TotalCredit += statement.Lines[i].Amount
+		} else {
+			statement.TotalDebit -= statement.Lines[i].Amount
+		}
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+func (this *statementService) Render(statement entities.Statement, format string) ([]byte, string, error) {
+	currency, ok := entities.GetCurrency(statement.Currency)
+	if !ok {
+		this.logger.Errorf("Unsupported statement currency %s", statement.Currency)
+		return nil, "", errors.New("Unsupported currency")
+	}
+
+	var content []byte
+	var contentType string
+	var err error
+
+	switch format {
+	case StatementFormatCSV:
+		content, err = renderStatementCSV(statement, currency)
+		contentType = "text/csv; charset=utf-8"
+	case StatementFormatPDF:
+		content = renderStatementPDF(statement, currency)
+		contentType = "application/pdf"
+	case StatementFormatCamt053:
+		content, err = renderStatementCamt053(statement, currency)
+		contentType = "application/xml; charset=utf-8"
+	default:
+		this.logger.Errorf("Unsupported statement format %s", format)
+		return nil, "", errors.New("Unsupported statement format")
+	}
+
+	if err != nil {
+		this.logger.Errorf("Failed to render statement: %v", err)
+		return nil, "", err
+	}
+
+	return content, contentType, nil
+}
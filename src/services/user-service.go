@@ -14,6 +14,7 @@ import (
 type UserService interface {
 	Register(ctx context.Context, data entities.RegisterUserDto) (string, error)
 	Login(ctx context.Context, data entities.LoginUserDto) (string, error)
+	GetById(ctx context.Context, userId string) (entities.User, error)
 }
 
 type userService struct {
@@ -43,6 +44,7 @@ func (this *userService) Register(ctx context.Context, data entities.RegisterUse
 			Username: data.Username,
 			Password: string(passwordHash),
 			Email:    data.Email,
+			Role:     "user",
 		},
 	)
 
@@ -88,3 +90,13 @@ func (this *userService) Login(ctx context.Context, data entities.LoginUserDto)
 
 	return jwt, nil
 }
+
+func (this *userService) GetById(ctx context.Context, userId string) (entities.User, error) {
+	user, err := this.userRepository.GetById(ctx, userId)
+	if err != nil {
+		this.logger.Errorf("Failed to get user: %v", err)
+		return entities.User{}, err
+	}
+
+	return user, nil
+}
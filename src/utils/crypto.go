@@ -3,8 +3,10 @@ package utils
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 )
@@ -14,16 +16,34 @@ func deriveKey(password string) []byte {
 	return hash[:]
 }
 
-func EncryptWithPGP(data string, key string) ([]byte, error) {
-	derivedKey := deriveKey(key)
-	keyBytes := []byte(derivedKey)
-	keyLen := len(keyBytes)
+// HashWithHMAC returns the hex encoded HMAC-SHA256 of data. Equal data gives
+// equal hashes, so they can be looked up, but they cannot be reversed without the key.
+func HashWithHMAC(data string, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
 
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateKey returns a random AES-256 key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// EncryptWithAES encrypts data with AES-GCM. The random nonce is prepended to
+// the ciphertext.
+func EncryptWithAES(data []byte, key []byte) ([]byte, error) {
+	keyLen := len(key)
 	if keyLen != 16 && keyLen != 24 && keyLen != 32 {
 		return nil, errors.New("Key must be 16, 24, or 32 bytes long")
 	}
 
-	block, err := aes.NewCipher(keyBytes)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -38,36 +58,42 @@ func EncryptWithPGP(data string, key string) ([]byte, error) {
 		return nil, err
 	}
 
-	ciphertext := aesGCM.Seal(nonce, nonce, []byte(data), nil)
+	ciphertext := aesGCM.Seal(nonce, nonce, data, nil)
 
 	return ciphertext, nil
 }
 
-func DecryptWithPGP(encrypted []byte, key string) (string, error) {
-	derivedKey := deriveKey(key)
-	keyBytes := []byte(derivedKey)
-	keyLen := len(keyBytes)
+func DecryptWithAES(encrypted []byte, key []byte) ([]byte, error) {
+	keyLen := len(key)
 	if keyLen != 16 && keyLen != 24 && keyLen != 32 {
-		return "", errors.New("key must be 16, 24, or 32 bytes long")
+		return nil, errors.New("key must be 16, 24, or 32 bytes long")
 	}
 
-	block, err := aes.NewCipher(keyBytes)
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	aesGCM, err := cipher.NewGCM(block)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	nonceSize := aesGCM.NonceSize()
 	if len(encrypted) < nonceSize {
-		return "", errors.New("ciphertext too short")
+		return nil, errors.New("ciphertext too short")
 	}
 
 	nonce, ciphertext := encrypted[:nonceSize], encrypted[nonceSize:]
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+
+	return aesGCM.Open(nil, nonce, ciphertext, nil)
+}
+
+// DecryptWithPGP decrypts data encrypted with a key derived from a password.
+// Card data was encrypted this way with a key the client supplied before
+// cards got their own data keys.
+func DecryptWithPGP(encrypted []byte, key string) (string, error) {
+	plaintext, err := DecryptWithAES(encrypted, deriveKey(key))
 	if err != nil {
 		return "", err
 	}